@@ -2,6 +2,7 @@ package cli
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -32,6 +33,8 @@ func Run(name, usage, version string) {
 	app.Commands = []cli.Command{
 		getGohanClientCommand(),
 		getValidateCommand(),
+		getLintCommand(),
+		getGraphCommand(),
 		getInitDbCommand(),
 		getConvertCommand(),
 		getServerCommand(),
@@ -61,6 +64,11 @@ COMMANDS:
     set                 Update resource
     delete              Delete resource
 
+    gohan client policy explain --action action --path path [--token token]
+        [--tenant_id id] [--tenant_name name] [--user_id id]
+        [--roles role1,role2] [--groups group1,group2]
+                        Explain policies applied to the request
+
 ARGUMENTS:
     There are two types of arguments:
         - named:
@@ -157,6 +165,108 @@ It's especially useful to validate schema files against gohan meta-schema.`,
 	}
 }
 
+func getLintCommand() cli.Command {
+	return cli.Command{
+		Name:      "lint",
+		ShortName: "l",
+		Usage:     "Check schema files for common problems",
+		Description: `
+Load schema and extension files and report dangling relations, missing parents,
+unreachable policies, unused actions, properties without types, policy and extension
+paths which match no schema URL, reserved name collisions and SQL types
+incompatible with supported backends.
+
+Files can be supplied as arguments. Otherwise schemas listed in the config file are checked.
+Exits with non-zero status if any error is found.`,
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "config-file", Value: "", Usage: "Server config File"},
+			cli.StringFlag{Name: "output-format, o", Value: "text", Usage: "Output format (text, json)"},
+		},
+		Action: func(c *cli.Context) {
+			issues := schema.Lint(schemaFilesFromContext(c)...)
+			switch c.String("output-format") {
+			case "json":
+				output, err := json.MarshalIndent(issues, "", "\t")
+				if err != nil {
+					util.ExitFatal(err)
+				}
+				fmt.Println(string(output))
+			case "text":
+				for _, issue := range issues {
+					fmt.Println(issue)
+				}
+				fmt.Printf("%d issues found\n", len(issues))
+			default:
+				util.ExitFatal("Unknown output format:", c.String("output-format"))
+			}
+			for _, issue := range issues {
+				if issue.Level == schema.LintError {
+					os.Exit(1)
+				}
+			}
+		},
+	}
+}
+
+//schemaFilesFromContext returns schema files given as arguments or listed in the config file
+func schemaFilesFromContext(c *cli.Context) []string {
+	schemaFiles := []string(c.Args())
+	configFile := c.String("config-file")
+	if len(schemaFiles) == 0 && configFile != "" {
+		config := util.GetConfig()
+		if err := config.ReadConfig(configFile); err != nil {
+			util.ExitFatal("Failed to read config:", err)
+		}
+		if err := os.Chdir(filepath.Dir(configFile)); err != nil {
+			util.ExitFatal(err)
+		}
+		schemaFiles = config.GetStringList("schemas", nil)
+	}
+	if len(schemaFiles) == 0 {
+		util.ExitFatal("Need to provide schema files or config file")
+	}
+	return schemaFiles
+}
+
+func getGraphCommand() cli.Command {
+	return cli.Command{
+		Name:      "graph",
+		ShortName: "gr",
+		Usage:     "Output dependency graph of schemas",
+		Description: `
+Output parents, relation properties, namespaces and actions of schemas
+as Graphviz DOT, Mermaid or JSON.
+
+Files can be supplied as arguments. Otherwise schemas listed in the config file are used.
+Use --focus to output only schemas within --depth edges of given schema.`,
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "config-file", Value: "", Usage: "Server config File"},
+			cli.StringFlag{Name: "format, f", Value: "dot", Usage: "Output format (dot, mermaid, json)"},
+			cli.StringFlag{Name: "focus", Value: "", Usage: "Schema ID to focus on"},
+			cli.IntFlag{Name: "depth, d", Value: 1, Usage: "Depth of subgraph around focused schema"},
+		},
+		Action: func(c *cli.Context) {
+			manager := schema.GetManager()
+			if err := manager.LoadSchemasFromFiles(schemaFilesFromContext(c)...); err != nil {
+				util.ExitFatal(err)
+			}
+			graph := manager.Graph()
+			if focus := c.String("focus"); focus != "" {
+				var err error
+				graph, err = graph.Focus(focus, c.Int("depth"))
+				if err != nil {
+					util.ExitFatal(err)
+				}
+			}
+			output, err := graph.Format(c.String("format"))
+			if err != nil {
+				util.ExitFatal(err)
+			}
+			fmt.Println(output)
+		},
+	}
+}
+
 func getInitDbCommand() cli.Command {
 	return cli.Command{
 		Name:      "init-db",
@@ -312,12 +422,28 @@ func getMigrateCommand() cli.Command {
 			sqlString.WriteString("-- SQL in section 'Up' is executed when this migration is applied\n")
 			for _, s := range schemas {
 				sqlString.WriteString(sqlDB.GenTableDef(s, cascade))
+				for _, property := range s.Properties {
+					if property.IsManyToMany() {
+						sqlString.WriteString(sqlDB.GenJoinTableDef(s, property))
+					}
+				}
+				if s.Tagging {
+					sqlString.WriteString(sqlDB.GenTagTableDef(s))
+				}
 				sqlString.WriteString("\n")
 			}
 			sqlString.WriteString("\n")
 			sqlString.WriteString("-- +goose Down\n")
 			sqlString.WriteString("-- SQL section 'Down' is executed when this migration is rolled back\n")
 			for _, s := range schemas {
+				for _, property := range s.Properties {
+					if property.IsManyToMany() {
+						sqlString.WriteString(fmt.Sprintf("drop table %s;\n", s.GetJoinTableName(&property)))
+					}
+				}
+				if s.Tagging {
+					sqlString.WriteString(fmt.Sprintf("drop table %s;\n", s.GetTagTableName()))
+				}
 				sqlString.WriteString(fmt.Sprintf("drop table %s;", s.GetDbTableName()))
 				sqlString.WriteString("\n\n")
 			}
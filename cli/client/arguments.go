@@ -12,6 +12,7 @@ import (
 
 var (
 	incorrectOutputFormat = "Incorrect output format. Available formats: %v"
+	incorrectValueFormat  = "'%v' does not match format '%v'"
 	outputFormatKey       = "output-format"
 	outputFormatTable     = "table"
 	outputFormatJSON      = "json"
@@ -38,8 +39,10 @@ func getArgsAsMap(args []string, s *schema.Schema) (map[string]interface{}, erro
 	for i := 0; i < len(args); i += 2 {
 		key := strings.TrimPrefix(args[i], "--")
 		valueType := "string"
+		valueFormat := ""
 		if property, err := s.GetPropertyByID(key); err == nil {
 			valueType = property.Type
+			valueFormat = property.Format
 		}
 		rawValue := args[i+1]
 		var value interface{}
@@ -55,6 +58,9 @@ func getArgsAsMap(args []string, s *schema.Schema) (map[string]interface{}, erro
 			case "array", "object":
 				err = json.Unmarshal([]byte(rawValue), &value)
 			default:
+				if valueFormat != "" && !schema.IsFormat(valueFormat, rawValue) {
+					err = fmt.Errorf(incorrectValueFormat, rawValue, valueFormat)
+				}
 				value = rawValue
 			}
 			if err != nil {
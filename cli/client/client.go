@@ -165,7 +165,7 @@ func NewGohanClientCLI(opts *GohanClientCLIOpts) (*GohanClientCLI, error) {
 		}
 	}
 
-	gohanClientCLI.commands = gohanClientCLI.getCommands()
+	gohanClientCLI.commands = append(gohanClientCLI.getCommands(), gohanClientCLI.getPolicyExplainCommand())
 
 	return &gohanClientCLI, nil
 }
@@ -201,7 +201,13 @@ func (gohanClientCLI *GohanClientCLI) getSchemas() ([]*schema.Schema, error) {
 	response := extensions.GetResult{}
 	url := fmt.Sprintf("%s%s", gohanClientCLI.opts.gohanEndpointURL, gohanClientCLI.opts.gohanSchemaURL)
 	gohanClientCLI.logRequest("GET", url, gohanClientCLI.provider.TokenID, nil)
-	_, err := gohanClientCLI.provider.Get(url, &response.Body, nil)
+	var opts *gophercloud.RequestOpts
+	if gohanClientCLI.opts.language != "" {
+		opts = &gophercloud.RequestOpts{
+			MoreHeaders: map[string]string{"Accept-Language": gohanClientCLI.opts.language},
+		}
+	}
+	_, err := gohanClientCLI.provider.Get(url, &response.Body, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -434,6 +434,33 @@ var _ = Describe("CLI functions", func() {
 				Expect(commands[9].Name).To(Equal("castle delete"))
 			})
 
+			It("Should explain policies", func() {
+				explanation := map[string]interface{}{"allowed": true, "policy": "member_statement"}
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("POST", "/_policy/explain"),
+						ghttp.VerifyJSONRepresenting(map[string]interface{}{
+							"action": "read",
+							"path":   "/v2.0/networks",
+							"authorization": map[string]interface{}{
+								"tenant_id": "tenant",
+								"roles":     []string{"_member_", "viewer"},
+							},
+						}),
+						ghttp.RespondWithJSONEncoded(200, explanation),
+					),
+				)
+				result, err := gohanClientCLI.getPolicyExplainCommand().Action([]string{
+					"--action", "read", "--path", "/v2.0/networks", "--tenant_id", "tenant", "--roles", "_member_,viewer"})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result).To(Equal(map[string]interface{}{"allowed": true, "policy": "member_statement"}))
+			})
+
+			It("Should show error - unknown policy explain argument", func() {
+				_, err := gohanClientCLI.getPolicyExplainCommand().Action([]string{"--user", "admin"})
+				Expect(err).To(MatchError(ContainSubstring("Unknown argument user")))
+			})
+
 			Describe("Execute command", func() {
 				BeforeEach(func() {
 					gohanClientCLI.commands = []gohanCommand{}
@@ -533,6 +560,14 @@ var _ = Describe("CLI functions", func() {
 					Expect(argsMap).To(BeEquivalentTo(argsExpected))
 				})
 
+				It("Should parse arguments successfully - value matching format", func() {
+					args = append(args, "--portal", "fe80::1")
+					argsExpected["portal"] = "fe80::1"
+					argsMap, err := getArgsAsMap(args, s)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(argsMap).To(Equal(argsExpected))
+				})
+
 				It("Should parse arguments successfully - nil parsing", func() {
 					args = append(args, "--name", "<null>")
 					argsExpected["name"] = nil
@@ -624,6 +659,13 @@ var _ = Describe("CLI functions", func() {
 					Expect(err).To(MatchError("Error parsing parameter 'weapon': invalid character 'a' looking for beginning of value"))
 				})
 
+				It("Should show error - value not matching format", func() {
+					args = append(args, "--portal", "10.0.0.1")
+					argsMap, err := getArgsAsMap(args, s)
+					Expect(argsMap).To(BeNil())
+					Expect(err).To(MatchError("Error parsing parameter 'portal': '10.0.0.1' does not match format 'ipv6'"))
+				})
+
 				It("Should show error - incorrect output format", func() {
 					args = append(args, "--output-format", "xml")
 					argsMap, err := gohanClientCLI.handleArguments(args, s)
@@ -171,6 +171,14 @@ func getChamberSchema() map[string]interface{} {
 						"type": "string",
 					},
 				},
+				"portal": map[string]interface{}{
+					"permission": []interface{}{
+						"create",
+						"update",
+					},
+					"type":   "string",
+					"format": "ipv6",
+				},
 				"weapon": map[string]interface{}{
 					"permission": []interface{}{
 						"create",
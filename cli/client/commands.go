@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/rackspace/gophercloud"
 
@@ -152,6 +153,53 @@ func (gohanClientCLI *GohanClientCLI) getDeleteCommand(s *schema.Schema) gohanCo
 	}
 }
 
+//policyExplainArguments are arguments of policy explain command sent in authorization
+var policyExplainArguments = []string{"tenant_id", "tenant_name", "user_id", "roles", "groups"}
+
+func (gohanClientCLI *GohanClientCLI) getPolicyExplainCommand() gohanCommand {
+	return gohanCommand{
+		Name: "policy explain",
+		Action: func(args []string) (interface{}, error) {
+			argsMap, err := gohanClientCLI.handleArguments(args, schema.NewSchema("policy", "policies", "Policy", "Policy", "policy"))
+			if err != nil {
+				return nil, err
+			}
+			body := map[string]interface{}{}
+			authorization := map[string]interface{}{}
+			for key, value := range argsMap {
+				switch key {
+				case "action", "path", "token":
+					body[key] = value
+				case "roles", "groups":
+					authorization[key] = strings.Split(fmt.Sprint(value), ",")
+				case "tenant_id", "tenant_name", "user_id":
+					authorization[key] = value
+				default:
+					return nil, fmt.Errorf("Unknown argument %s, expected action, path, token or one of %s",
+						key, strings.Join(policyExplainArguments, ", "))
+				}
+			}
+			if len(authorization) > 0 {
+				body["authorization"] = authorization
+			}
+			opts := gophercloud.RequestOpts{
+				JSONBody: body,
+				OkCodes:  []int{200, 400},
+			}
+			url := fmt.Sprintf("%s/_policy/explain", gohanClientCLI.opts.gohanEndpointURL)
+			result, err := gohanClientCLI.request("POST", url, &opts)
+			if err != nil || gohanClientCLI.opts.outputFormat != outputFormatTable {
+				return result, err
+			}
+			explanation, ok := result.(map[string]interface{})
+			if _, failed := explanation[errorKey]; !ok || failed {
+				return result, nil
+			}
+			return map[string]interface{}{"policies": explanation["policies"]}, nil
+		},
+	}
+}
+
 func (gohanClientCLI *GohanClientCLI) handleResponse(response *http.Response, err error) (interface{}, error) {
 	defer response.Body.Close()
 	var result interface{}
@@ -20,6 +20,7 @@ var (
 	cacheSchemasKey           = "GOHAN_CACHE_SCHEMAS"
 	cacheTimeoutKey           = "GOHAN_CACHE_TIMEOUT"
 	cachePathKey              = "GOHAN_CACHE_PATH"
+	languageKey               = "GOHAN_LANGUAGE"
 	envVariableNotSetError    = "Environment variable %v needs to be set"
 	envVariablesNotSetError   = "Environment variable %v or %v needs to be set"
 	incorrectVerbosityLevel   = "Incorrect verbosity level. Available level range %d %d"
@@ -50,6 +51,8 @@ type GohanClientCLIOpts struct {
 	gohanRegion      string
 	gohanSchemaURL   string
 
+	language string
+
 	outputFormat string
 	logLevel     logging.Level
 }
@@ -103,6 +106,8 @@ func NewOptsFromEnv() (*GohanClientCLIOpts, error) {
 		opts.cachePath = cachePath
 	}
 
+	opts.language = os.Getenv(languageKey)
+
 	authTokenID := os.Getenv(keystoneTokenIDKey)
 	if authTokenID != "" {
 		opts.authTokenID = authTokenID
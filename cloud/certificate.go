@@ -0,0 +1,184 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/cloudwan/gohan/schema"
+)
+
+//certificateFields returns values of certificate fields which can be matched by mappings
+var certificateFields = map[string]func(cert *x509.Certificate) []string{
+	"common_name": func(cert *x509.Certificate) []string {
+		return []string{cert.Subject.CommonName}
+	},
+	"organization": func(cert *x509.Certificate) []string {
+		return cert.Subject.Organization
+	},
+	"organizational_unit": func(cert *x509.Certificate) []string {
+		return cert.Subject.OrganizationalUnit
+	},
+	"dns_name": func(cert *x509.Certificate) []string {
+		return cert.DNSNames
+	},
+	"email": func(cert *x509.Certificate) []string {
+		return cert.EmailAddresses
+	},
+}
+
+//CertificateMapping maps client certificates matching all its patterns to authorization
+type CertificateMapping struct {
+	//Patterns are regular expressions matched against whole values of certificate fields:
+	//common_name, organization, organizational_unit, dns_name and email
+	Patterns map[string]string
+	//TenantID, TenantName and UserID may refer named groups of patterns as ${name}
+	//UserID is the common name by default
+	TenantID   string
+	TenantName string
+	UserID     string
+	Roles      []string
+}
+
+//CertificateConfig is configuration of CertificateIdentity
+type CertificateConfig struct {
+	//Mappings are tried in order, and the first matching one is used
+	Mappings []CertificateMapping
+	//Tenants maps IDs to names of tenants, which aren't known from verified certificates yet
+	Tenants map[string]string
+	//ServiceAuthorization is returned by GetServiceAuthorization
+	ServiceAuthorization schema.Authorization
+}
+
+type certificateMapping struct {
+	CertificateMapping
+	patterns map[string]*regexp.Regexp
+}
+
+//CertificateIdentity maps client certificates verified by TLS to authorizations
+type CertificateIdentity struct {
+	config   CertificateConfig
+	mappings []*certificateMapping
+	tenants  *knownTenants
+}
+
+//NewCertificateIdentity is a constructor for CertificateIdentity middleware
+func NewCertificateIdentity(config CertificateConfig) (*CertificateIdentity, error) {
+	if len(config.Mappings) == 0 {
+		return nil, fmt.Errorf("No client certificate mapping configured")
+	}
+	if config.ServiceAuthorization == nil {
+		config.ServiceAuthorization = schema.NewAuthorization("", "", "", []string{"admin"}, nil)
+	}
+	identity := &CertificateIdentity{
+		config:  config,
+		tenants: newKnownTenants(config.Tenants),
+	}
+	for i, mapping := range config.Mappings {
+		compiled := &certificateMapping{CertificateMapping: mapping, patterns: map[string]*regexp.Regexp{}}
+		for field, pattern := range mapping.Patterns {
+			if _, ok := certificateFields[field]; !ok {
+				return nil, fmt.Errorf("Unknown certificate field %s in mapping %d", field, i)
+			}
+			compiledPattern, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("Invalid pattern of %s in mapping %d: %s", field, i, err)
+			}
+			compiled.patterns[field] = compiledPattern
+		}
+		if mapping.TenantID == "" {
+			return nil, fmt.Errorf("No tenant ID in mapping %d", i)
+		}
+		identity.mappings = append(identity.mappings, compiled)
+	}
+	return identity, nil
+}
+
+//match returns values of named groups if all patterns match the certificate
+func (mapping *certificateMapping) match(cert *x509.Certificate) (map[string]string, bool) {
+	groups := map[string]string{}
+	for field, pattern := range mapping.patterns {
+		matched := false
+		for _, value := range certificateFields[field](cert) {
+			submatches := pattern.FindStringSubmatch(value)
+			if submatches == nil {
+				continue
+			}
+			for i, name := range pattern.SubexpNames() {
+				if name != "" {
+					groups[name] = submatches[i]
+				}
+			}
+			matched = true
+			break
+		}
+		if !matched {
+			return nil, false
+		}
+	}
+	return groups, true
+}
+
+//VerifyCertificate maps client certificate verified by TLS to authorization
+func (identity *CertificateIdentity) VerifyCertificate(cert *x509.Certificate) (schema.Authorization, error) {
+	for _, mapping := range identity.mappings {
+		groups, ok := mapping.match(cert)
+		if !ok {
+			continue
+		}
+		expand := func(template string) string {
+			return os.Expand(template, func(name string) string { return groups[name] })
+		}
+		tenantID := expand(mapping.TenantID)
+		if tenantID == "" {
+			return nil, fmt.Errorf("No tenant ID mapped from client certificate %s", cert.Subject.CommonName)
+		}
+		tenantName := expand(mapping.TenantName)
+		identity.tenants.learn(tenantID, tenantName)
+		if tenantName == "" {
+			tenantName, _ = identity.tenants.tenantName(tenantID)
+		}
+		userID := cert.Subject.CommonName
+		if mapping.UserID != "" {
+			userID = expand(mapping.UserID)
+		}
+		return schema.NewUserAuthorization(tenantID, tenantName, "", userID, mapping.Roles, nil, nil), nil
+	}
+	return nil, fmt.Errorf("No mapping matches client certificate %s", cert.Subject.CommonName)
+}
+
+//VerifyToken rejects tokens, which should be verified by another identity service
+func (identity *CertificateIdentity) VerifyToken(token string) (schema.Authorization, error) {
+	return nil, fmt.Errorf("Token authentication isn't configured")
+}
+
+//GetTenantID maps the given tenant name to the tenant ID configured or seen in verified certificates
+func (identity *CertificateIdentity) GetTenantID(tenantName string) (string, error) {
+	return identity.tenants.tenantID(tenantName)
+}
+
+//GetTenantName maps the given tenant ID to the tenant name configured or seen in verified certificates
+func (identity *CertificateIdentity) GetTenantName(tenantID string) (string, error) {
+	return identity.tenants.tenantName(tenantID)
+}
+
+//GetServiceAuthorization returns the configured service authorization
+func (identity *CertificateIdentity) GetServiceAuthorization() (schema.Authorization, error) {
+	return identity.config.ServiceAuthorization, nil
+}
@@ -0,0 +1,101 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Certificate identity", func() {
+	var (
+		identity *CertificateIdentity
+		config   CertificateConfig
+	)
+
+	newCertificate := func(commonName string, organizationalUnits []string, dnsNames ...string) *x509.Certificate {
+		return &x509.Certificate{
+			Subject: pkix.Name{
+				CommonName:         commonName,
+				Organization:       []string{"gohan"},
+				OrganizationalUnit: organizationalUnits,
+			},
+			DNSNames: dnsNames,
+		}
+	}
+
+	BeforeEach(func() {
+		config = CertificateConfig{
+			Mappings: []CertificateMapping{
+				{
+					Patterns: map[string]string{
+						"common_name":         "agent-(?P<host>[a-z0-9]+)",
+						"organizational_unit": "tenant-(?P<tenant>[0-9a-f]+)",
+					},
+					TenantID: "${tenant}",
+					UserID:   "agent:${host}",
+					Roles:    []string{"agent"},
+				},
+				{
+					Patterns: map[string]string{"dns_name": ".*\\.controller\\.example\\.com"},
+					TenantID: "fc394f2ab2df4114bde39905f800dc57",
+					Roles:    []string{"admin"},
+				},
+			},
+			Tenants: map[string]string{"fc394f2ab2df4114bde39905f800dc57": "admin"},
+		}
+		var err error
+		identity, err = NewCertificateIdentity(config)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Should map certificate fields to authorization", func() {
+		auth, err := identity.VerifyCertificate(newCertificate("agent-host1", []string{"dev", "tenant-acf5662b"}))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(auth.TenantID()).To(Equal("acf5662b"))
+		Expect(auth.UserID()).To(Equal("agent:host1"))
+		Expect(auth.Roles()).To(HaveLen(1))
+		Expect(auth.Roles()[0].Name).To(Equal("agent"))
+
+		auth, err = identity.VerifyCertificate(newCertificate("node1", nil, "node1.controller.example.com"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(auth.TenantName()).To(Equal("admin"))
+		Expect(auth.UserID()).To(Equal("node1"))
+	})
+
+	It("Should show error - no matching mapping", func() {
+		_, err := identity.VerifyCertificate(newCertificate("agent-host1", []string{"dev"}))
+		Expect(err).To(MatchError("No mapping matches client certificate agent-host1"))
+		_, err = identity.VerifyCertificate(newCertificate("node1", nil, "node1.controller.example.com.evil.com"))
+		Expect(err).To(HaveOccurred())
+		_, err = identity.VerifyToken("token")
+		Expect(err).To(MatchError("Token authentication isn't configured"))
+	})
+
+	It("Should show error - invalid mappings", func() {
+		config.Mappings[0].Patterns["serial"] = "1"
+		_, err := NewCertificateIdentity(config)
+		Expect(err).To(MatchError("Unknown certificate field serial in mapping 0"))
+
+		config.Mappings[0].Patterns = map[string]string{}
+		config.Mappings[1].TenantID = ""
+		_, err = NewCertificateIdentity(config)
+		Expect(err).To(MatchError("No tenant ID in mapping 1"))
+	})
+})
@@ -0,0 +1,475 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" //registers SHA-256 for RS256 and ES256
+	_ "crypto/sha512" //registers SHA-384 and SHA-512
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwan/gohan/schema"
+)
+
+//minJWKSRefresh limits how often key set is fetched again for tokens signed by unknown keys
+const minJWKSRefresh = time.Minute
+
+//JWTClaims are names of token claims mapped to authorization
+//Nested claims are separated by dots, e.g. realm_access.roles
+type JWTClaims struct {
+	TenantID   string
+	TenantName string
+	UserID     string
+	Roles      string
+	Groups     string
+}
+
+//JWTConfig is configuration of JWTIdentity
+type JWTConfig struct {
+	//JWKSFile or JWKSURL is a location of JSON Web Key Set of the token issuer
+	JWKSFile string
+	JWKSURL  string
+	//JWKSRefresh is an interval of fetching key set from JWKSURL again
+	JWKSRefresh time.Duration
+	//Issuer and Audience are required values of iss and aud claims, if not empty
+	Issuer   string
+	Audience string
+	//Leeway is allowed clock skew in checking exp and nbf claims
+	Leeway time.Duration
+	Claims JWTClaims
+	//AllowNoExpiry accepts tokens without exp claim, which never expire
+	AllowNoExpiry bool
+	//Tenants maps IDs to names of tenants, which aren't known from verified tokens yet
+	Tenants map[string]string
+	//ServiceAuthorization is returned by GetServiceAuthorization
+	ServiceAuthorization schema.Authorization
+}
+
+//JWTIdentity verifies JSON Web Tokens, such as OpenID Connect ID tokens,
+//signed by keys of the configured key set
+type JWTIdentity struct {
+	config  JWTConfig
+	keySet  *jwtKeySet
+	tenants *knownTenants
+}
+
+//NewJWTIdentity is a constructor for JWTIdentity middleware
+func NewJWTIdentity(config JWTConfig) (*JWTIdentity, error) {
+	if (config.JWKSFile == "") == (config.JWKSURL == "") {
+		return nil, fmt.Errorf("Either JWKS file or JWKS URL should be configured")
+	}
+	claims := &config.Claims
+	claims.TenantID = defaultClaim(claims.TenantID, "tenant_id")
+	claims.TenantName = defaultClaim(claims.TenantName, "tenant_name")
+	claims.UserID = defaultClaim(claims.UserID, "sub")
+	claims.Roles = defaultClaim(claims.Roles, "roles")
+	claims.Groups = defaultClaim(claims.Groups, "groups")
+	if config.ServiceAuthorization == nil {
+		config.ServiceAuthorization = schema.NewAuthorization("", "", "", []string{"admin"}, nil)
+	}
+	identity := &JWTIdentity{
+		config:  config,
+		keySet:  &jwtKeySet{file: config.JWKSFile, url: config.JWKSURL, refresh: config.JWKSRefresh},
+		tenants: newKnownTenants(config.Tenants),
+	}
+	if err := identity.keySet.load(); err != nil {
+		if config.JWKSURL == "" {
+			return nil, err
+		}
+		log.Warning("Failed to load JWKS, it will be fetched again on first request: %s", err)
+	}
+	return identity, nil
+}
+
+func defaultClaim(claim, defaultClaim string) string {
+	if claim == "" {
+		return defaultClaim
+	}
+	return claim
+}
+
+//VerifyToken verifies signature and claims of the token
+func (identity *JWTIdentity) VerifyToken(token string) (schema.Authorization, error) {
+	claims, err := identity.verify(token, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("Invalid token: %s", err)
+	}
+	mapping := identity.config.Claims
+	tenantID := claimString(claims, mapping.TenantID)
+	if tenantID == "" {
+		return nil, fmt.Errorf("Invalid token: no tenant ID in claim %s", mapping.TenantID)
+	}
+	tenantName := claimString(claims, mapping.TenantName)
+	identity.tenants.learn(tenantID, tenantName)
+	return schema.NewUserAuthorization(
+		tenantID,
+		tenantName,
+		token,
+		claimString(claims, mapping.UserID),
+		claimStrings(claims, mapping.Roles),
+		claimStrings(claims, mapping.Groups),
+		nil,
+	), nil
+}
+
+//GetTenantID maps the given tenant name to the tenant ID configured or seen in verified tokens
+func (identity *JWTIdentity) GetTenantID(tenantName string) (string, error) {
+	return identity.tenants.tenantID(tenantName)
+}
+
+//GetTenantName maps the given tenant ID to the tenant name configured or seen in verified tokens
+func (identity *JWTIdentity) GetTenantName(tenantID string) (string, error) {
+	return identity.tenants.tenantName(tenantID)
+}
+
+//GetServiceAuthorization returns the configured service authorization
+func (identity *JWTIdentity) GetServiceAuthorization() (schema.Authorization, error) {
+	return identity.config.ServiceAuthorization, nil
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+//verify checks signature and registered claims of the token, and returns its claims
+func (identity *JWTIdentity) verify(token string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token should have three parts")
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("failed to decode header: %s", err)
+	}
+	algorithm, ok := jwtAlgorithms[header.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %s", header.Algorithm)
+	}
+	signature, err := decodeBase64URL(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signature: %s", err)
+	}
+	key, err := identity.keySet.lookup(header.KeyID, header.Algorithm, algorithm.keyType)
+	if err != nil {
+		return nil, err
+	}
+	if err := algorithm.verify(key.key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("failed to decode claims: %s", err)
+	}
+	leeway := identity.config.Leeway
+	expires, ok := claims["exp"].(float64)
+	if !ok && !identity.config.AllowNoExpiry {
+		return nil, fmt.Errorf("token has no expiration time")
+	}
+	if ok && !now.Before(unixTime(expires).Add(leeway)) {
+		return nil, fmt.Errorf("token is expired")
+	}
+	if notBefore, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(unixTime(notBefore)) {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+	if issuer := identity.config.Issuer; issuer != "" && claims["iss"] != issuer {
+		return nil, fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if audience := identity.config.Audience; audience != "" && !containsClaim(claims["aud"], audience) {
+		return nil, fmt.Errorf("token isn't issued for audience %s", audience)
+	}
+	return claims, nil
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(int64(seconds), 0)
+}
+
+func containsClaim(claim interface{}, value string) bool {
+	switch claim := claim.(type) {
+	case string:
+		return claim == value
+	case []interface{}:
+		for _, item := range claim {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//claimValue returns value of claim, following nested objects for names separated by dots
+func claimValue(claims map[string]interface{}, name string) interface{} {
+	var value interface{} = claims
+	for _, key := range strings.Split(name, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	switch value := claimValue(claims, name).(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+//claimStrings returns list claim, or a claim with space or comma separated values
+func claimStrings(claims map[string]interface{}, name string) []string {
+	values := []string{}
+	switch value := claimValue(claims, name).(type) {
+	case string:
+		for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' }) {
+			values = append(values, item)
+		}
+	case []interface{}:
+		for _, item := range value {
+			values = append(values, fmt.Sprint(item))
+		}
+	}
+	return values
+}
+
+func decodeBase64URL(segment string) ([]byte, error) {
+	if padding := len(segment) % 4; padding > 0 {
+		segment += strings.Repeat("=", 4-padding)
+	}
+	return base64.URLEncoding.DecodeString(segment)
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	data, err := decodeBase64URL(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+//jwtAlgorithm verifies signatures of an algorithm with keys of a key type
+type jwtAlgorithm struct {
+	keyType string
+	hash    crypto.Hash
+}
+
+var jwtAlgorithms = map[string]jwtAlgorithm{
+	"RS256": {"RSA", crypto.SHA256},
+	"RS384": {"RSA", crypto.SHA384},
+	"RS512": {"RSA", crypto.SHA512},
+	"ES256": {"EC", crypto.SHA256},
+	"ES384": {"EC", crypto.SHA384},
+	"ES512": {"EC", crypto.SHA512},
+	"HS256": {"oct", crypto.SHA256},
+	"HS384": {"oct", crypto.SHA384},
+	"HS512": {"oct", crypto.SHA512},
+}
+
+func (algorithm jwtAlgorithm) verify(key interface{}, signed, signature []byte) error {
+	if algorithm.keyType == "oct" {
+		mac := hmac.New(algorithm.hash.New, key.([]byte))
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	}
+	hash := algorithm.hash.New()
+	hash.Write(signed)
+	hashed := hash.Sum(nil)
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, algorithm.hash, hashed, signature); err != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, hashed, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+	return nil
+}
+
+//jsonWebKey is a key of JSON Web Key Set
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+	K         string `json:"k"`
+	key       interface{}
+}
+
+var jwkCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+func (jwk *jsonWebKey) decode() error {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decodeBase64URL(jwk.N)
+		if err != nil {
+			return err
+		}
+		e, err := decodeBase64URL(jwk.E)
+		if err != nil {
+			return err
+		}
+		jwk.key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		curve, ok := jwkCurves[jwk.Curve]
+		if !ok {
+			return fmt.Errorf("unsupported curve %s", jwk.Curve)
+		}
+		x, err := decodeBase64URL(jwk.X)
+		if err != nil {
+			return err
+		}
+		y, err := decodeBase64URL(jwk.Y)
+		if err != nil {
+			return err
+		}
+		jwk.key = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	case "oct":
+		k, err := decodeBase64URL(jwk.K)
+		if err != nil {
+			return err
+		}
+		jwk.key = k
+	default:
+		return fmt.Errorf("unsupported key type %s", jwk.KeyType)
+	}
+	return nil
+}
+
+//jwtKeySet holds keys loaded from JWKS file, or fetched from JWKS URL
+type jwtKeySet struct {
+	file, url string
+	refresh   time.Duration
+	mutex     sync.Mutex
+	keys      []*jsonWebKey
+	loadedAt  time.Time
+}
+
+func (keySet *jwtKeySet) read() ([]byte, error) {
+	if keySet.file != "" {
+		return ioutil.ReadFile(keySet.file)
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	response, err := client.Get(keySet.url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return ioutil.ReadAll(response.Body)
+}
+
+func (keySet *jwtKeySet) load() error {
+	keySet.loadedAt = time.Now()
+	data, err := keySet.read()
+	if err != nil {
+		return fmt.Errorf("Failed to read JWKS: %s", err)
+	}
+	var jwks struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return fmt.Errorf("Failed to parse JWKS: %s", err)
+	}
+	keys := []*jsonWebKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use == "enc" {
+			continue
+		}
+		if err := jwk.decode(); err != nil {
+			log.Warning("Ignoring key %s of JWKS: %s", jwk.KeyID, err)
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+	keySet.keys = keys
+	return nil
+}
+
+func (keySet *jwtKeySet) find(keyID, algorithm, keyType string) *jsonWebKey {
+	for _, jwk := range keySet.keys {
+		if jwk.KeyType != keyType || (keyID != "" && jwk.KeyID != keyID) {
+			continue
+		}
+		if jwk.Algorithm != "" && jwk.Algorithm != algorithm {
+			continue
+		}
+		return jwk
+	}
+	return nil
+}
+
+//lookup finds key for the token, fetching keys from JWKS URL again when refresh
+//interval has passed or the key isn't known, but at most once in minJWKSRefresh
+func (keySet *jwtKeySet) lookup(keyID, algorithm, keyType string) (*jsonWebKey, error) {
+	keySet.mutex.Lock()
+	defer keySet.mutex.Unlock()
+	if sinceLoad := time.Since(keySet.loadedAt); keySet.url != "" && sinceLoad > minJWKSRefresh {
+		expired := keySet.refresh > 0 && sinceLoad > keySet.refresh
+		if expired || keySet.find(keyID, algorithm, keyType) == nil {
+			if err := keySet.load(); err != nil {
+				log.Warning("%s", err)
+			}
+		}
+	}
+	key := keySet.find(keyID, algorithm, keyType)
+	if key == nil {
+		return nil, fmt.Errorf("no %s key %s found in JWKS", keyType, keyID)
+	}
+	return key, nil
+}
@@ -0,0 +1,249 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+func encodeBase64URL(data []byte) string {
+	return strings.TrimRight(base64.URLEncoding.EncodeToString(data), "=")
+}
+
+func signJWT(header, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	rawHeader, _ := json.Marshal(header)
+	rawClaims, _ := json.Marshal(claims)
+	signed := encodeBase64URL(rawHeader) + "." + encodeBase64URL(rawClaims)
+	return signed + "." + encodeBase64URL(sign([]byte(signed)))
+}
+
+func hashed(data []byte) []byte {
+	hash := crypto.SHA256.New()
+	hash.Write(data)
+	return hash.Sum(nil)
+}
+
+func paddedBytes(value *big.Int, size int) []byte {
+	data := value.Bytes()
+	return append(make([]byte, size-len(data)), data...)
+}
+
+var _ = Describe("JWT identity", func() {
+	var (
+		rsaKey    *rsa.PrivateKey
+		ecKey     *ecdsa.PrivateKey
+		hmacKey   = []byte("secret-key-of-gohan")
+		jwks      map[string]interface{}
+		jwksFile  string
+		identity  *JWTIdentity
+		claims    map[string]interface{}
+		signRSA   func(kid string, claims map[string]interface{}) string
+		newConfig func() JWTConfig
+	)
+
+	BeforeEach(func() {
+		var err error
+		rsaKey, err = rsa.GenerateKey(rand.Reader, 1024)
+		Expect(err).ToNot(HaveOccurred())
+		ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		jwks = map[string]interface{}{
+			"keys": []interface{}{
+				map[string]interface{}{
+					"kty": "RSA",
+					"kid": "rsa1",
+					"use": "sig",
+					"n":   encodeBase64URL(rsaKey.N.Bytes()),
+					"e":   encodeBase64URL(big.NewInt(int64(rsaKey.E)).Bytes()),
+				},
+				map[string]interface{}{
+					"kty": "EC",
+					"kid": "ec1",
+					"crv": "P-256",
+					"x":   encodeBase64URL(paddedBytes(ecKey.X, 32)),
+					"y":   encodeBase64URL(paddedBytes(ecKey.Y, 32)),
+				},
+				map[string]interface{}{
+					"kty": "oct",
+					"kid": "hmac1",
+					"alg": "HS256",
+					"k":   encodeBase64URL(hmacKey),
+				},
+			},
+		}
+		file, err := ioutil.TempFile("", "jwks")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(json.NewEncoder(file).Encode(jwks)).To(Succeed())
+		file.Close()
+		jwksFile = file.Name()
+
+		claims = map[string]interface{}{
+			"iss":         "https://idp.example.com",
+			"aud":         []interface{}{"gohan", "other"},
+			"sub":         "alice",
+			"exp":         time.Now().Add(time.Hour).Unix(),
+			"tenant_id":   "tenant1",
+			"tenant_name": "demo",
+			"realm_access": map[string]interface{}{
+				"roles": []interface{}{"_member_", "net_admin"},
+			},
+			"groups": "developers,ops",
+		}
+		signRSA = func(kid string, claims map[string]interface{}) string {
+			return signJWT(map[string]interface{}{"alg": "RS256", "kid": kid}, claims, func(signed []byte) []byte {
+				signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, hashed(signed))
+				Expect(err).ToNot(HaveOccurred())
+				return signature
+			})
+		}
+		newConfig = func() JWTConfig {
+			return JWTConfig{
+				JWKSFile: jwksFile,
+				Issuer:   "https://idp.example.com",
+				Audience: "gohan",
+				Claims:   JWTClaims{Roles: "realm_access.roles"},
+			}
+		}
+		identity, err = NewJWTIdentity(newConfig())
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.Remove(jwksFile)
+	})
+
+	It("Should map claims of valid token to authorization", func() {
+		token := signRSA("rsa1", claims)
+		auth, err := identity.VerifyToken(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(auth.TenantID()).To(Equal("tenant1"))
+		Expect(auth.TenantName()).To(Equal("demo"))
+		Expect(auth.UserID()).To(Equal("alice"))
+		Expect(auth.AuthToken()).To(Equal(token))
+		Expect(auth.Groups()).To(Equal([]string{"developers", "ops"}))
+		Expect(auth.Roles()).To(HaveLen(2))
+		Expect(auth.Roles()[1].Name).To(Equal("net_admin"))
+
+		tenantID, err := identity.GetTenantID("demo")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tenantID).To(Equal("tenant1"))
+		_, err = identity.GetTenantName("tenant2")
+		Expect(err).To(MatchError("Tenant with ID 'tenant2' not found"))
+	})
+
+	It("Should verify EC and HMAC signatures", func() {
+		token := signJWT(map[string]interface{}{"alg": "ES256", "kid": "ec1"}, claims, func(signed []byte) []byte {
+			r, s, err := ecdsa.Sign(rand.Reader, ecKey, hashed(signed))
+			Expect(err).ToNot(HaveOccurred())
+			return append(paddedBytes(r, 32), paddedBytes(s, 32)...)
+		})
+		_, err := identity.VerifyToken(token)
+		Expect(err).ToNot(HaveOccurred())
+
+		token = signJWT(map[string]interface{}{"alg": "HS256"}, claims, func(signed []byte) []byte {
+			mac := hmac.New(crypto.SHA256.New, hmacKey)
+			mac.Write(signed)
+			return mac.Sum(nil)
+		})
+		_, err = identity.VerifyToken(token)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Should show error - invalid tokens", func() {
+		token := signRSA("rsa1", claims)
+		_, err := identity.VerifyToken(token[:len(token)-4] + "AAAA")
+		Expect(err).To(MatchError("Invalid token: invalid signature"))
+
+		_, err = identity.VerifyToken(signRSA("rsa2", claims))
+		Expect(err).To(MatchError("Invalid token: no RSA key rsa2 found in JWKS"))
+
+		_, err = identity.VerifyToken(signJWT(map[string]interface{}{"alg": "none"}, claims, func([]byte) []byte { return nil }))
+		Expect(err).To(MatchError("Invalid token: unsupported algorithm none"))
+
+		claims["exp"] = time.Now().Add(-time.Hour).Unix()
+		_, err = identity.VerifyToken(signRSA("rsa1", claims))
+		Expect(err).To(MatchError("Invalid token: token is expired"))
+
+		delete(claims, "exp")
+		_, err = identity.VerifyToken(signRSA("rsa1", claims))
+		Expect(err).To(MatchError("Invalid token: token has no expiration time"))
+
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		claims["aud"] = "other"
+		_, err = identity.VerifyToken(signRSA("rsa1", claims))
+		Expect(err).To(MatchError("Invalid token: token isn't issued for audience gohan"))
+
+		claims["aud"] = "gohan"
+		claims["iss"] = "https://evil.example.com"
+		_, err = identity.VerifyToken(signRSA("rsa1", claims))
+		Expect(err).To(MatchError("Invalid token: unexpected issuer https://evil.example.com"))
+
+		claims["iss"] = "https://idp.example.com"
+		delete(claims, "tenant_id")
+		_, err = identity.VerifyToken(signRSA("rsa1", claims))
+		Expect(err).To(MatchError("Invalid token: no tenant ID in claim tenant_id"))
+	})
+
+	It("Should fetch JWKS from URL", func() {
+		server := ghttp.NewServer()
+		defer server.Close()
+		server.AppendHandlers(ghttp.CombineHandlers(
+			ghttp.VerifyRequest("GET", "/certs"),
+			ghttp.RespondWithJSONEncoded(200, jwks),
+		))
+		config := newConfig()
+		config.JWKSFile = ""
+		config.JWKSURL = server.URL() + "/certs"
+		identity, err := NewJWTIdentity(config)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = identity.VerifyToken(signRSA("rsa1", claims))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.ReceivedRequests()).To(HaveLen(1))
+	})
+
+	It("Should accept tokens without expiration time if allowed", func() {
+		config := newConfig()
+		config.AllowNoExpiry = true
+		identity, err := NewJWTIdentity(config)
+		Expect(err).ToNot(HaveOccurred())
+		delete(claims, "exp")
+		_, err = identity.VerifyToken(signRSA("rsa1", claims))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Should show error - missing key set", func() {
+		config := newConfig()
+		config.JWKSFile = ""
+		_, err := NewJWTIdentity(config)
+		Expect(err).To(MatchError("Either JWKS file or JWKS URL should be configured"))
+	})
+})
@@ -33,22 +33,58 @@ const maxReauthAttempts = 3
 
 //KeystoneIdentity middleware
 type KeystoneIdentity struct {
-	Client KeystoneClient
+	Client    KeystoneClient
+	cache     *tokenCache
+	directory *tenantDirectory
 }
 
-// VerifyToken verifies identity
+// VerifyToken verifies identity, using token cache if it's enabled
 func (identity *KeystoneIdentity) VerifyToken(token string) (schema.Authorization, error) {
+	if identity.cache != nil {
+		return identity.cache.verify(token, identity.Client)
+	}
 	return identity.Client.VerifyToken(token)
 }
 
-// GetTenantID maps the given tenant/project name to the tenant's/project's ID
+//EnableUserGroups makes keystone v3 look up groups of users when verifying their tokens,
+//besides federated groups in the tokens. Groups are cached with tokens if token cache is enabled.
+func (identity *KeystoneIdentity) EnableUserGroups() error {
+	client, ok := identity.Client.(*keystoneV3Client)
+	if !ok {
+		return fmt.Errorf("user groups are supported only by keystone v3")
+	}
+	client.userGroups = true
+	return nil
+}
+
+// GetTenantID maps the given tenant/project name to the tenant's/project's ID, using tenant directory if it's enabled
 func (identity *KeystoneIdentity) GetTenantID(tenantName string) (string, error) {
-	return identity.Client.GetTenantID(tenantName)
+	if identity.directory == nil {
+		return identity.Client.GetTenantID(tenantName)
+	}
+	tenantIDs, err := identity.directory.lookup([]string{tenantName}, true)
+	if err != nil {
+		return "", err
+	}
+	if tenantID, ok := tenantIDs[tenantName]; ok {
+		return tenantID, nil
+	}
+	return "", fmt.Errorf("Tenant with name '%s' not found", tenantName)
 }
 
-// GetTenantName maps the given tenant/project name to the tenant's/project's ID
+// GetTenantName maps the given tenant/project ID to the tenant's/project's name, using tenant directory if it's enabled
 func (identity *KeystoneIdentity) GetTenantName(tenantID string) (string, error) {
-	return identity.Client.GetTenantName(tenantID)
+	if identity.directory == nil {
+		return identity.Client.GetTenantName(tenantID)
+	}
+	tenantNames, err := identity.directory.lookup([]string{tenantID}, false)
+	if err != nil {
+		return "", err
+	}
+	if tenantName, ok := tenantNames[tenantID]; ok {
+		return tenantName, nil
+	}
+	return "", fmt.Errorf("Tenant with ID '%s' not found", tenantID)
 }
 
 // GetServiceAuthorization returns the master authorization with full permisions
@@ -69,7 +105,8 @@ type keystoneV2Client struct {
 }
 
 type keystoneV3Client struct {
-	client *gophercloud.ServiceClient
+	client     *gophercloud.ServiceClient
+	userGroups bool
 }
 
 func matchVersionFromAuthURL(authURL string) (version string) {
@@ -178,10 +215,18 @@ func NewKeystoneV3Client(authURL, userName, password, domainName, tenantName str
 
 //VerifyToken verifies keystone v3.0 token
 func (client *keystoneV3Client) VerifyToken(token string) (schema.Authorization, error) {
+	verified, err := client.verifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return verified.auth, nil
+}
+
+func (client *keystoneV3Client) verifyToken(token string) (*verifiedToken, error) {
 	tokenResult := v3tokens.Get(client.client, token)
 	_, err := tokenResult.Extract()
 	if err != nil {
-		return nil, fmt.Errorf("Invalid token")
+		return nil, verificationError(err)
 	}
 	tokenBody := tokenResult.Body.(map[string]interface{})["token"]
 	roles := tokenBody.(map[string]interface{})["roles"]
@@ -190,6 +235,12 @@ func (client *keystoneV3Client) VerifyToken(token string) (schema.Authorization,
 		roleIDs = append(roleIDs, roleBody.(map[string]interface{})["name"].(string))
 	}
 	tokenBodyMap := tokenBody.(map[string]interface{})
+	user, _ := tokenBodyMap["user"].(map[string]interface{})
+	userID, _ := user["id"].(string)
+	groups, err := client.getUserGroups(user)
+	if err != nil {
+		return nil, err
+	}
 	project := tokenBodyMap["project"].(map[string]interface{})
 	tenantID := project["id"].(string)
 	tenantName := project["name"].(string)
@@ -210,7 +261,43 @@ func (client *keystoneV3Client) VerifyToken(token string) (schema.Authorization,
 			catalogObj = append(catalogObj, schema.NewCatalog(catalog["name"].(string), catalog["type"].(string), endPoints))
 		}
 	}
-	return schema.NewAuthorization(tenantID, tenantName, token, roleIDs, catalogObj), nil
+	return &verifiedToken{
+		auth:      schema.NewUserAuthorization(tenantID, tenantName, token, userID, roleIDs, groups, catalogObj),
+		expiresAt: parseTokenTime(tokenBodyMap["expires_at"]),
+		issuedAt:  parseTokenTime(tokenBodyMap["issued_at"]),
+		auditIDs:  auditIDs(tokenBodyMap["audit_ids"]),
+	}, nil
+}
+
+//getUserGroups returns IDs and names of federated groups in the token,
+//and of groups of the user in keystone if user groups are enabled
+func (client *keystoneV3Client) getUserGroups(user map[string]interface{}) ([]string, error) {
+	federation, _ := user["OS-FEDERATION"].(map[string]interface{})
+	federatedGroups, _ := federation["groups"].([]interface{})
+	groups := appendGroups([]string{}, federatedGroups)
+	userID, _ := user["id"].(string)
+	if !client.userGroups || userID == "" {
+		return groups, nil
+	}
+	var result map[string]interface{}
+	_, err := client.client.Get(client.client.ServiceURL("users", userID, "groups"), &result, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get groups of user %s: %s", userID, err)
+	}
+	userGroups, _ := result["groups"].([]interface{})
+	return appendGroups(groups, userGroups), nil
+}
+
+func appendGroups(groups []string, rawGroups []interface{}) []string {
+	for _, rawGroup := range rawGroups {
+		group, _ := rawGroup.(map[string]interface{})
+		for _, key := range []string{"id", "name"} {
+			if value, ok := group[key].(string); ok && value != "" {
+				groups = append(groups, value)
+			}
+		}
+	}
+	return groups
 }
 
 // GetTenantID maps the given v3.0 project ID to the projects's name
@@ -248,19 +335,29 @@ func (client *keystoneV3Client) GetServiceAuthorization() (schema.Authorization,
 
 //VerifyToken verifies keystone v2.0 token
 func (client *keystoneV2Client) VerifyToken(token string) (schema.Authorization, error) {
+	verified, err := client.verifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return verified.auth, nil
+}
+
+func (client *keystoneV2Client) verifyToken(token string) (*verifiedToken, error) {
 	tokenResult, err := verifyV2Token(client.client, token)
 	if err != nil {
-		return nil, fmt.Errorf("Invalid token")
+		return nil, verificationError(err)
 	}
 	tokenBody := tokenResult.(map[string]interface{})["access"]
 	userBody := tokenBody.(map[string]interface{})["user"]
+	userID, _ := userBody.(map[string]interface{})["id"].(string)
 	roles := userBody.(map[string]interface{})["roles"]
 	roleIDs := []string{}
 	for _, roleBody := range roles.([]interface{}) {
 		roleIDs = append(roleIDs, roleBody.(map[string]interface{})["name"].(string))
 	}
 	tokenBodyMap := tokenBody.(map[string]interface{})
-	tenant := tokenBodyMap["token"].(map[string]interface{})["tenant"].(map[string]interface{})
+	tokenMap := tokenBodyMap["token"].(map[string]interface{})
+	tenant := tokenMap["tenant"].(map[string]interface{})
 	tenantID := tenant["id"].(string)
 	tenantName := tenant["name"].(string)
 	catalogList := tokenBodyMap["serviceCatalog"].([]interface{})
@@ -290,7 +387,12 @@ func (client *keystoneV2Client) VerifyToken(token string) (schema.Authorization,
 		}
 		catalogObj = append(catalogObj, schema.NewCatalog(catalog["name"].(string), catalog["type"].(string), endPoints))
 	}
-	return schema.NewAuthorization(tenantID, tenantName, token, roleIDs, catalogObj), nil
+	return &verifiedToken{
+		auth:      schema.NewUserAuthorization(tenantID, tenantName, token, userID, roleIDs, nil, catalogObj),
+		expiresAt: parseTokenTime(tokenMap["expires"]),
+		issuedAt:  parseTokenTime(tokenMap["issued_at"]),
+		auditIDs:  auditIDs(tokenMap["audit_ids"]),
+	}, nil
 }
 
 // GetTenantID maps the given v2.0 project name to the tenant's id
@@ -171,4 +171,55 @@ var _ = Describe("Keystone client", func() {
 			})
 		})
 	})
+
+	Describe("Groups of keystone v3 users", func() {
+		var identity *KeystoneIdentity
+
+		BeforeEach(func() {
+			server.AppendHandlers(
+				ghttp.RespondWithJSONEncoded(201, getV3TokensResponse()),
+			)
+			client, _ = NewKeystoneV3Client(server.URL()+"/v3", username, password, domainName, tenantName)
+			identity = &KeystoneIdentity{Client: client}
+		})
+
+		It("Should use only federated groups in the token by default", func() {
+			server.AppendHandlers(
+				ghttp.RespondWithJSONEncoded(200, getV3TokenVerificationResponse()),
+			)
+			auth, err := identity.VerifyToken("demo_token")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(auth.Groups()).To(Equal([]string{"9012"}))
+			Expect(server.ReceivedRequests()).To(HaveLen(2))
+		})
+
+		It("Should look up groups of the user if enabled", func() {
+			Expect(identity.EnableUserGroups()).To(Succeed())
+			server.AppendHandlers(
+				ghttp.RespondWithJSONEncoded(200, getV3TokenVerificationResponse()),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/v3/users/5678/groups"),
+					ghttp.RespondWithJSONEncoded(200, getV3UserGroupsResponse()),
+				),
+			)
+			auth, err := identity.VerifyToken("demo_token")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(auth.Groups()).To(Equal([]string{"9012", "ea167b", "netops"}))
+		})
+
+		It("Should reject the token if groups of the user can't be looked up", func() {
+			Expect(identity.EnableUserGroups()).To(Succeed())
+			server.AppendHandlers(
+				ghttp.RespondWithJSONEncoded(200, getV3TokenVerificationResponse()),
+				ghttp.RespondWith(403, nil),
+			)
+			_, err := identity.VerifyToken("demo_token")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should not be supported by keystone v2", func() {
+			identity = &KeystoneIdentity{Client: &keystoneV2Client{}}
+			Expect(identity.EnableUserGroups()).ToNot(Succeed())
+		})
+	})
 })
@@ -38,6 +38,45 @@ func getV3TokensResponse() interface{} {
 	}
 }
 
+func getV3TokenVerificationResponse() interface{} {
+	return map[string]interface{}{
+		"token": map[string]interface{}{
+			"expires_at": "2013-02-27T18:30:59.999999Z",
+			"issued_at":  "2013-02-27T16:30:59.999999Z",
+			"roles": []interface{}{
+				map[string]interface{}{
+					"id":   "51cc68287d524c759f47c811e6463340",
+					"name": "_member_",
+				},
+			},
+			"project": map[string]interface{}{
+				"id":   "3456",
+				"name": "demo",
+			},
+			"user": map[string]interface{}{
+				"id":   "5678",
+				"name": "demo",
+				"OS-FEDERATION": map[string]interface{}{
+					"groups": []interface{}{
+						map[string]interface{}{"id": "9012"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func getV3UserGroupsResponse() interface{} {
+	return map[string]interface{}{
+		"groups": []interface{}{
+			map[string]interface{}{
+				"id":   "ea167b",
+				"name": "netops",
+			},
+		},
+	}
+}
+
 func getV2TenantsResponse() interface{} {
 	return map[string]interface{}{
 		"tenants": []interface{}{
@@ -0,0 +1,9 @@
+package cloud
+
+import (
+	"github.com/op/go-logging"
+
+	l "github.com/cloudwan/gohan/log"
+)
+
+var log = logging.MustGetLogger(l.GetModuleName())
@@ -0,0 +1,341 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	v3tenants "github.com/kwapik/gophercloud/openstack/identity/v3/projects"
+	v2tenants "github.com/rackspace/gophercloud/openstack/identity/v2/tenants"
+	"github.com/rackspace/gophercloud/pagination"
+)
+
+//tenantLister is implemented by keystone clients listing all tenants
+type tenantLister interface {
+	listTenants() (map[string]string, error)
+}
+
+//listTenants returns names of all tenants by their IDs
+func (client *keystoneV2Client) listTenants() (map[string]string, error) {
+	tenants := map[string]string{}
+	err := v2tenants.List(client.client, &v2tenants.ListOpts{}).EachPage(func(page pagination.Page) (bool, error) {
+		tenantsList, err := v2tenants.ExtractTenants(page)
+		if err != nil {
+			return false, err
+		}
+		for _, tenant := range tenantsList {
+			tenants[tenant.ID] = tenant.Name
+		}
+		return true, nil
+	})
+	return tenants, err
+}
+
+//listTenants returns names of all projects by their IDs
+func (client *keystoneV3Client) listTenants() (map[string]string, error) {
+	tenants := map[string]string{}
+	err := v3tenants.List(client.client, v3tenants.ListOpts{}).EachPage(func(page pagination.Page) (bool, error) {
+		tenantsList, err := v3tenants.ExtractProjects(page)
+		if err != nil {
+			return false, err
+		}
+		for _, tenant := range tenantsList {
+			tenants[tenant.ID] = tenant.Name
+		}
+		return true, nil
+	})
+	return tenants, err
+}
+
+//TenantDirectoryConfig configures caching of tenants listed from keystone
+type TenantDirectoryConfig struct {
+	//RefreshInterval is the interval of listing tenants again
+	RefreshInterval time.Duration
+	//MissRefreshInterval limits how often tenants are listed again for unknown tenants, 0 disables it
+	MissRefreshInterval time.Duration
+}
+
+//TenantDirectoryStats are counters of tenant directory
+type TenantDirectoryStats struct {
+	Size        int       `json:"size"`
+	Hits        uint64    `json:"hits"`
+	Misses      uint64    `json:"misses"`
+	Refreshes   uint64    `json:"refreshes"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+}
+
+//tenantDirectory caches names and IDs of all tenants
+type tenantDirectory struct {
+	config      TenantDirectoryConfig
+	lister      tenantLister
+	mutex       sync.Mutex
+	names       map[string]string
+	ids         map[string]string
+	attemptedAt time.Time
+	listing     *tenantListing
+	stats       TenantDirectoryStats
+	now         func() time.Time
+	stop        chan struct{}
+}
+
+//tenantListing is listing of tenants in progress, which is done when done is closed
+type tenantListing struct {
+	done chan struct{}
+	err  error
+}
+
+func newTenantDirectory(config TenantDirectoryConfig, lister tenantLister) *tenantDirectory {
+	directory := &tenantDirectory{
+		config: config,
+		lister: lister,
+		now:    time.Now,
+	}
+	directory.clear()
+	return directory
+}
+
+func (directory *tenantDirectory) clear() {
+	directory.names = map[string]string{}
+	directory.ids = map[string]string{}
+	directory.attemptedAt = time.Time{}
+	directory.stats.RefreshedAt = time.Time{}
+}
+
+//refresh lists tenants and swaps them in, keeping tenants listed before if it fails
+//The mutex isn't held while listing, and callers during listing wait for its result
+func (directory *tenantDirectory) refresh() error {
+	directory.mutex.Lock()
+	if listing := directory.listing; listing != nil {
+		directory.mutex.Unlock()
+		<-listing.done
+		return listing.err
+	}
+	listing := &tenantListing{done: make(chan struct{})}
+	directory.listing = listing
+	attemptedAt := directory.now()
+	directory.attemptedAt = attemptedAt
+	directory.mutex.Unlock()
+
+	tenants, err := directory.lister.listTenants()
+	var ids map[string]string
+	if err == nil {
+		ids = invertTenants(tenants)
+	}
+
+	directory.mutex.Lock()
+	if err == nil {
+		directory.names = tenants
+		directory.ids = ids
+		directory.stats.Refreshes++
+		directory.stats.RefreshedAt = attemptedAt
+	}
+	listing.err = err
+	directory.listing = nil
+	directory.mutex.Unlock()
+	close(listing.done)
+	return err
+}
+
+//lookup maps tenant IDs to names, or names to IDs if byName is true
+//Unknown tenants are missing in the result
+func (directory *tenantDirectory) lookup(keys []string, byName bool) (map[string]string, error) {
+	directory.mutex.Lock()
+	since := directory.now().Sub(directory.attemptedAt)
+	stale := directory.stats.RefreshedAt.IsZero() || since >= directory.config.RefreshInterval
+	directory.mutex.Unlock()
+	if stale {
+		if err := directory.refresh(); err != nil {
+			refreshedAt := directory.refreshedAt()
+			if refreshedAt.IsZero() {
+				return nil, err
+			}
+			log.Warning("Failed to list tenants, using tenants listed at %s: %s", refreshedAt, err)
+		}
+	}
+	result := directory.find(keys, byName)
+	missRefresh := directory.config.MissRefreshInterval > 0 && since >= directory.config.MissRefreshInterval
+	if len(result) < len(keys) && !stale && missRefresh {
+		if err := directory.refresh(); err != nil {
+			log.Warning("Failed to list tenants: %s", err)
+		}
+		result = directory.find(keys, byName)
+	}
+	directory.mutex.Lock()
+	defer directory.mutex.Unlock()
+	directory.stats.Hits += uint64(len(result))
+	directory.stats.Misses += uint64(len(keys) - len(result))
+	return result, nil
+}
+
+func (directory *tenantDirectory) refreshedAt() time.Time {
+	directory.mutex.Lock()
+	defer directory.mutex.Unlock()
+	return directory.stats.RefreshedAt
+}
+
+func (directory *tenantDirectory) find(keys []string, byName bool) map[string]string {
+	directory.mutex.Lock()
+	defer directory.mutex.Unlock()
+	if byName {
+		return findTenants(directory.ids, keys)
+	}
+	return findTenants(directory.names, keys)
+}
+
+//findTenants returns values of the keys found in tenants
+func findTenants(tenants map[string]string, keys []string) map[string]string {
+	result := map[string]string{}
+	for _, key := range keys {
+		if value, ok := tenants[key]; ok {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+//invertTenants maps names of tenants to their IDs
+func invertTenants(tenants map[string]string) map[string]string {
+	inverted := map[string]string{}
+	for tenantID, tenantName := range tenants {
+		inverted[tenantName] = tenantID
+	}
+	return inverted
+}
+
+//tenants returns names of all known tenants by their IDs
+func (directory *tenantDirectory) tenants() map[string]string {
+	directory.mutex.Lock()
+	defer directory.mutex.Unlock()
+	tenants := map[string]string{}
+	for tenantID, tenantName := range directory.names {
+		tenants[tenantID] = tenantName
+	}
+	return tenants
+}
+
+//flush forgets all tenants, so that they are listed again on next lookup
+func (directory *tenantDirectory) flush() {
+	directory.mutex.Lock()
+	defer directory.mutex.Unlock()
+	directory.clear()
+}
+
+//refreshPeriodically lists tenants every refresh interval until the directory is stopped
+func (directory *tenantDirectory) refreshPeriodically() {
+	ticker := time.NewTicker(directory.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-directory.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := directory.refresh(); err != nil {
+			log.Warning("Failed to list tenants: %s", err)
+		}
+	}
+}
+
+//Stats returns counters of the directory
+func (directory *tenantDirectory) Stats() TenantDirectoryStats {
+	directory.mutex.Lock()
+	defer directory.mutex.Unlock()
+	stats := directory.stats
+	stats.Size = len(directory.names)
+	return stats
+}
+
+//EnableTenantDirectory caches tenants of keystone, which are listed periodically
+func (identity *KeystoneIdentity) EnableTenantDirectory(config TenantDirectoryConfig) error {
+	lister, ok := identity.Client.(tenantLister)
+	if !ok {
+		return fmt.Errorf("Keystone client doesn't support listing tenants")
+	}
+	identity.StopTenantDirectory()
+	directory := newTenantDirectory(config, lister)
+	if config.RefreshInterval > 0 {
+		directory.stop = make(chan struct{})
+		go directory.refreshPeriodically()
+	}
+	identity.directory = directory
+	return nil
+}
+
+//StopTenantDirectory stops caching and listing tenants
+func (identity *KeystoneIdentity) StopTenantDirectory() {
+	if identity.directory != nil && identity.directory.stop != nil {
+		close(identity.directory.stop)
+	}
+	identity.directory = nil
+}
+
+//TenantDirectoryStats returns counters of tenant directory, which are zero if it isn't enabled
+func (identity *KeystoneIdentity) TenantDirectoryStats() TenantDirectoryStats {
+	if identity.directory == nil {
+		return TenantDirectoryStats{}
+	}
+	return identity.directory.Stats()
+}
+
+//FlushTenants makes tenant directory list tenants again on next lookup
+func (identity *KeystoneIdentity) FlushTenants() {
+	if identity.directory != nil {
+		identity.directory.flush()
+	}
+}
+
+//Tenants returns names of all tenants by their IDs
+func (identity *KeystoneIdentity) Tenants() (map[string]string, error) {
+	if identity.directory != nil {
+		if _, err := identity.directory.lookup(nil, false); err != nil {
+			return nil, err
+		}
+		return identity.directory.tenants(), nil
+	}
+	lister, ok := identity.Client.(tenantLister)
+	if !ok {
+		return nil, fmt.Errorf("Keystone client doesn't support listing tenants")
+	}
+	return lister.listTenants()
+}
+
+//GetTenantNames maps tenant IDs to names by listing tenants at most once
+//Unknown tenants are missing in the result
+func (identity *KeystoneIdentity) GetTenantNames(tenantIDs []string) (map[string]string, error) {
+	return identity.lookupTenants(tenantIDs, false)
+}
+
+//GetTenantIDs maps tenant names to IDs by listing tenants at most once
+//Unknown tenants are missing in the result
+func (identity *KeystoneIdentity) GetTenantIDs(tenantNames []string) (map[string]string, error) {
+	return identity.lookupTenants(tenantNames, true)
+}
+
+func (identity *KeystoneIdentity) lookupTenants(keys []string, byName bool) (map[string]string, error) {
+	if identity.directory != nil {
+		return identity.directory.lookup(keys, byName)
+	}
+	tenants, err := identity.Tenants()
+	if err != nil {
+		return nil, err
+	}
+	if byName {
+		tenants = invertTenants(tenants)
+	}
+	return findTenants(tenants, keys), nil
+}
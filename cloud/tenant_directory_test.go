@@ -0,0 +1,135 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeTenantLister struct {
+	tenants map[string]string
+	err     error
+	calls   int
+	listing func()
+}
+
+func (lister *fakeTenantLister) listTenants() (map[string]string, error) {
+	lister.calls++
+	if lister.listing != nil {
+		lister.listing()
+	}
+	if lister.err != nil {
+		return nil, lister.err
+	}
+	tenants := map[string]string{}
+	for tenantID, tenantName := range lister.tenants {
+		tenants[tenantID] = tenantName
+	}
+	return tenants, nil
+}
+
+var _ = Describe("Tenant directory", func() {
+	var (
+		lister    *fakeTenantLister
+		directory *tenantDirectory
+		now       time.Time
+	)
+
+	BeforeEach(func() {
+		lister = &fakeTenantLister{tenants: map[string]string{"t1": "demo", "t2": "admin"}}
+		directory = newTenantDirectory(TenantDirectoryConfig{
+			RefreshInterval:     time.Minute,
+			MissRefreshInterval: 10 * time.Second,
+		}, lister)
+		now = time.Unix(1000, 0)
+		directory.now = func() time.Time { return now }
+	})
+
+	It("Should look up tenants in bulk by listing them once", func() {
+		names, err := directory.lookup([]string{"t1", "t2", "t3"}, false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names).To(Equal(map[string]string{"t1": "demo", "t2": "admin"}))
+		ids, err := directory.lookup([]string{"admin"}, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ids).To(Equal(map[string]string{"admin": "t2"}))
+		Expect(lister.calls).To(Equal(1))
+
+		stats := directory.Stats()
+		Expect(stats.Size).To(Equal(2))
+		Expect(stats.Hits).To(BeEquivalentTo(3))
+		Expect(stats.Misses).To(BeEquivalentTo(1))
+		Expect(stats.Refreshes).To(BeEquivalentTo(1))
+	})
+
+	It("Should not lock the directory while listing tenants", func() {
+		lister.listing = func() {
+			done := make(chan struct{})
+			go func() {
+				directory.Stats()
+				close(done)
+			}()
+			Eventually(done).Should(BeClosed())
+		}
+		names, err := directory.lookup([]string{"t1"}, false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names).To(Equal(map[string]string{"t1": "demo"}))
+	})
+
+	It("Should list tenants again after refresh interval or for unknown tenants", func() {
+		directory.lookup([]string{"t1"}, false)
+		lister.tenants["t3"] = "new"
+
+		now = now.Add(5 * time.Second)
+		names, _ := directory.lookup([]string{"t3"}, false)
+		Expect(names).To(BeEmpty())
+		Expect(lister.calls).To(Equal(1))
+
+		now = now.Add(10 * time.Second)
+		names, _ = directory.lookup([]string{"t3"}, false)
+		Expect(names).To(HaveKeyWithValue("t3", "new"))
+		Expect(lister.calls).To(Equal(2))
+
+		now = now.Add(time.Minute)
+		directory.lookup([]string{"t1"}, false)
+		Expect(lister.calls).To(Equal(3))
+	})
+
+	It("Should keep tenants listed before if listing fails", func() {
+		lister.err = fmt.Errorf("keystone is down")
+		_, err := directory.lookup([]string{"t1"}, false)
+		Expect(err).To(MatchError("keystone is down"))
+
+		lister.err = nil
+		directory.lookup([]string{"t1"}, false)
+		lister.err = fmt.Errorf("keystone is down")
+		now = now.Add(2 * time.Minute)
+		names, err := directory.lookup([]string{"t1"}, false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names).To(HaveKeyWithValue("t1", "demo"))
+	})
+
+	It("Should list tenants again after flush", func() {
+		directory.lookup([]string{"t1"}, false)
+		directory.flush()
+		Expect(directory.tenants()).To(BeEmpty())
+		directory.lookup([]string{"t1"}, false)
+		Expect(lister.calls).To(Equal(2))
+	})
+})
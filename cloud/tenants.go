@@ -0,0 +1,66 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"fmt"
+	"sync"
+)
+
+//knownTenants maps IDs to names of tenants configured or learned from verified credentials,
+//for identity services without tenant directory
+type knownTenants struct {
+	mutex   sync.RWMutex
+	tenants map[string]string
+}
+
+func newKnownTenants(tenants map[string]string) *knownTenants {
+	known := &knownTenants{tenants: map[string]string{}}
+	for tenantID, tenantName := range tenants {
+		known.tenants[tenantID] = tenantName
+	}
+	return known
+}
+
+//learn records name of the tenant
+func (known *knownTenants) learn(tenantID, tenantName string) {
+	if tenantID == "" || tenantName == "" {
+		return
+	}
+	known.mutex.Lock()
+	defer known.mutex.Unlock()
+	known.tenants[tenantID] = tenantName
+}
+
+func (known *knownTenants) tenantID(tenantName string) (string, error) {
+	known.mutex.RLock()
+	defer known.mutex.RUnlock()
+	for tenantID, name := range known.tenants {
+		if name == tenantName {
+			return tenantID, nil
+		}
+	}
+	return "", fmt.Errorf("Tenant with name '%s' not found", tenantName)
+}
+
+func (known *knownTenants) tenantName(tenantID string) (string, error) {
+	known.mutex.RLock()
+	defer known.mutex.RUnlock()
+	if tenantName, ok := known.tenants[tenantID]; ok {
+		return tenantName, nil
+	}
+	return "", fmt.Errorf("Tenant with ID '%s' not found", tenantID)
+}
@@ -0,0 +1,352 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/cloudwan/gohan/schema"
+	"github.com/rackspace/gophercloud"
+)
+
+//errInvalidToken is returned when keystone rejects the token
+var errInvalidToken = fmt.Errorf("Invalid token")
+
+//verificationError returns errInvalidToken if keystone rejected the token,
+//so that only rejected tokens are cached as invalid
+func verificationError(err error) error {
+	if responseErr, ok := err.(*gophercloud.UnexpectedResponseCodeError); ok {
+		if responseErr.Actual == http.StatusNotFound || responseErr.Actual == http.StatusUnauthorized {
+			return errInvalidToken
+		}
+	}
+	return fmt.Errorf("Failed to verify token: %s", err)
+}
+
+//verifiedToken is authorization of a valid token with details needed for caching it
+type verifiedToken struct {
+	auth      schema.Authorization
+	expiresAt time.Time
+	issuedAt  time.Time
+	auditIDs  []string
+}
+
+//tokenVerifier is implemented by keystone clients returning details of verified tokens
+type tokenVerifier interface {
+	verifyToken(token string) (*verifiedToken, error)
+}
+
+//revocationEvent describes tokens revoked by keystone
+//Empty fields match any token
+type revocationEvent struct {
+	UserID       string
+	ProjectID    string
+	AuditID      string
+	IssuedBefore time.Time
+}
+
+//revocationLister is implemented by keystone clients listing revocation events
+type revocationLister interface {
+	listRevocations(since time.Time) ([]revocationEvent, error)
+}
+
+func parseTokenTime(raw interface{}) time.Time {
+	value, _ := raw.(string)
+	parsed, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
+
+func auditIDs(raw interface{}) []string {
+	ids := []string{}
+	rawIDs, _ := raw.([]interface{})
+	for _, id := range rawIDs {
+		ids = append(ids, fmt.Sprint(id))
+	}
+	return ids
+}
+
+//listRevocations lists revocation events of keystone v3 since given time
+func (client *keystoneV3Client) listRevocations(since time.Time) ([]revocationEvent, error) {
+	var result map[string]interface{}
+	eventsURL := client.client.ServiceURL("OS-REVOKE", "events") + "?since=" + url.QueryEscape(since.UTC().Format(time.RFC3339))
+	_, err := client.client.Get(eventsURL, &result, nil)
+	if err != nil {
+		return nil, err
+	}
+	events := []revocationEvent{}
+	rawEvents, _ := result["events"].([]interface{})
+	for _, rawEvent := range rawEvents {
+		event, _ := rawEvent.(map[string]interface{})
+		revocation := revocationEvent{IssuedBefore: parseTokenTime(event["issued_before"])}
+		revocation.UserID, _ = event["user_id"].(string)
+		revocation.ProjectID, _ = event["project_id"].(string)
+		revocation.AuditID, _ = event["audit_id"].(string)
+		if revocation.AuditID == "" {
+			revocation.AuditID, _ = event["audit_chain_id"].(string)
+		}
+		events = append(events, revocation)
+	}
+	return events, nil
+}
+
+//TokenCacheConfig configures caching of verified tokens
+type TokenCacheConfig struct {
+	//Size is the maximum number of cached tokens
+	Size int
+	//TTL is the maximum time valid tokens are cached, shortened to token expiry
+	TTL time.Duration
+	//NegativeTTL is the time tokens rejected by keystone are cached, 0 disables caching them
+	NegativeTTL time.Duration
+	//RevocationInterval is the interval of polling revocation events, 0 disables polling
+	RevocationInterval time.Duration
+}
+
+//TokenCacheStats are counters of token cache
+type TokenCacheStats struct {
+	Size         int    `json:"size"`
+	Hits         uint64 `json:"hits"`
+	NegativeHits uint64 `json:"negative_hits"`
+	Misses       uint64 `json:"misses"`
+	Evictions    uint64 `json:"evictions"`
+	Revocations  uint64 `json:"revocations"`
+}
+
+//HitRate returns ratio of requests served from cache
+func (stats TokenCacheStats) HitRate() float64 {
+	hits := stats.Hits + stats.NegativeHits
+	if hits+stats.Misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+stats.Misses)
+}
+
+type tokenCacheEntry struct {
+	token     string
+	verified  *verifiedToken
+	expiresAt time.Time
+}
+
+//tokenCache is a least recently used cache of verified and rejected tokens
+type tokenCache struct {
+	config  TokenCacheConfig
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	stats   TokenCacheStats
+	now     func() time.Time
+	stop    chan struct{}
+}
+
+func newTokenCache(config TokenCacheConfig) *tokenCache {
+	return &tokenCache{
+		config:  config,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+//get returns cached entry of token, which has nil verified token if the token was rejected
+func (cache *tokenCache) get(token string) (*tokenCacheEntry, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	element, ok := cache.entries[token]
+	if !ok {
+		cache.stats.Misses++
+		return nil, false
+	}
+	entry := element.Value.(*tokenCacheEntry)
+	if !cache.now().Before(entry.expiresAt) {
+		cache.remove(element)
+		cache.stats.Misses++
+		return nil, false
+	}
+	cache.order.MoveToFront(element)
+	if entry.verified == nil {
+		cache.stats.NegativeHits++
+	} else {
+		cache.stats.Hits++
+	}
+	return entry, true
+}
+
+func (cache *tokenCache) put(token string, verified *verifiedToken) {
+	ttl := cache.config.TTL
+	if verified == nil {
+		ttl = cache.config.NegativeTTL
+	}
+	if ttl <= 0 || cache.config.Size <= 0 {
+		return
+	}
+	expiresAt := cache.now().Add(ttl)
+	if verified != nil && !verified.expiresAt.IsZero() && verified.expiresAt.Before(expiresAt) {
+		expiresAt = verified.expiresAt
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if element, ok := cache.entries[token]; ok {
+		cache.remove(element)
+	}
+	cache.entries[token] = cache.order.PushFront(&tokenCacheEntry{token: token, verified: verified, expiresAt: expiresAt})
+	for cache.order.Len() > cache.config.Size {
+		cache.remove(cache.order.Back())
+		cache.stats.Evictions++
+	}
+}
+
+func (cache *tokenCache) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.entries, element.Value.(*tokenCacheEntry).token)
+}
+
+//verify returns authorization of cached token, or verifies it by client and caches the result
+func (cache *tokenCache) verify(token string, client KeystoneClient) (schema.Authorization, error) {
+	if entry, ok := cache.get(token); ok {
+		if entry.verified == nil {
+			return nil, errInvalidToken
+		}
+		return entry.verified.auth, nil
+	}
+	var verified *verifiedToken
+	var err error
+	if verifier, ok := client.(tokenVerifier); ok {
+		verified, err = verifier.verifyToken(token)
+	} else {
+		var auth schema.Authorization
+		auth, err = client.VerifyToken(token)
+		verified = &verifiedToken{auth: auth}
+	}
+	if err == errInvalidToken {
+		cache.put(token, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cache.put(token, verified)
+	return verified.auth, nil
+}
+
+//revoke removes cached tokens matching revocation events
+func (cache *tokenCache) revoke(events []revocationEvent) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for element := cache.order.Front(); element != nil; {
+		next := element.Next()
+		entry := element.Value.(*tokenCacheEntry)
+		for _, event := range events {
+			if entry.verified != nil && event.matches(entry.verified) {
+				cache.remove(element)
+				cache.stats.Revocations++
+				break
+			}
+		}
+		element = next
+	}
+}
+
+func (event *revocationEvent) matches(verified *verifiedToken) bool {
+	if !event.IssuedBefore.IsZero() && !verified.issuedAt.IsZero() && !verified.issuedAt.Before(event.IssuedBefore) {
+		return false
+	}
+	if event.UserID != "" && event.UserID != verified.auth.UserID() {
+		return false
+	}
+	if event.ProjectID != "" && event.ProjectID != verified.auth.TenantID() {
+		return false
+	}
+	if event.AuditID != "" {
+		for _, auditID := range verified.auditIDs {
+			if auditID == event.AuditID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+//pollRevocations removes revoked tokens from cache until the cache is stopped
+func (cache *tokenCache) pollRevocations(lister revocationLister) {
+	interval := cache.config.RevocationInterval
+	since := cache.now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cache.stop:
+			return
+		case <-ticker.C:
+		}
+		polledAt := cache.now()
+		events, err := lister.listRevocations(since.Add(-interval))
+		if err != nil {
+			log.Warning("Failed to list token revocations: %s", err)
+			continue
+		}
+		cache.revoke(events)
+		since = polledAt
+		stats := cache.Stats()
+		log.Debug("Token cache: size %d, hit rate %.2f, revoked %d", stats.Size, stats.HitRate(), stats.Revocations)
+	}
+}
+
+//Stats returns counters of the cache
+func (cache *tokenCache) Stats() TokenCacheStats {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	stats := cache.stats
+	stats.Size = cache.order.Len()
+	return stats
+}
+
+//EnableTokenCache caches verified tokens of the identity
+func (identity *KeystoneIdentity) EnableTokenCache(config TokenCacheConfig) {
+	identity.StopTokenCache()
+	cache := newTokenCache(config)
+	if config.RevocationInterval > 0 {
+		if lister, ok := identity.Client.(revocationLister); ok {
+			cache.stop = make(chan struct{})
+			go cache.pollRevocations(lister)
+		} else {
+			log.Warning("Polling token revocations is supported only by keystone v3")
+		}
+	}
+	identity.cache = cache
+}
+
+//StopTokenCache stops caching tokens and polling revocations
+func (identity *KeystoneIdentity) StopTokenCache() {
+	if identity.cache != nil && identity.cache.stop != nil {
+		close(identity.cache.stop)
+	}
+	identity.cache = nil
+}
+
+//TokenCacheStats returns counters of token cache, which are zero if cache isn't enabled
+func (identity *KeystoneIdentity) TokenCacheStats() TokenCacheStats {
+	if identity.cache == nil {
+		return TokenCacheStats{}
+	}
+	return identity.cache.Stats()
+}
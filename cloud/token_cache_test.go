@@ -0,0 +1,166 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudwan/gohan/schema"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//countingClient verifies tokens registered in it and counts verifications
+type countingClient struct {
+	tokens        map[string]*verifiedToken
+	verifications int
+	unavailable   bool
+}
+
+func (client *countingClient) verifyToken(token string) (*verifiedToken, error) {
+	client.verifications++
+	if client.unavailable {
+		return nil, fmt.Errorf("Failed to verify token: connection refused")
+	}
+	verified, ok := client.tokens[token]
+	if !ok {
+		return nil, errInvalidToken
+	}
+	return verified, nil
+}
+
+func (client *countingClient) VerifyToken(token string) (schema.Authorization, error) {
+	verified, err := client.verifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return verified.auth, nil
+}
+
+func (client *countingClient) GetTenantID(string) (string, error)   { return "", nil }
+func (client *countingClient) GetTenantName(string) (string, error) { return "", nil }
+func (client *countingClient) GetServiceAuthorization() (schema.Authorization, error) {
+	return nil, nil
+}
+
+var _ = Describe("Token cache", func() {
+	var (
+		now      time.Time
+		client   *countingClient
+		identity *KeystoneIdentity
+	)
+
+	newToken := func(userID, tenantID string, expiresIn time.Duration, auditID string) *verifiedToken {
+		return &verifiedToken{
+			auth:      schema.NewUserAuthorization(tenantID, "", "", userID, []string{"_member_"}, nil, nil),
+			issuedAt:  now.Add(-time.Minute),
+			expiresAt: now.Add(expiresIn),
+			auditIDs:  []string{auditID},
+		}
+	}
+
+	advance := func(duration time.Duration) {
+		now = now.Add(duration)
+	}
+
+	BeforeEach(func() {
+		now = time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+		client = &countingClient{tokens: map[string]*verifiedToken{
+			"alice_token": newToken("alice", "tenant1", time.Hour, "audit1"),
+			"bob_token":   newToken("bob", "tenant1", time.Hour, "audit2"),
+			"carol_token": newToken("carol", "tenant2", 30*time.Second, "audit3"),
+		}}
+		identity = &KeystoneIdentity{Client: client}
+		identity.EnableTokenCache(TokenCacheConfig{Size: 2, TTL: 5 * time.Minute, NegativeTTL: 10 * time.Second})
+		identity.cache.now = func() time.Time { return now }
+	})
+
+	It("Should serve verified tokens from cache until TTL", func() {
+		for i := 0; i < 3; i++ {
+			auth, err := identity.VerifyToken("alice_token")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(auth.UserID()).To(Equal("alice"))
+		}
+		Expect(client.verifications).To(Equal(1))
+		advance(5 * time.Minute)
+		_, err := identity.VerifyToken("alice_token")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client.verifications).To(Equal(2))
+
+		stats := identity.TokenCacheStats()
+		Expect(stats.Hits).To(Equal(uint64(2)))
+		Expect(stats.Misses).To(Equal(uint64(2)))
+		Expect(stats.HitRate()).To(Equal(0.5))
+	})
+
+	It("Should honour token expiry", func() {
+		identity.VerifyToken("carol_token")
+		advance(30 * time.Second)
+		identity.VerifyToken("carol_token")
+		Expect(client.verifications).To(Equal(2))
+	})
+
+	It("Should cache invalid tokens only for negative TTL", func() {
+		_, err := identity.VerifyToken("wrong_token")
+		Expect(err).To(MatchError("Invalid token"))
+		_, err = identity.VerifyToken("wrong_token")
+		Expect(err).To(MatchError("Invalid token"))
+		Expect(client.verifications).To(Equal(1))
+		Expect(identity.TokenCacheStats().NegativeHits).To(Equal(uint64(1)))
+		advance(10 * time.Second)
+		identity.VerifyToken("wrong_token")
+		Expect(client.verifications).To(Equal(2))
+	})
+
+	It("Should not cache failures of keystone", func() {
+		client.unavailable = true
+		identity.VerifyToken("alice_token")
+		_, err := identity.VerifyToken("alice_token")
+		Expect(err).To(MatchError("Failed to verify token: connection refused"))
+		Expect(client.verifications).To(Equal(2))
+	})
+
+	It("Should evict least recently used tokens", func() {
+		identity.VerifyToken("alice_token")
+		identity.VerifyToken("bob_token")
+		identity.VerifyToken("alice_token")
+		identity.VerifyToken("carol_token")
+		Expect(identity.TokenCacheStats().Evictions).To(Equal(uint64(1)))
+		Expect(identity.TokenCacheStats().Size).To(Equal(2))
+		identity.VerifyToken("alice_token")
+		Expect(client.verifications).To(Equal(3))
+		identity.VerifyToken("bob_token")
+		Expect(client.verifications).To(Equal(4))
+	})
+
+	It("Should remove revoked tokens", func() {
+		identity.VerifyToken("alice_token")
+		identity.VerifyToken("bob_token")
+		identity.cache.revoke([]revocationEvent{
+			{AuditID: "audit1", IssuedBefore: now},
+			{UserID: "bob", IssuedBefore: now.Add(-time.Hour)},
+		})
+		Expect(identity.TokenCacheStats().Revocations).To(Equal(uint64(1)))
+		identity.VerifyToken("bob_token")
+		Expect(client.verifications).To(Equal(2))
+		identity.VerifyToken("alice_token")
+		Expect(client.verifications).To(Equal(3))
+
+		identity.cache.revoke([]revocationEvent{{ProjectID: "tenant1", IssuedBefore: now}})
+		Expect(identity.TokenCacheStats().Size).To(Equal(0))
+	})
+})
@@ -33,6 +33,7 @@ type DB interface {
 	Connect(string, string) error
 	Begin() (transaction.Transaction, error)
 	RegisterTable(*schema.Schema, bool) error
+	AddColumns(map[*schema.Schema][]schema.Property) error
 	DropTable(*schema.Schema) error
 }
 
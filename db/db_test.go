@@ -16,8 +16,13 @@
 package db
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 
+	"github.com/cloudwan/gohan/db/pagination"
+	"github.com/cloudwan/gohan/db/sql"
+	"github.com/cloudwan/gohan/db/transaction"
 	"github.com/cloudwan/gohan/schema"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -29,6 +34,22 @@ func makePluralKey(resource *schema.Resource) string {
 	return key
 }
 
+//recordingTransaction records updates and deletes made through it
+type recordingTransaction struct {
+	transaction.Transaction
+	changes []string
+}
+
+func (rt *recordingTransaction) Update(resource *schema.Resource) error {
+	rt.changes = append(rt.changes, "update "+resource.ID())
+	return rt.Transaction.Update(resource)
+}
+
+func (rt *recordingTransaction) Delete(s *schema.Schema, resourceID interface{}) error {
+	rt.changes = append(rt.changes, "delete "+fmt.Sprint(resourceID))
+	return rt.Transaction.Delete(s, resourceID)
+}
+
 var _ = Describe("Database operation test", func() {
 	var conn, dbType string
 	if os.Getenv("MYSQL_TEST") == "true" {
@@ -193,6 +214,380 @@ var _ = Describe("Database operation test", func() {
 			tx.Commit()
 		})
 	})
+	Describe("Many to many relation", func() {
+		var securityGroupSchema, portSchema *schema.Schema
+
+		BeforeEach(func() {
+			manager := schema.GetManager()
+			Expect(manager.LoadSchemasFromFiles("test_data/many_to_many.yaml")).To(Succeed())
+			securityGroupSchema, _ = manager.Schema("security_group")
+			portSchema, _ = manager.Schema("port")
+		})
+
+		AfterEach(func() {
+			os.Remove("test_data/many_to_many_db.yaml")
+		})
+
+		for _, backend := range [][]string{{dbType, conn}, {"yaml", "test_data/many_to_many_db.yaml"}} {
+			dbType, conn := backend[0], backend[1]
+			It("should keep list of related IDs on "+dbType, func() {
+				manager := schema.GetManager()
+				Expect(InitDBWithSchemas(dbType, conn, true, false)).To(Succeed())
+				db, err := ConnectDB(dbType, conn)
+				Expect(err).ToNot(HaveOccurred())
+
+				tx, err := db.Begin()
+				Expect(err).ToNot(HaveOccurred())
+				for _, id := range []string{"web", "ssh"} {
+					securityGroup, _ := manager.LoadResource("security_group", map[string]interface{}{"id": id, "name": id})
+					Expect(tx.Create(securityGroup)).To(Succeed())
+				}
+				port, _ := manager.LoadResource("port", map[string]interface{}{
+					"id": "port1", "name": "port1", "security_groups": []interface{}{"web", "ssh"}})
+				Expect(tx.Create(port)).To(Succeed())
+				other, _ := manager.LoadResource("port", map[string]interface{}{"id": "port2", "name": "port2"})
+				Expect(tx.Create(other)).To(Succeed())
+				invalid, _ := manager.LoadResource("port", map[string]interface{}{
+					"id": "port3", "name": "port3", "security_groups": []interface{}{"unknown"}})
+				Expect(tx.Create(invalid)).To(MatchError("Related security_group unknown not found"))
+				Expect(tx.Commit()).To(Succeed())
+
+				tx, err = db.Begin()
+				Expect(err).ToNot(HaveOccurred())
+				fetched, err := tx.Fetch(portSchema, "port1", nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(schema.RelatedIDs(fetched.Get("security_groups"))).To(ConsistOf("web", "ssh"))
+				fetched, err = tx.Fetch(portSchema, "port2", nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fetched.Get("security_groups")).To(BeEmpty())
+
+				list, total, err := tx.List(portSchema, map[string]interface{}{"security_groups": []string{"ssh"}}, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(total).To(Equal(uint64(1)))
+				Expect(list[0].ID()).To(Equal("port1"))
+
+				Expect(tx.Delete(securityGroupSchema, "ssh")).To(MatchError(
+					"security_group ssh is referred by security_groups of 1 ports"))
+
+				port.Data()["security_groups"] = []interface{}{"web"}
+				Expect(tx.Update(port)).To(Succeed())
+				Expect(tx.Delete(securityGroupSchema, "ssh")).To(Succeed())
+				Expect(tx.Delete(portSchema, "port1")).To(Succeed())
+				Expect(tx.Delete(securityGroupSchema, "web")).To(Succeed())
+				Expect(tx.Commit()).To(Succeed())
+			})
+		}
+	})
+
+	Describe("On delete of relation", func() {
+		BeforeEach(func() {
+			Expect(schema.GetManager().LoadSchemasFromFiles("test_data/on_delete.yaml")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.Remove("test_data/on_delete_db.yaml")
+		})
+
+		It("should be declared in table definition", func() {
+			portSchema, _ := schema.GetManager().Schema("port")
+			Expect(sql.NewDB().GenTableDef(portSchema, false)).To(ContainSubstring(
+				"foreign key(`network_id`) REFERENCES `networks`(id) on delete cascade"))
+			floatingIPSchema, _ := schema.GetManager().Schema("floating_ip")
+			Expect(sql.NewDB().GenTableDef(floatingIPSchema, true)).To(ContainSubstring(
+				"foreign key(`port_id`) REFERENCES `ports`(id) on delete set null"))
+		})
+
+		for _, backend := range [][]string{{dbType, conn}, {"yaml", "test_data/on_delete_db.yaml"}} {
+			dbType, conn := backend[0], backend[1]
+			It("should cascade, restrict or set null on "+dbType, func() {
+				manager := schema.GetManager()
+				Expect(InitDBWithSchemas(dbType, conn, true, false)).To(Succeed())
+				db, err := ConnectDB(dbType, conn)
+				Expect(err).ToNot(HaveOccurred())
+				networkSchema, _ := manager.Schema("network")
+				portSchema, _ := manager.Schema("port")
+				floatingIPSchema, _ := manager.Schema("floating_ip")
+				routerInterfaceSchema, _ := manager.Schema("router_interface")
+
+				tx, err := db.Begin()
+				Expect(err).ToNot(HaveOccurred())
+				create := func(schemaID string, data map[string]interface{}) {
+					resource, err := manager.LoadResource(schemaID, data)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(tx.Create(resource)).To(Succeed())
+				}
+				create("network", map[string]interface{}{"id": "net1"})
+				create("network", map[string]interface{}{"id": "net2"})
+				create("port", map[string]interface{}{"id": "port1", "network_id": "net1"})
+				create("floating_ip", map[string]interface{}{"id": "fip1", "port_id": "port1"})
+				create("router_interface", map[string]interface{}{"id": "ri1", "network_id": "net2"})
+
+				Expect(tx.Delete(networkSchema, "net1")).To(Succeed())
+				ports, _, err := tx.List(portSchema, nil, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ports).To(BeEmpty())
+				floatingIP, err := tx.Fetch(floatingIPSchema, "fip1", nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(floatingIP.Get("port_id")).To(BeNil())
+
+				Expect(tx.Delete(networkSchema, "net2")).To(MatchError(
+					"network net2 is referred by network_id of 1 router_interfaces"))
+				Expect(tx.Delete(routerInterfaceSchema, "ri1")).To(Succeed())
+				Expect(tx.Delete(networkSchema, "net2")).To(Succeed())
+				Expect(tx.Commit()).To(Succeed())
+			})
+
+			It("should change referring resources through wrapping transaction on "+dbType, func() {
+				manager := schema.GetManager()
+				Expect(InitDBWithSchemas(dbType, conn, true, false)).To(Succeed())
+				db, err := ConnectDB(dbType, conn)
+				Expect(err).ToNot(HaveOccurred())
+				networkSchema, _ := manager.Schema("network")
+				segmentSchema, _ := manager.Schema("segment")
+
+				tx, err := db.Begin()
+				Expect(err).ToNot(HaveOccurred())
+				wrapped := &recordingTransaction{Transaction: tx}
+				transaction.Wrap(tx, wrapped)
+				create := func(schemaID string, data map[string]interface{}) *schema.Resource {
+					resource, err := manager.LoadResource(schemaID, data)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(tx.Create(resource)).To(Succeed())
+					return resource
+				}
+				create("network", map[string]interface{}{"id": "net1"})
+				create("port", map[string]interface{}{"id": "port1", "network_id": "net1"})
+				create("floating_ip", map[string]interface{}{"id": "fip1", "port_id": "port1"})
+
+				Expect(wrapped.Delete(networkSchema, "net1")).To(Succeed())
+				Expect(wrapped.changes).To(Equal([]string{"delete net1", "delete port1", "update fip1"}))
+
+				segment1 := create("segment", map[string]interface{}{"id": "segment1"})
+				create("segment", map[string]interface{}{"id": "segment2", "next_id": "segment1"})
+				segment1.Data()["next_id"] = "segment2"
+				Expect(tx.Update(segment1)).To(Succeed())
+				wrapped.changes = nil
+
+				Expect(wrapped.Delete(segmentSchema, "segment1")).To(Succeed())
+				Expect(wrapped.changes).To(Equal([]string{"delete segment1", "delete segment2"}))
+				segments, _, err := tx.List(segmentSchema, nil, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(segments).To(BeEmpty())
+				Expect(tx.Commit()).To(Succeed())
+			})
+		}
+	})
+
+	Describe("Resource tags", func() {
+		var serverSchema *schema.Schema
+
+		BeforeEach(func() {
+			manager := schema.GetManager()
+			Expect(manager.LoadSchemasFromFiles("test_data/tags.yaml")).To(Succeed())
+			serverSchema, _ = manager.Schema("server")
+		})
+
+		AfterEach(func() {
+			os.Remove("test_data/tags_db.yaml")
+		})
+
+		It("should be stored in a separate table", func() {
+			Expect(sql.NewDB().GenTableDef(serverSchema, false)).ToNot(ContainSubstring("`tags`"))
+			Expect(sql.NewDB().GenTagTableDef(serverSchema)).To(ContainSubstring("create table `servers_tags`"))
+		})
+
+		for _, backend := range [][]string{{dbType, conn}, {"yaml", "test_data/tags_db.yaml"}} {
+			dbType, conn := backend[0], backend[1]
+			It("should keep and filter tags on "+dbType, func() {
+				manager := schema.GetManager()
+				Expect(InitDBWithSchemas(dbType, conn, true, false)).To(Succeed())
+				db, err := ConnectDB(dbType, conn)
+				Expect(err).ToNot(HaveOccurred())
+
+				tx, err := db.Begin()
+				Expect(err).ToNot(HaveOccurred())
+				web, _ := manager.LoadResource("server", map[string]interface{}{
+					"id": "web", "name": "web", "tags": map[string]interface{}{"env": "prod", "role": "web"}})
+				Expect(tx.Create(web)).To(Succeed())
+				db1, _ := manager.LoadResource("server", map[string]interface{}{
+					"id": "db", "name": "db", "tags": map[string]interface{}{"env": "dev"}})
+				Expect(tx.Create(db1)).To(Succeed())
+				untagged, _ := manager.LoadResource("server", map[string]interface{}{"id": "untagged", "name": "untagged"})
+				Expect(tx.Create(untagged)).To(Succeed())
+				Expect(tx.Commit()).To(Succeed())
+
+				tx, err = db.Begin()
+				Expect(err).ToNot(HaveOccurred())
+				fetched, err := tx.Fetch(serverSchema, "web", nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(schema.TagsMap(fetched.Get("tags"))).To(Equal(map[string]string{"env": "prod", "role": "web"}))
+				fetched, err = tx.Fetch(serverSchema, "untagged", nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fetched.Get("tags")).To(BeEmpty())
+
+				list, total, err := tx.List(serverSchema, map[string]interface{}{"tags": []string{"env:prod"}}, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(total).To(Equal(uint64(1)))
+				Expect(list[0].ID()).To(Equal("web"))
+				list, _, err = tx.List(serverSchema, map[string]interface{}{"tags": []string{"env"}}, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(list).To(HaveLen(2))
+				list, _, err = tx.List(serverSchema, map[string]interface{}{"tags": []string{"env:dev", "role"}}, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(list).To(BeEmpty())
+
+				web.Data()["tags"] = map[string]interface{}{"env": "dev"}
+				Expect(tx.Update(web)).To(Succeed())
+				list, _, err = tx.List(serverSchema, map[string]interface{}{"tags": []string{"env:dev"}}, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(list).To(HaveLen(2))
+				Expect(tx.Delete(serverSchema, "web")).To(Succeed())
+				Expect(tx.Commit()).To(Succeed())
+			})
+
+			It("should filter by policy conditions on "+dbType, func() {
+				manager := schema.GetManager()
+				Expect(InitDBWithSchemas(dbType, conn, true, false)).To(Succeed())
+				db, err := ConnectDB(dbType, conn)
+				Expect(err).ToNot(HaveOccurred())
+
+				tx, err := db.Begin()
+				Expect(err).ToNot(HaveOccurred())
+				for _, name := range []string{"alpha", "beta", "gamma"} {
+					server, _ := manager.LoadResource("server", map[string]interface{}{"id": name, "name": name})
+					Expect(tx.Create(server)).To(Succeed())
+				}
+				Expect(tx.Commit()).To(Succeed())
+
+				tx, err = db.Begin()
+				Expect(err).ToNot(HaveOccurred())
+				defer tx.Close()
+				listConditions := func(comparisons ...schema.Comparison) []string {
+					list, _, err := tx.List(serverSchema, map[string]interface{}{schema.ConditionsFilterKey: comparisons}, nil)
+					Expect(err).ToNot(HaveOccurred())
+					ids := []string{}
+					for _, resource := range list {
+						ids = append(ids, resource.ID())
+					}
+					return ids
+				}
+				Expect(listConditions(schema.Comparison{Property: "name", Operator: schema.OperatorEq, Value: "beta"})).To(
+					ConsistOf("beta"))
+				Expect(listConditions(schema.Comparison{Property: "name", Operator: schema.OperatorNe, Value: "beta"})).To(
+					ConsistOf("alpha", "gamma"))
+				Expect(listConditions(schema.Comparison{Property: "name", Operator: schema.OperatorGt, Value: "alpha"})).To(
+					ConsistOf("beta", "gamma"))
+				Expect(listConditions(
+					schema.Comparison{Property: "name", Operator: schema.OperatorIn, Value: []interface{}{"alpha", "gamma"}},
+					schema.Comparison{Property: "name", Operator: schema.OperatorLe, Value: "beta"})).To(
+					ConsistOf("alpha"))
+				Expect(listConditions(schema.Comparison{Property: "missing", Operator: schema.OperatorEq, Value: "beta"})).To(
+					BeEmpty())
+				Expect(listConditions(schema.Comparison{Property: "name", Operator: schema.OperatorGt, Value: 1})).To(
+					BeEmpty())
+
+				listExclusions := func(exclusions ...[]schema.Comparison) []string {
+					list, _, err := tx.List(serverSchema, map[string]interface{}{schema.ExclusionsFilterKey: exclusions}, nil)
+					Expect(err).ToNot(HaveOccurred())
+					ids := []string{}
+					for _, resource := range list {
+						ids = append(ids, resource.ID())
+					}
+					return ids
+				}
+				Expect(listExclusions([]schema.Comparison{{Property: "name", Operator: schema.OperatorEq, Value: "beta"}})).To(
+					ConsistOf("alpha", "gamma"))
+				Expect(listExclusions(
+					[]schema.Comparison{
+						{Property: "name", Operator: schema.OperatorGe, Value: "beta"},
+						{Property: "name", Operator: schema.OperatorNe, Value: "gamma"},
+					},
+					[]schema.Comparison{{Property: "name", Operator: schema.OperatorIn, Value: []interface{}{"alpha"}}})).To(
+					ConsistOf("gamma"))
+				Expect(listExclusions([]schema.Comparison{{Property: "missing", Operator: schema.OperatorEq, Value: "beta"}})).To(
+					BeEmpty())
+				Expect(listExclusions([]schema.Comparison{{Property: "tags", Operator: schema.OperatorEq, Value: "beta"}})).To(
+					BeEmpty())
+				Expect(listExclusions(
+					[]schema.Comparison{
+						{Property: "missing", Operator: schema.OperatorEq, Value: "beta"},
+						{Property: "name", Operator: schema.OperatorNe, Value: "beta"},
+					})).To(
+					ConsistOf("beta"))
+			})
+		}
+	})
+
+	Describe("Computed properties", func() {
+		var serverSchema *schema.Schema
+
+		BeforeEach(func() {
+			manager := schema.GetManager()
+			Expect(manager.LoadSchemasFromFiles("test_data/computed.yaml")).To(Succeed())
+			serverSchema, _ = manager.Schema("server")
+		})
+
+		AfterEach(func() {
+			os.Remove("test_data/computed_db.yaml")
+		})
+
+		It("should not be columns", func() {
+			Expect(sql.NewDB().GenTableDef(serverSchema, false)).ToNot(ContainSubstring("`owner`"))
+		})
+
+		for _, backend := range [][]string{{dbType, conn}, {"yaml", "test_data/computed_db.yaml"}} {
+			dbType, conn := backend[0], backend[1]
+			It("should filter and paginate by computed properties on "+dbType, func() {
+				manager := schema.GetManager()
+				Expect(InitDBWithSchemas(dbType, conn, true, false)).To(Succeed())
+				db, err := ConnectDB(dbType, conn)
+				Expect(err).ToNot(HaveOccurred())
+
+				tx, err := db.Begin()
+				Expect(err).ToNot(HaveOccurred())
+				for _, data := range [][]string{{"a", "red"}, {"b", "red"}, {"c", "blue"}, {"d", "red"}} {
+					server, _ := manager.LoadResource("server", map[string]interface{}{
+						"id": data[0], "name": data[0], "tenant_id": data[1]})
+					Expect(server.PopulateComputed()).To(Succeed())
+					Expect(tx.Create(server)).To(Succeed())
+				}
+				Expect(tx.Commit()).To(Succeed())
+
+				tx, err = db.Begin()
+				Expect(err).ToNot(HaveOccurred())
+				defer tx.Close()
+				fetched, err := tx.Fetch(serverSchema, "c", nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fetched.Get("owner")).To(Equal("blue"))
+
+				list, total, err := tx.List(serverSchema, map[string]interface{}{"owner": "red"}, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(total).To(Equal(uint64(3)))
+				Expect(list).To(HaveLen(3))
+
+				pg, err := pagination.NewPaginator(serverSchema, "id", pagination.DESC, 2, 1)
+				Expect(err).ToNot(HaveOccurred())
+				list, total, err = tx.List(serverSchema, map[string]interface{}{"owner": []string{"red"}}, pg)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(total).To(Equal(uint64(3)))
+				Expect(list).To(HaveLen(2))
+				Expect(list[0].ID()).To(Equal("b"))
+				Expect(list[1].ID()).To(Equal("a"))
+
+				exclusions := [][]schema.Comparison{{{Property: "owner", Operator: schema.OperatorEq, Value: "blue"}}}
+				list, _, err = tx.List(serverSchema, map[string]interface{}{schema.ExclusionsFilterKey: exclusions}, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(list).To(BeEmpty())
+
+				if dbType == "yaml" {
+					stored, err := ioutil.ReadFile(conn)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(string(stored)).ToNot(ContainSubstring("owner"))
+				}
+			})
+		}
+	})
+
 	It("Should convert yaml to sqlite3", func() {
 		manager := schema.GetManager()
 		Expect(manager.LoadSchemasFromFiles("../etc/schema/gohan.json", "test_data/conv_in.yaml")).To(Succeed())
@@ -39,7 +39,9 @@ type DB struct {
 //Transaction is yaml implementation of DB
 //This db backend is intended for development and test purpose only
 type Transaction struct {
-	db *DB
+	db       *DB
+	wrapper  transaction.Transaction
+	deleting map[string]bool
 }
 
 //NewDB constructor
@@ -57,7 +59,8 @@ func (db *DB) Connect(format, conn string) error {
 //Begin connection starts new transaction
 func (db *DB) Begin() (transaction.Transaction, error) {
 	return &Transaction{
-		db: db,
+		db:       db,
+		deleting: map[string]bool{},
 	}, nil
 }
 
@@ -76,6 +79,11 @@ func (db *DB) RegisterTable(s *schema.Schema, cascade bool) error {
 	return nil
 }
 
+//AddColumns adds columns to table definition
+func (db *DB) AddColumns(columns map[*schema.Schema][]schema.Property) error {
+	return nil
+}
+
 //DropTable drop table definition
 func (db *DB) DropTable(s *schema.Schema) error {
 	return nil
@@ -116,7 +124,10 @@ func (tx *Transaction) Create(resource *schema.Resource) error {
 	db := tx.db
 	db.load()
 	s := resource.Schema()
-	data := resource.Data()
+	data := storedData(resource)
+	if err := db.checkRelatedExist(resource); err != nil {
+		return err
+	}
 	table := db.getTable(s)
 	db.data[s.GetDbTableName()] = append(table, data)
 	db.write()
@@ -128,7 +139,10 @@ func (tx *Transaction) Update(resource *schema.Resource) error {
 	db := tx.db
 	db.load()
 	s := resource.Schema()
-	data := resource.Data()
+	data := storedData(resource)
+	if err := db.checkRelatedExist(resource); err != nil {
+		return err
+	}
 	table := db.getTable(s)
 	for _, rawDataInDB := range table {
 		dataInDB := rawDataInDB.(map[string]interface{})
@@ -136,21 +150,59 @@ func (tx *Transaction) Update(resource *schema.Resource) error {
 			for key, value := range data {
 				dataInDB[key] = value
 			}
+			for _, property := range s.Properties {
+				if property.IsComputed() {
+					delete(dataInDB, property.ID)
+				}
+			}
 		}
 	}
 	db.write()
 	return nil
 }
 
+//storedData returns resource data without computed properties, which aren't stored
+func storedData(resource *schema.Resource) map[string]interface{} {
+	data := map[string]interface{}{}
+	for key, value := range resource.Data() {
+		data[key] = value
+	}
+	for _, property := range resource.Schema().Properties {
+		if property.IsComputed() {
+			delete(data, property.ID)
+		}
+	}
+	return data
+}
+
 //StateUpdate update resource state
 func (tx *Transaction) StateUpdate(resource *schema.Resource) error {
 	return tx.Update(resource)
 }
 
+//Wrap makes changes of resources referring deleted resources go through wrapper
+func (tx *Transaction) Wrap(wrapper transaction.Transaction) {
+	tx.wrapper = wrapper
+}
+
+//outer returns the transaction wrapping tx, or tx if it isn't wrapped
+func (tx *Transaction) outer() transaction.Transaction {
+	if tx.wrapper != nil {
+		return tx.wrapper
+	}
+	return tx
+}
+
 //Delete delete resource from db
 func (tx *Transaction) Delete(s *schema.Schema, resourceID interface{}) error {
 	db := tx.db
 	db.load()
+	key := deletingKey(s, resourceID)
+	tx.deleting[key] = true
+	defer delete(tx.deleting, key)
+	if err := tx.applyOnDelete(s, resourceID); err != nil {
+		return err
+	}
 	table := db.getTable(s)
 	newTable := []interface{}{}
 	for _, rawDataInDB := range table {
@@ -164,6 +216,104 @@ func (tx *Transaction) Delete(s *schema.Schema, resourceID interface{}) error {
 	return nil
 }
 
+func (db *DB) hasResource(s *schema.Schema, resourceID interface{}) bool {
+	for _, rawDataInDB := range db.getTable(s) {
+		if rawDataInDB.(map[string]interface{})["id"] == resourceID {
+			return true
+		}
+	}
+	return false
+}
+
+//checkRelatedExist checks if all resources referenced by many to many properties exist
+func (db *DB) checkRelatedExist(resource *schema.Resource) error {
+	manager := schema.GetManager()
+	for _, property := range resource.Schema().Properties {
+		if !property.IsManyToMany() {
+			continue
+		}
+		relatedSchema, ok := manager.Schema(property.Relation)
+		if !ok {
+			return fmt.Errorf("Related schema %s not found", property.Relation)
+		}
+		for _, id := range schema.RelatedIDs(resource.Get(property.ID)) {
+			if !db.hasResource(relatedSchema, id) {
+				return fmt.Errorf("Related %s %s not found", relatedSchema.ID, id)
+			}
+		}
+	}
+	return nil
+}
+
+//deletingKey identifies a resource being deleted
+func deletingKey(s *schema.Schema, resourceID interface{}) string {
+	return s.ID + "/" + fmt.Sprint(resourceID)
+}
+
+//applyOnDelete handles resources referring the deleted resource as set by on_delete of their relation.
+//Many to many relations restrict deletion unless on_delete is cascade.
+//Referring resources are updated and deleted through the wrapping transaction, skipping resources
+//already being deleted, which refer the resource by a cycle of relations.
+func (tx *Transaction) applyOnDelete(s *schema.Schema, resourceID interface{}) error {
+	db := tx.db
+	id := fmt.Sprint(resourceID)
+	for _, reference := range schema.GetManager().RelationsTo(s.ID) {
+		property := reference.Property
+		referring := []map[string]interface{}{}
+		for _, rawDataInDB := range db.getTable(reference.Schema) {
+			dataInDB := rawDataInDB.(map[string]interface{})
+			if property.IsManyToMany() && stringInSlice(id, schema.RelatedIDs(dataInDB[property.ID])) ||
+				!property.IsManyToMany() && dataInDB[property.ID] != nil && fmt.Sprint(dataInDB[property.ID]) == id {
+				referring = append(referring, dataInDB)
+			}
+		}
+		if len(referring) == 0 {
+			continue
+		}
+		switch {
+		case property.OnDelete == schema.OnDeleteRestrict || (property.IsManyToMany() && property.OnDelete != schema.OnDeleteCascade):
+			return fmt.Errorf("%s %s is referred by %s of %d %s", s.ID, resourceID, property.ID, len(referring), reference.Schema.Plural)
+		case property.IsManyToMany():
+			for _, dataInDB := range referring {
+				ids := []interface{}{}
+				for _, relatedID := range schema.RelatedIDs(dataInDB[property.ID]) {
+					if relatedID != id {
+						ids = append(ids, relatedID)
+					}
+				}
+				dataInDB[property.ID] = ids
+			}
+			if err := db.write(); err != nil {
+				return err
+			}
+		case property.OnDelete == schema.OnDeleteSetNull:
+			for _, dataInDB := range referring {
+				if tx.deleting[deletingKey(reference.Schema, dataInDB["id"])] {
+					continue
+				}
+				resource, err := tx.outer().Fetch(reference.Schema, dataInDB["id"], nil)
+				if err != nil {
+					return err
+				}
+				resource.Data()[property.ID] = nil
+				if err := tx.outer().Update(resource); err != nil {
+					return err
+				}
+			}
+		case property.OnDelete == schema.OnDeleteCascade:
+			for _, dataInDB := range referring {
+				if tx.deleting[deletingKey(reference.Schema, dataInDB["id"])] {
+					continue
+				}
+				if err := tx.outer().Delete(reference.Schema, dataInDB["id"]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
 type byPaginator struct {
 	data []*schema.Resource
 	pg   *pagination.Paginator
@@ -204,23 +354,75 @@ func (tx *Transaction) List(s *schema.Schema, filter map[string]interface{}, pg
 	db.load()
 	table := db.getTable(s)
 	for _, rawData := range table {
-		data := rawData.(map[string]interface{})
+		//Computed values are populated in a copy, so they aren't stored in the table
+		data := map[string]interface{}{}
+		for key, value := range rawData.(map[string]interface{}) {
+			data[key] = value
+		}
 		var resource *schema.Resource
 		resource, err = schema.NewResource(s, data)
 		if err != nil {
 			log.Warning("%s %s", resource, err)
 			return
 		}
+		err = resource.PopulateComputed()
+		if err != nil {
+			return
+		}
+		for _, property := range s.Properties {
+			if _, ok := data[property.ID]; !ok && property.IsManyToMany() {
+				data[property.ID] = []interface{}{}
+			}
+		}
+		if _, ok := data[schema.TagsPropertyID]; !ok && s.Tagging {
+			data[schema.TagsPropertyID] = map[string]interface{}{}
+		}
 		valid := true
 		if filter != nil {
 			for key, value := range filter {
-				if data[key] == nil {
+				if key == schema.ConditionsFilterKey {
+					comparisons, _ := value.([]schema.Comparison)
+					for _, comparison := range comparisons {
+						if !comparison.Match(data) {
+							valid = false
+						}
+					}
+					continue
+				}
+				if key == schema.ExclusionsFilterKey {
+					exclusions, _ := value.([][]schema.Comparison)
+					for _, comparisons := range exclusions {
+						if excluded(s, comparisons, data) {
+							valid = false
+						}
+					}
 					continue
 				}
 				property, err := s.GetPropertyByID(key)
 				if err != nil {
 					continue
 				}
+				if property.IsManyToMany() {
+					if !anyInSlice(schema.RelatedIDs(value), schema.RelatedIDs(data[key])) {
+						valid = false
+					}
+					continue
+				}
+				if s.IsTagsProperty(property) {
+					if !schema.MatchTags(data[key], schema.RelatedIDs(value)) {
+						valid = false
+					}
+					continue
+				}
+				if property.IsComputed() {
+					if !resource.MatchFilter(map[string]interface{}{key: value}) {
+						valid = false
+					}
+					continue
+				}
+				if data[key] == nil {
+					continue
+				}
 				switch value.(type) {
 				case string:
 					if property.Type == "boolean" {
@@ -252,18 +454,43 @@ func (tx *Transaction) List(s *schema.Schema, filter map[string]interface{}, pg
 		if valid {
 			list = append(list, resource)
 		}
-
-		if pg != nil {
-			sort.Sort(byPaginator{list, pg})
-			if pg.Limit > 0 {
-				list = list[:pg.Limit]
-			}
-		}
 	}
 	total = uint64(len(list))
+	if pg != nil {
+		sort.Sort(byPaginator{list, pg})
+		list = paginate(list, pg)
+	}
 	return
 }
 
+//excluded checks if resource data satisfies all comparisons of an exclusion
+//Comparisons of properties which aren't stored in columns are taken as satisfied, as in sql backend
+func excluded(s *schema.Schema, comparisons []schema.Comparison, data map[string]interface{}) bool {
+	for _, comparison := range comparisons {
+		property, err := s.GetPropertyByID(comparison.Property)
+		if err != nil || property.IsComputed() || property.IsManyToMany() || s.IsTagsProperty(property) {
+			continue
+		}
+		if !comparison.Match(data) {
+			return false
+		}
+	}
+	return true
+}
+
+//paginate returns resources of the page
+func paginate(list []*schema.Resource, pg *pagination.Paginator) []*schema.Resource {
+	offset := pg.Offset
+	if offset > uint64(len(list)) {
+		offset = uint64(len(list))
+	}
+	list = list[offset:]
+	if pg.Limit > 0 && pg.Limit < uint64(len(list)) {
+		list = list[:pg.Limit]
+	}
+	return list
+}
+
 //Fetch resources by ID in the db
 func (tx *Transaction) Fetch(s *schema.Schema, ID interface{}, tenantFilter []string) (*schema.Resource, error) {
 	query := map[string]interface{}{
@@ -298,6 +525,15 @@ func stringInSlice(a string, list []string) bool {
 	return false
 }
 
+func anyInSlice(values []string, list []string) bool {
+	for _, value := range values {
+		if stringInSlice(value, list) {
+			return true
+		}
+	}
+	return false
+}
+
 func boolInSlice(a bool, list []string) bool {
 	for _, b := range list {
 		v, _ := strconv.ParseBool(b)
@@ -55,7 +55,7 @@ func NewPaginator(s *schema.Schema, key, order string, limit, offset uint64) (*P
 	if s != nil {
 		found := false
 		for _, p := range s.Properties {
-			if p.ID == key {
+			if p.ID == key && !p.IsComputed() {
 				found = true
 				break
 			}
@@ -87,3 +87,16 @@ func TestFromURLQueryErrors(t *testing.T) {
 	pg, err = FromURLQuery(s, values)
 	Expect(err).To(HaveOccurred(), "Got %v", pg)
 }
+
+func TestComputedSortKey(t *testing.T) {
+	RegisterTestingT(t)
+	s := schema.NewSchema("foo", "foos", "Foo", "", "foo")
+	property := schema.NewProperty("owner", "", "", "string", "", "", "", "", false, true, nil, nil)
+	computed, err := schema.NewComputedFromObj("owner", map[string]interface{}{"template": "{{.tenant_id}}"})
+	Expect(err).ToNot(HaveOccurred())
+	property.Computed = computed
+	s.Properties = append(s.Properties, property)
+
+	pg, err := NewPaginator(s, "owner", "asc", 0, 0)
+	Expect(err).To(HaveOccurred(), "Got %v", pg)
+}
@@ -48,6 +48,8 @@ type Transaction struct {
 	transaction *sqlx.Tx
 	db          *DB
 	closed      bool
+	wrapper     transaction.Transaction
+	deleting    map[string]bool
 }
 
 //NewDB constructor
@@ -223,6 +225,7 @@ func (db *DB) Begin() (transaction.Transaction, error) {
 		db:          db,
 		transaction: transaction,
 		closed:      false,
+		deleting:    map[string]bool{},
 	}, nil
 }
 
@@ -231,60 +234,212 @@ func (db *DB) GenTableDef(s *schema.Schema, cascade bool) string {
 	schemaManager := schema.GetManager()
 	var cols []string
 	var relations []string
-	cascadeString := ""
-	if cascade {
-		cascadeString = "on delete cascade"
-	}
 	for _, property := range s.Properties {
-		handler := db.handlers[property.Type]
-		dataType := property.SQLType
-		if db.sqlType == "sqlite3" {
-			dataType = strings.Replace(dataType, "auto_increment", "autoincrement", 1)
-		}
-		if dataType == "" {
-			dataType = handler.dataType(&property)
-			if property.ID == "id" {
-				dataType += " primary key"
-			} else {
-				if property.Nullable {
-					dataType += " null"
-				} else {
-					dataType += " not null"
-				}
-				if property.Unique {
-					dataType += " unique"
-				}
-			}
+		if property.IsComputed() || property.IsManyToMany() || s.IsTagsProperty(&property) {
+			continue
 		}
-		sql := "`" + property.ID + "`" + dataType
+		sql := "`" + property.ID + "`" + db.columnType(property)
 
 		cols = append(cols, sql)
 		if property.Relation != "" {
 			foreignSchema, _ := schemaManager.Schema(property.Relation)
 			if foreignSchema != nil {
 				relations = append(relations, fmt.Sprintf("foreign key(`%s`) REFERENCES `%s`(id) %s",
-					property.ID, foreignSchema.GetDbTableName(), cascadeString))
+					property.ID, foreignSchema.GetDbTableName(), onDeleteClause(&property, cascade)))
 			}
 		}
 	}
 	if s.Parent != "" {
 		foreignSchema, _ := schemaManager.Schema(s.Parent)
+		onDelete := onDeleteClause(&schema.Property{}, cascade)
+		if property, err := s.GetPropertyByID(s.ParentSchemaPropertyID()); err == nil {
+			onDelete = onDeleteClause(property, cascade)
+		}
 		relations = append(relations, fmt.Sprintf("foreign key(`%s_id`) REFERENCES `%s`(id) %s",
-			s.Parent, foreignSchema.GetDbTableName(), cascadeString))
+			s.Parent, foreignSchema.GetDbTableName(), onDelete))
 	}
 	cols = append(cols, relations...)
 	tableSQL := fmt.Sprintf("create table `%s` (%s);\n", s.GetDbTableName(), strings.Join(cols, ","))
 	return tableSQL
 }
 
+//onDeleteClause returns on delete clause of foreign key for the property
+//Properties without on_delete cascade only if cascade is set
+func onDeleteClause(property *schema.Property, cascade bool) string {
+	switch property.OnDelete {
+	case schema.OnDeleteCascade:
+		return "on delete cascade"
+	case schema.OnDeleteRestrict:
+		return "on delete restrict"
+	case schema.OnDeleteSetNull:
+		return "on delete set null"
+	}
+	if cascade {
+		return "on delete cascade"
+	}
+	return ""
+}
+
+//GenJoinTableDef generates create sql of table storing many to many relation of the property
+func (db *DB) GenJoinTableDef(s *schema.Schema, property schema.Property) string {
+	relatedSchema, _ := schema.GetManager().Schema(property.Relation)
+	cols := []string{
+		"`resource_id` varchar(255) not null",
+		"`related_id` varchar(255) not null",
+		"primary key(`resource_id`,`related_id`)",
+		fmt.Sprintf("foreign key(`resource_id`) REFERENCES `%s`(id) on delete cascade", s.GetDbTableName()),
+	}
+	if relatedSchema != nil {
+		cols = append(cols, fmt.Sprintf("foreign key(`related_id`) REFERENCES `%s`(id) %s",
+			relatedSchema.GetDbTableName(), onDeleteClause(&property, false)))
+	}
+	return fmt.Sprintf("create table `%s` (%s);\n", s.GetJoinTableName(&property), strings.Join(cols, ","))
+}
+
+//GenTagTableDef generates create sql of table storing tags of resources
+func (db *DB) GenTagTableDef(s *schema.Schema) string {
+	cols := []string{
+		"`resource_id` varchar(255) not null",
+		"`key` varchar(255) not null",
+		"`value` varchar(255) not null",
+		"primary key(`resource_id`,`key`)",
+		fmt.Sprintf("foreign key(`resource_id`) REFERENCES `%s`(id) on delete cascade", s.GetDbTableName()),
+	}
+	return fmt.Sprintf("create table `%s` (%s);\n", s.GetTagTableName(), strings.Join(cols, ","))
+}
+
+func (db *DB) columnType(property schema.Property) string {
+	handler := db.handlers[property.Type]
+	dataType := property.SQLType
+	if db.sqlType == "sqlite3" {
+		dataType = strings.Replace(dataType, "auto_increment", "autoincrement", 1)
+	}
+	if dataType == "" {
+		dataType = handler.dataType(&property)
+		if property.ID == "id" {
+			dataType += " primary key"
+		} else {
+			if property.Nullable {
+				dataType += " null"
+			} else {
+				dataType += " not null"
+			}
+			if property.Unique {
+				dataType += " unique"
+			}
+		}
+	}
+	return dataType
+}
+
+func (db *DB) columnDefault(property schema.Property) (string, error) {
+	value, err := db.handler(&property).encode(&property, property.Default)
+	if err != nil {
+		return "", err
+	}
+	switch value := value.(type) {
+	case []byte:
+		return "'" + strings.Replace(string(value), "'", "''", -1) + "'", nil
+	case string:
+		return "'" + strings.Replace(value, "'", "''", -1) + "'", nil
+	case bool:
+		if value {
+			return "1", nil
+		}
+		return "0", nil
+	case int, int64, float64:
+		return fmt.Sprint(value), nil
+	}
+	return "", fmt.Errorf("unsupported default value for column %s", property.ID)
+}
+
+//GenAddColumnsDef generates sql statements adding columns to existing table
+func (db *DB) GenAddColumnsDef(s *schema.Schema, properties []schema.Property) ([]string, error) {
+	var statements []string
+	for _, property := range properties {
+		if property.IsManyToMany() {
+			statements = append(statements, db.GenJoinTableDef(s, property))
+			continue
+		}
+		if s.IsTagsProperty(&property) {
+			statements = append(statements, db.GenTagTableDef(s))
+			continue
+		}
+		sql := fmt.Sprintf("alter table %s add column %s%s", quote(s.GetDbTableName()), quote(property.ID), db.columnType(property))
+		if property.Default != nil {
+			defaultValue, err := db.columnDefault(property)
+			if err != nil {
+				return nil, err
+			}
+			sql += " default " + defaultValue
+		}
+		statements = append(statements, sql)
+	}
+	return statements, nil
+}
+
+//AddColumns adds columns for new properties to existing tables in a transaction,
+//so that no column is added if any of them fails where DDL is transactional
+func (db *DB) AddColumns(columns map[*schema.Schema][]schema.Property) error {
+	var statements []string
+	for s, properties := range columns {
+		sqls, err := db.GenAddColumnsDef(s, properties)
+		if err != nil {
+			return err
+		}
+		statements = append(statements, sqls...)
+	}
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	for _, sql := range statements {
+		logQuery(sql)
+		if _, err := tx.Exec(sql); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 //RegisterTable creates table in the db
 func (db *DB) RegisterTable(s *schema.Schema, cascade bool) error {
 	_, err := db.DB.Exec(db.GenTableDef(s, cascade))
-	return err
+	if err != nil {
+		return err
+	}
+	for _, property := range s.Properties {
+		if property.IsManyToMany() {
+			if _, err := db.DB.Exec(db.GenJoinTableDef(s, property)); err != nil {
+				return err
+			}
+		}
+	}
+	if s.Tagging {
+		if _, err := db.DB.Exec(db.GenTagTableDef(s)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 //DropTable drop table definition
 func (db *DB) DropTable(s *schema.Schema) error {
+	if s.Tagging {
+		sql := fmt.Sprintf("drop table if exists %s\n", quote(s.GetTagTableName()))
+		if _, err := db.DB.Exec(sql); err != nil {
+			return err
+		}
+	}
+	for _, property := range s.Properties {
+		if property.IsManyToMany() {
+			sql := fmt.Sprintf("drop table if exists %s\n", quote(s.GetJoinTableName(&property)))
+			if _, err := db.DB.Exec(sql); err != nil {
+				return err
+			}
+		}
+	}
 	sql := fmt.Sprintf("drop table if exists %s\n", quote(s.GetDbTableName()))
 	_, err := db.DB.Exec(sql)
 	return err
@@ -316,6 +471,9 @@ func (tx *Transaction) Create(resource *schema.Resource) error {
 	data := resource.Data()
 	q := sq.Insert(quote(s.GetDbTableName()))
 	for _, attr := range s.Properties {
+		if attr.IsComputed() || attr.IsManyToMany() || s.IsTagsProperty(&attr) {
+			continue
+		}
 		//TODO(nati) support optional value
 		if _, ok := data[attr.ID]; ok {
 			handler := db.handler(&attr)
@@ -332,7 +490,13 @@ func (tx *Transaction) Create(resource *schema.Resource) error {
 	if err != nil {
 		return err
 	}
-	return tx.Exec(sql, args...)
+	if err := tx.Exec(sql, args...); err != nil {
+		return err
+	}
+	if err := tx.setRelatedIDs(resource); err != nil {
+		return err
+	}
+	return tx.setTags(resource)
 }
 
 //Update update resource in the db
@@ -342,6 +506,9 @@ func (tx *Transaction) Update(resource *schema.Resource) error {
 	db := tx.db
 	q := sq.Update(quote(s.GetDbTableName()))
 	for _, attr := range s.Properties {
+		if attr.IsComputed() || attr.IsManyToMany() || s.IsTagsProperty(&attr) {
+			continue
+		}
 		//TODO(nati) support optional value
 		if _, ok := data[attr.ID]; ok {
 			handler := db.handler(&attr)
@@ -360,7 +527,13 @@ func (tx *Transaction) Update(resource *schema.Resource) error {
 	if err != nil {
 		return err
 	}
-	return tx.Exec(sql, args...)
+	if err := tx.Exec(sql, args...); err != nil {
+		return err
+	}
+	if err := tx.setRelatedIDs(resource); err != nil {
+		return err
+	}
+	return tx.setTags(resource)
 }
 
 //StateUpdate update resource state
@@ -368,8 +541,48 @@ func (tx *Transaction) StateUpdate(resource *schema.Resource) error {
 	return tx.Update(resource)
 }
 
+//Wrap makes changes of resources referring deleted resources go through wrapper
+func (tx *Transaction) Wrap(wrapper transaction.Transaction) {
+	tx.wrapper = wrapper
+}
+
+//outer returns the transaction wrapping tx, or tx if it isn't wrapped
+func (tx *Transaction) outer() transaction.Transaction {
+	if tx.wrapper != nil {
+		return tx.wrapper
+	}
+	return tx
+}
+
 //Delete delete resource from db
 func (tx *Transaction) Delete(s *schema.Schema, resourceID interface{}) error {
+	key := deletingKey(s, resourceID)
+	tx.deleting[key] = true
+	defer delete(tx.deleting, key)
+	if err := tx.applyOnDelete(s, resourceID); err != nil {
+		return err
+	}
+	for _, property := range s.Properties {
+		if !property.IsManyToMany() {
+			continue
+		}
+		sql, args, err := sq.Delete(quote(s.GetJoinTableName(&property))).Where(sq.Eq{quote("resource_id"): resourceID}).ToSql()
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec(sql, args...); err != nil {
+			return err
+		}
+	}
+	if s.Tagging {
+		sql, args, err := sq.Delete(quote(s.GetTagTableName())).Where(sq.Eq{quote("resource_id"): resourceID}).ToSql()
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec(sql, args...); err != nil {
+			return err
+		}
+	}
 	sql, args, err := sq.Delete(quote(s.GetDbTableName())).Where(sq.Eq{"id": resourceID}).ToSql()
 	if err != nil {
 		return err
@@ -377,6 +590,276 @@ func (tx *Transaction) Delete(s *schema.Schema, resourceID interface{}) error {
 	return tx.Exec(sql, args...)
 }
 
+//setRelatedIDs replaces rows of join tables for many to many properties present in resource
+func (tx *Transaction) setRelatedIDs(resource *schema.Resource) error {
+	s := resource.Schema()
+	data := resource.Data()
+	for _, property := range s.Properties {
+		value, ok := data[property.ID]
+		if !property.IsManyToMany() || !ok {
+			continue
+		}
+		ids := schema.RelatedIDs(value)
+		if err := tx.checkRelatedExist(&property, ids); err != nil {
+			return err
+		}
+		joinTable := quote(s.GetJoinTableName(&property))
+		sql, args, err := sq.Delete(joinTable).Where(sq.Eq{quote("resource_id"): resource.ID()}).ToSql()
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec(sql, args...); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		q := sq.Insert(joinTable).Columns(quote("resource_id"), quote("related_id"))
+		for _, id := range ids {
+			q = q.Values(resource.ID(), id)
+		}
+		sql, args, err = q.ToSql()
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec(sql, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//setTags replaces rows of tag table if tags are present in resource
+func (tx *Transaction) setTags(resource *schema.Resource) error {
+	s := resource.Schema()
+	value, ok := resource.Data()[schema.TagsPropertyID]
+	if !s.Tagging || !ok {
+		return nil
+	}
+	tagTable := quote(s.GetTagTableName())
+	sql, args, err := sq.Delete(tagTable).Where(sq.Eq{quote("resource_id"): resource.ID()}).ToSql()
+	if err != nil {
+		return err
+	}
+	if err := tx.Exec(sql, args...); err != nil {
+		return err
+	}
+	tags := schema.TagsMap(value)
+	if len(tags) == 0 {
+		return nil
+	}
+	q := sq.Insert(tagTable).Columns(quote("resource_id"), quote("key"), quote("value"))
+	for key, tagValue := range tags {
+		q = q.Values(resource.ID(), key, tagValue)
+	}
+	sql, args, err = q.ToSql()
+	if err != nil {
+		return err
+	}
+	return tx.Exec(sql, args...)
+}
+
+//checkRelatedExist checks if all resources referenced by a many to many property exist
+func (tx *Transaction) checkRelatedExist(property *schema.Property, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	relatedSchema, ok := schema.GetManager().Schema(property.Relation)
+	if !ok {
+		return fmt.Errorf("Related schema %s not found", property.Relation)
+	}
+	sql, args, err := sq.Select("id").From(quote(relatedSchema.GetDbTableName())).Where(sq.Eq{"id": ids}).ToSql()
+	if err != nil {
+		return err
+	}
+	logQuery(sql, args...)
+	var existing []string
+	if err := tx.transaction.Select(&existing, sql, args...); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		found := false
+		for _, existingID := range existing {
+			if id == existingID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Related %s %s not found", relatedSchema.ID, id)
+		}
+	}
+	return nil
+}
+
+//deletingKey identifies a resource being deleted
+func deletingKey(s *schema.Schema, resourceID interface{}) string {
+	return s.ID + "/" + fmt.Sprint(resourceID)
+}
+
+//applyOnDelete handles resources referring the deleted resource as set by on_delete of their relation.
+//Many to many relations restrict deletion unless on_delete is cascade.
+//Referring resources are updated and deleted through the wrapping transaction, skipping resources
+//already being deleted, which refer the resource by a cycle of relations.
+func (tx *Transaction) applyOnDelete(s *schema.Schema, resourceID interface{}) error {
+	for _, reference := range schema.GetManager().RelationsTo(s.ID) {
+		property := reference.Property
+		table := quote(reference.Schema.GetDbTableName())
+		column := quote(property.ID)
+		if property.IsManyToMany() {
+			table = quote(reference.Schema.GetJoinTableName(property))
+			column = quote("related_id")
+		}
+		switch {
+		case property.OnDelete == schema.OnDeleteRestrict || (property.IsManyToMany() && property.OnDelete != schema.OnDeleteCascade):
+			sql, args, err := sq.Select("Count(*) as count").From(table).Where(sq.Eq{column: resourceID}).ToSql()
+			if err != nil {
+				return err
+			}
+			logQuery(sql, args...)
+			var count int
+			if err := tx.transaction.Get(&count, sql, args...); err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("%s %s is referred by %s of %d %s", s.ID, resourceID, property.ID, count, reference.Schema.Plural)
+			}
+		case property.IsManyToMany():
+			sql, args, err := sq.Delete(table).Where(sq.Eq{column: resourceID}).ToSql()
+			if err != nil {
+				return err
+			}
+			if err := tx.Exec(sql, args...); err != nil {
+				return err
+			}
+		case property.OnDelete == schema.OnDeleteSetNull:
+			referring, _, err := tx.outer().List(reference.Schema, map[string]interface{}{property.ID: resourceID}, nil)
+			if err != nil {
+				return err
+			}
+			for _, resource := range referring {
+				if tx.deleting[deletingKey(reference.Schema, resource.ID())] {
+					continue
+				}
+				resource.Data()[property.ID] = nil
+				if err := tx.outer().Update(resource); err != nil {
+					return err
+				}
+			}
+		case property.OnDelete == schema.OnDeleteCascade:
+			sql, args, err := sq.Select("id").From(table).Where(sq.Eq{column: resourceID}).ToSql()
+			if err != nil {
+				return err
+			}
+			logQuery(sql, args...)
+			var ids []string
+			if err := tx.transaction.Select(&ids, sql, args...); err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if tx.deleting[deletingKey(reference.Schema, id)] {
+					continue
+				}
+				if err := tx.outer().Delete(reference.Schema, id); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//populateRelatedIDs fills many to many properties of listed resources with IDs of related resources
+func (tx *Transaction) populateRelatedIDs(s *schema.Schema, list []*schema.Resource) error {
+	if len(list) == 0 {
+		return nil
+	}
+	resources := map[string]*schema.Resource{}
+	ids := []string{}
+	for _, resource := range list {
+		resources[resource.ID()] = resource
+		ids = append(ids, resource.ID())
+	}
+	for _, property := range s.Properties {
+		if !property.IsManyToMany() {
+			continue
+		}
+		for _, resource := range list {
+			resource.Data()[property.ID] = []interface{}{}
+		}
+		sql, args, err := sq.Select(quote("resource_id"), quote("related_id")).From(quote(s.GetJoinTableName(&property))).Where(
+			sq.Eq{quote("resource_id"): ids}).OrderBy(quote("related_id")).ToSql()
+		if err != nil {
+			return err
+		}
+		logQuery(sql, args...)
+		rows, err := tx.transaction.Query(sql, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var resourceID, relatedID string
+			if err := rows.Scan(&resourceID, &relatedID); err != nil {
+				rows.Close()
+				return err
+			}
+			data := resources[resourceID].Data()
+			data[property.ID] = append(data[property.ID].([]interface{}), relatedID)
+		}
+		rows.Close()
+	}
+	return nil
+}
+
+//populateTags fills tags of listed resources
+func (tx *Transaction) populateTags(s *schema.Schema, list []*schema.Resource) error {
+	if !s.Tagging || len(list) == 0 {
+		return nil
+	}
+	resources := map[string]*schema.Resource{}
+	ids := []string{}
+	for _, resource := range list {
+		resources[resource.ID()] = resource
+		ids = append(ids, resource.ID())
+		resource.Data()[schema.TagsPropertyID] = map[string]interface{}{}
+	}
+	sql, args, err := sq.Select(quote("resource_id"), quote("key"), quote("value")).From(quote(s.GetTagTableName())).Where(
+		sq.Eq{quote("resource_id"): ids}).ToSql()
+	if err != nil {
+		return err
+	}
+	logQuery(sql, args...)
+	rows, err := tx.transaction.Query(sql, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var resourceID, key, value string
+		if err := rows.Scan(&resourceID, &key, &value); err != nil {
+			return err
+		}
+		resources[resourceID].Data()[schema.TagsPropertyID].(map[string]interface{})[key] = value
+	}
+	return nil
+}
+
+//completeResources fills in values which aren't stored in the resource table
+func (tx *Transaction) completeResources(s *schema.Schema, list []*schema.Resource) error {
+	if err := tx.populateRelatedIDs(s, list); err != nil {
+		return err
+	}
+	if err := tx.populateTags(s, list); err != nil {
+		return err
+	}
+	for _, resource := range list {
+		if err := resource.PopulateComputed(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (db *DB) handler(property *schema.Property) propertyHandler {
 	handler, ok := db.handlers[property.Type]
 	if ok {
@@ -398,6 +881,9 @@ func MakeColumns(s *schema.Schema, join bool) []string {
 	var cols []string
 	manager := schema.GetManager()
 	for _, property := range s.Properties {
+		if property.IsComputed() || property.IsManyToMany() || s.IsTagsProperty(&property) {
+			continue
+		}
 		cols = append(cols, makeColumn(s, property)+" as "+quote(makeColumnID(s, property)))
 		if property.RelationProperty != "" && join {
 			relatedSchema, _ := manager.Schema(property.Relation)
@@ -410,7 +896,7 @@ func MakeColumns(s *schema.Schema, join bool) []string {
 func makeJoin(s *schema.Schema, q sq.SelectBuilder) sq.SelectBuilder {
 	manager := schema.GetManager()
 	for _, property := range s.Properties {
-		if property.RelationProperty == "" {
+		if property.RelationProperty == "" || property.IsManyToMany() {
 			continue
 		}
 		relatedSchema, _ := manager.Schema(property.Relation)
@@ -425,6 +911,9 @@ func (tx *Transaction) decode(s *schema.Schema, data map[string]interface{}, res
 	manager := schema.GetManager()
 	db := tx.db
 	for _, property := range s.Properties {
+		if property.IsComputed() || property.IsManyToMany() || s.IsTagsProperty(&property) {
+			continue
+		}
 		handler := db.handler(&property)
 		value := data[makeColumnID(s, property)]
 		if value != nil {
@@ -445,19 +934,25 @@ func (tx *Transaction) decode(s *schema.Schema, data map[string]interface{}, res
 
 //List resources in the db
 func (tx *Transaction) List(s *schema.Schema, filter map[string]interface{}, pg *pagination.Paginator) (list []*schema.Resource, total uint64, err error) {
+	filter, computedFilter := s.SplitComputedFilter(filter)
 	cols := MakeColumns(s, true)
 	q := sq.Select(cols...).From(quote(s.GetDbTableName()))
 	q = addFilterToQuery(s, q, filter, true)
 
+	//Resources filtered by computed properties are paginated after filtering
+	paginated := false
 	if pg != nil {
 		property, err := s.GetPropertyByID(pg.Key)
 		if err == nil {
 			q = q.OrderBy(makeColumn(s, *property) + " " + pg.Order)
-			if pg.Limit > 0 {
-				q = q.Limit(pg.Limit)
-			}
-			if pg.Offset > 0 {
-				q = q.Offset(pg.Offset)
+			paginated = true
+			if len(computedFilter) == 0 {
+				if pg.Limit > 0 {
+					q = q.Limit(pg.Limit)
+				}
+				if pg.Offset > 0 {
+					q = q.Offset(pg.Offset)
+				}
 			}
 		}
 	}
@@ -472,15 +967,45 @@ func (tx *Transaction) List(s *schema.Schema, filter map[string]interface{}, pg
 	if err != nil {
 		return
 	}
-	defer rows.Close()
 	list, err = tx.decodeRows(s, rows, list)
+	rows.Close()
 	if err != nil {
 		return nil, 0, err
 	}
+	if err = tx.completeResources(s, list); err != nil {
+		return nil, 0, err
+	}
+	if len(computedFilter) > 0 {
+		//Computed values are known only after decoding, so they are filtered here
+		filtered := []*schema.Resource{}
+		for _, resource := range list {
+			if resource.MatchFilter(computedFilter) {
+				filtered = append(filtered, resource)
+			}
+		}
+		total = uint64(len(filtered))
+		if paginated {
+			filtered = paginate(filtered, pg)
+		}
+		return filtered, total, nil
+	}
 	total, err = tx.count(s, filter)
 	return
 }
 
+//paginate returns resources of the page
+func paginate(list []*schema.Resource, pg *pagination.Paginator) []*schema.Resource {
+	offset := pg.Offset
+	if offset > uint64(len(list)) {
+		offset = uint64(len(list))
+	}
+	list = list[offset:]
+	if pg.Limit > 0 && pg.Limit < uint64(len(list)) {
+		list = list[:pg.Limit]
+	}
+	return list
+}
+
 // Query with raw sql string
 func (tx *Transaction) Query(s *schema.Schema, query string, arguments []interface{}) (list []*schema.Resource, err error) {
 	logQuery(query, arguments...)
@@ -489,12 +1014,12 @@ func (tx *Transaction) Query(s *schema.Schema, query string, arguments []interfa
 		return nil, fmt.Errorf("Failed to run query: %s", query)
 	}
 
-	defer rows.Close()
 	list, err = tx.decodeRows(s, rows, list)
+	rows.Close()
 	if err != nil {
 		return nil, err
 	}
-
+	err = tx.completeResources(s, list)
 	return
 }
 
@@ -594,6 +1119,20 @@ func addFilterToQuery(s *schema.Schema, q sq.SelectBuilder, filter map[string]in
 		return q
 	}
 	for key, value := range filter {
+		if key == schema.ConditionsFilterKey {
+			comparisons, _ := value.([]schema.Comparison)
+			for _, comparison := range comparisons {
+				q = q.Where(comparisonFilter(s, join, comparison))
+			}
+			continue
+		}
+		if key == schema.ExclusionsFilterKey {
+			exclusions, _ := value.([][]schema.Comparison)
+			for _, comparisons := range exclusions {
+				q = q.Where(exclusionFilter(s, join, comparisons))
+			}
+			continue
+		}
 		property, err := s.GetPropertyByID(key)
 		var column string
 		if join {
@@ -606,7 +1145,13 @@ func addFilterToQuery(s *schema.Schema, q sq.SelectBuilder, filter map[string]in
 			continue
 		}
 
-		if property.Type == "boolean" {
+		if property.IsManyToMany() {
+			q = q.Where(relatedFilter(s, property, join, schema.RelatedIDs(value)))
+		} else if s.IsTagsProperty(property) {
+			for _, tag := range schema.RelatedIDs(value) {
+				q = q.Where(tagFilter(s, join, tag))
+			}
+		} else if property.Type == "boolean" {
 			v := make([]bool, len(value.([]string)))
 			for i, j := range value.([]string) {
 				v[i], _ = strconv.ParseBool(j)
@@ -618,3 +1163,128 @@ func addFilterToQuery(s *schema.Schema, q sq.SelectBuilder, filter map[string]in
 	}
 	return q
 }
+
+//relatedFilter matches resources related to any of ids by a many to many property
+func relatedFilter(s *schema.Schema, property *schema.Property, join bool, ids []string) sq.Sqlizer {
+	idColumn := quote("id")
+	if join {
+		idColumn = fmt.Sprintf("%s.%s", s.GetDbTableName(), quote("id"))
+	}
+	if len(ids) == 0 {
+		return sq.Expr("1 = 0")
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	return sq.Expr(fmt.Sprintf("%s in (select %s from %s where %s in (%s))",
+		idColumn, quote("resource_id"), quote(s.GetJoinTableName(property)), quote("related_id"), placeholders), args...)
+}
+
+//comparisonFilter matches resources satisfying comparison of a stored property
+//Comparisons of properties which aren't stored in columns match nothing
+func comparisonFilter(s *schema.Schema, join bool, comparison schema.Comparison) sq.Sqlizer {
+	property, err := s.GetPropertyByID(comparison.Property)
+	if err != nil || property.IsComputed() || property.IsManyToMany() || s.IsTagsProperty(property) {
+		return sq.Expr("1 = 0")
+	}
+	column := quote(property.ID)
+	if join {
+		column = makeColumn(s, *property)
+	}
+	switch comparison.Operator {
+	case schema.OperatorEq, schema.OperatorIn:
+		return sq.Eq{column: comparison.Value}
+	case schema.OperatorNe, schema.OperatorNotIn:
+		if comparison.Value == nil {
+			return sq.NotEq{column: nil}
+		}
+		return sq.Or{sq.NotEq{column: comparison.Value}, sq.Eq{column: nil}}
+	}
+	if !orderedBy(property, comparison.Value) {
+		return sq.Expr("1 = 0")
+	}
+	operators := map[string]string{
+		schema.OperatorLt: "<",
+		schema.OperatorLe: "<=",
+		schema.OperatorGt: ">",
+		schema.OperatorGe: ">=",
+	}
+	return sq.Expr(fmt.Sprintf("%s %s ?", column, operators[comparison.Operator]), comparison.Value)
+}
+
+//orderedBy checks if values of property are ordered against value like schema.Comparison does,
+//numerically for numbers and lexically for strings
+func orderedBy(property *schema.Property, value interface{}) bool {
+	switch value.(type) {
+	case int, int64, float64:
+		return property.Type == "integer" || property.Type == "number"
+	case string:
+		return property.Type == "string"
+	}
+	return false
+}
+
+var negatedOperators = map[string]string{
+	schema.OperatorEq:    schema.OperatorNe,
+	schema.OperatorNe:    schema.OperatorEq,
+	schema.OperatorIn:    schema.OperatorNotIn,
+	schema.OperatorNotIn: schema.OperatorIn,
+	schema.OperatorLt:    schema.OperatorGe,
+	schema.OperatorLe:    schema.OperatorGt,
+	schema.OperatorGt:    schema.OperatorLe,
+	schema.OperatorGe:    schema.OperatorLt,
+}
+
+//exclusionFilter matches resources which don't satisfy some of comparisons
+func exclusionFilter(s *schema.Schema, join bool, comparisons []schema.Comparison) sq.Sqlizer {
+	filter := sq.Or{}
+	for _, comparison := range comparisons {
+		filter = append(filter, negatedComparisonFilter(s, join, comparison))
+	}
+	if len(filter) == 0 {
+		return sq.Expr("1 = 0")
+	}
+	return filter
+}
+
+//negatedComparisonFilter matches resources which don't satisfy comparison of a stored property,
+//including ones with null value of the property
+//Comparisons of properties which aren't stored in columns can't be checked, so they match nothing
+func negatedComparisonFilter(s *schema.Schema, join bool, comparison schema.Comparison) sq.Sqlizer {
+	property, err := s.GetPropertyByID(comparison.Property)
+	if err != nil || property.IsComputed() || property.IsManyToMany() || s.IsTagsProperty(property) {
+		return sq.Expr("1 = 0")
+	}
+	column := quote(property.ID)
+	if join {
+		column = makeColumn(s, *property)
+	}
+	negated := comparison
+	negated.Operator = negatedOperators[comparison.Operator]
+	filter := comparisonFilter(s, join, negated)
+	switch comparison.Operator {
+	case schema.OperatorLt, schema.OperatorLe, schema.OperatorGt, schema.OperatorGe:
+		if !orderedBy(property, comparison.Value) {
+			return sq.Expr("1 = 1")
+		}
+		return sq.Or{filter, sq.Eq{column: nil}}
+	}
+	return filter
+}
+
+//tagFilter matches resources having the tag, given in key or key:value format
+func tagFilter(s *schema.Schema, join bool, tag string) sq.Sqlizer {
+	idColumn := quote("id")
+	if join {
+		idColumn = fmt.Sprintf("%s.%s", s.GetDbTableName(), quote("id"))
+	}
+	key, value, hasValue := schema.ParseTag(tag)
+	if !hasValue {
+		return sq.Expr(fmt.Sprintf("%s in (select %s from %s where %s = ?)",
+			idColumn, quote("resource_id"), quote(s.GetTagTableName()), quote("key")), key)
+	}
+	return sq.Expr(fmt.Sprintf("%s in (select %s from %s where %s = ? and %s = ?)",
+		idColumn, quote("resource_id"), quote(s.GetTagTableName()), quote("key"), quote("value")), key, value)
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/pagination"
 	. "github.com/cloudwan/gohan/db/sql"
 	"github.com/cloudwan/gohan/db/transaction"
 	"github.com/cloudwan/gohan/schema"
@@ -18,6 +19,7 @@ var _ = Describe("Sql", func() {
 
 	var conn string
 	var tx transaction.Transaction
+	var dbc db.DB
 
 	BeforeEach(func() {
 		var dbType string
@@ -29,8 +31,9 @@ var _ = Describe("Sql", func() {
 			dbType = "sqlite3"
 		}
 
+		var err error
 		manager := schema.GetManager()
-		dbc, err := db.ConnectDB(dbType, conn)
+		dbc, err = db.ConnectDB(dbType, conn)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(manager.LoadSchemasFromFiles(
 			"../../etc/schema/gohan.json", "../../etc/apps/example.yaml")).To(Succeed())
@@ -112,4 +115,89 @@ var _ = Describe("Sql", func() {
 			})
 		})
 	})
+
+	Describe("List", func() {
+		It("Paginates resources filtered by computed properties after filtering", func() {
+			manager := schema.GetManager()
+			s, ok := manager.Schema("test")
+			Expect(ok).To(BeTrue())
+			owner := schema.NewProperty("owner", "", "", "string", "", "", "", "", false, true, nil, nil)
+			computed, err := schema.NewComputedFromObj("owner", map[string]interface{}{"template": "{{.tenant_id}}"})
+			Expect(err).ToNot(HaveOccurred())
+			owner.Computed = computed
+			computedSchema := *s
+			computedSchema.Properties = append(append([]schema.Property{}, s.Properties...), owner)
+
+			pg, err := pagination.NewPaginator(&computedSchema, "test_string", pagination.ASC, 1, 1)
+			Expect(err).ToNot(HaveOccurred())
+			list, total, err := tx.List(&computedSchema, map[string]interface{}{"owner": "tenant1"}, pg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(total).To(Equal(uint64(2)))
+			Expect(list).To(HaveLen(1))
+			Expect(list[0].Get("test_string")).To(Equal("obj3"))
+		})
+	})
+
+	Describe("AddColumns", func() {
+		It("Adds nullable and defaulted columns to existing table", func() {
+			manager := schema.GetManager()
+			s, ok := manager.Schema("test")
+			Expect(ok).To(BeTrue())
+			newProperties := []schema.Property{
+				schema.NewProperty("test_added", "", "", "string", "", "", "", "", false, true, nil, nil),
+				schema.NewProperty("test_count", "", "", "number", "", "", "", "", false, false, nil, 3.0),
+			}
+			altered := *s
+			altered.Properties = append(append([]schema.Property{}, s.Properties...), newProperties...)
+
+			Expect(tx.Close()).To(Succeed())
+			Expect(dbc.AddColumns(map[*schema.Schema][]schema.Property{s: newProperties})).To(Succeed())
+
+			tx, err := dbc.Begin()
+			Expect(err).ToNot(HaveOccurred())
+			defer tx.Close()
+			query := fmt.Sprintf(
+				"SELECT %s FROM %s",
+				strings.Join(MakeColumns(&altered, false), ", "),
+				s.GetDbTableName(),
+			)
+			results, err := tx.Query(&altered, query, []interface{}{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(results).To(HaveLen(4))
+			Expect(results[0].Get("test_string")).To(Equal("obj0"))
+			Expect(results[0].Get("test_added")).To(BeNil())
+			Expect(results[0].Get("test_count")).To(Equal(uint64(3)))
+		})
+
+		It("Adds no column if adding any of them fails", func() {
+			manager := schema.GetManager()
+			s, ok := manager.Schema("test")
+			Expect(ok).To(BeTrue())
+			added := schema.NewProperty("test_added", "", "", "string", "", "", "", "", false, true, nil, nil)
+			missing := schema.NewSchema("missing", "missings", "Missing", "", "missing")
+
+			Expect(tx.Close()).To(Succeed())
+			Expect(dbc.AddColumns(map[*schema.Schema][]schema.Property{
+				s:       {added},
+				missing: {added},
+			})).ToNot(Succeed())
+			if os.Getenv("MYSQL_TEST") == "true" {
+				//DDL isn't transactional in MySQL
+				return
+			}
+
+			altered := *s
+			altered.Properties = append(append([]schema.Property{}, s.Properties...), added)
+			tx, err := dbc.Begin()
+			Expect(err).ToNot(HaveOccurred())
+			defer tx.Close()
+			query := fmt.Sprintf(
+				"SELECT %s FROM %s",
+				strings.Join(MakeColumns(&altered, false), ", "),
+				s.GetDbTableName(),
+			)
+			_, err = tx.Query(&altered, query, []interface{}{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
@@ -35,3 +35,30 @@ type Transaction interface {
 	Close() error
 	Closed() bool
 }
+
+//Wrappable is implemented by transactions which change resources on their own,
+//such as resources referring a deleted resource. They make these changes
+//through the transaction wrapping them, so the wrapper sees them.
+type Wrappable interface {
+	Wrap(wrapper Transaction)
+}
+
+//Wrap makes tx change resources on its own through wrapper, if tx is Wrappable
+func Wrap(tx Transaction, wrapper Transaction) {
+	if wrappable, ok := tx.(Wrappable); ok {
+		wrappable.Wrap(wrapper)
+	}
+}
+
+//RequestTransaction is implemented by transactions which record ID of the request
+//making changes, like transactions logging events for sync
+type RequestTransaction interface {
+	SetRequestID(requestID string)
+}
+
+//SetRequestID sets ID of the request making changes in tx, if tx records it
+func SetRequestID(tx Transaction, requestID string) {
+	if requestTransaction, ok := tx.(RequestTransaction); ok {
+		requestTransaction.SetRequestID(requestID)
+	}
+}
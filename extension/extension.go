@@ -17,6 +17,7 @@ package extension
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/cloudwan/gohan/schema"
 )
@@ -41,14 +42,20 @@ type Environment interface {
 
 var manager *Manager
 
+//managerLock guards manager
+var managerLock sync.Mutex
+
 //Manager takes care of mapping schemas to Environments.
 //This is a singleton class.
 type Manager struct {
+	mutex        sync.RWMutex
 	environments map[string]Environment
 }
 
 //RegisterEnvironment registers a new environment for the given schema ID
 func (manager *Manager) RegisterEnvironment(schemaID string, env Environment) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
 	if _, ok := manager.environments[schemaID]; ok {
 		return fmt.Errorf("Environment already registered for this schema")
 	}
@@ -58,6 +65,8 @@ func (manager *Manager) RegisterEnvironment(schemaID string, env Environment) er
 
 //UnRegisterEnvironment removes an environment registered for the given schema ID
 func (manager *Manager) UnRegisterEnvironment(schemaID string) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
 	if _, ok := manager.environments[schemaID]; !ok {
 		return fmt.Errorf("No environment registered for this schema")
 	}
@@ -67,12 +76,24 @@ func (manager *Manager) UnRegisterEnvironment(schemaID string) error {
 
 //GetEnvironment returns the environment registered for the given schema ID
 func (manager *Manager) GetEnvironment(schemaID string) (env Environment, ok bool) {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
 	env, ok = manager.environments[schemaID]
 	return
 }
 
+//SetEnvironments replaces all registered environments at once,
+//so that environments are never missing while they are reloaded
+func (manager *Manager) SetEnvironments(environments map[string]Environment) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	manager.environments = environments
+}
+
 //GetManager gets manager
 func GetManager() *Manager {
+	managerLock.Lock()
+	defer managerLock.Unlock()
 	if manager == nil {
 		manager = &Manager{
 			environments: map[string]Environment{},
@@ -83,6 +104,8 @@ func GetManager() *Manager {
 
 //ClearManager clears manager
 func ClearManager() {
+	managerLock.Lock()
+	defer managerLock.Unlock()
 	manager = nil
 }
 
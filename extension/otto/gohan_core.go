@@ -16,6 +16,8 @@
 package otto
 
 import (
+	"time"
+
 	"github.com/dop251/otto"
 
 	"github.com/cloudwan/gohan/schema"
@@ -54,6 +56,18 @@ func init() {
 				value, _ := vm.ToValue(schema.URL)
 				return value
 			},
+			"gohan_handler_started": func(call otto.FunctionCall) otto.Value {
+				value, _ := vm.ToValue(float64(time.Now().UnixNano()))
+				return value
+			},
+			"gohan_handler_finished": func(call otto.FunctionCall) otto.Value {
+				VerifyCallArguments(&call, "gohan_handler_finished", 3)
+				extensionID := call.Argument(0).String()
+				event := call.Argument(1).String()
+				started, _ := call.Argument(2).ToFloat()
+				extensionEventDuration.Observe(time.Since(time.Unix(0, int64(started))).Seconds(), extensionID, event)
+				return otto.UndefinedValue()
+			},
 			"gohan_policies": func(call otto.FunctionCall) otto.Value {
 				VerifyCallArguments(&call, "gohan_policies", 0)
 				manager := schema.GetManager()
@@ -121,11 +135,16 @@ func init() {
 
 		err = env.Load("<Gohan built-ins>", `
 		var gohan_handler = {}
+		var gohan_handler_extensions = {}
+		var gohan_loading_extension = ""
+		var gohan_context = {}
 		function gohan_register_handler(event_type, func){
 		  if(_.isUndefined(gohan_handler[event_type])){
 		    gohan_handler[event_type] = [];
+		    gohan_handler_extensions[event_type] = [];
 		  }
 		  gohan_handler[event_type].push(func)
+		  gohan_handler_extensions[event_type].push(gohan_loading_extension)
 		}
 
 		function gohan_handle_event(event_type, context){
@@ -133,21 +152,31 @@ func init() {
 		    return;
 		  }
 
-		  for (var i = 0; i < gohan_handler[event_type].length; ++i) {
-		    try {
-		      gohan_handler[event_type][i](context);
-		      //backwards compatibility
-		      if (!_.isUndefined(context.response_code)) {
-		        throw new CustomException(context.response, context.response_code);
-		      }
-		    } catch(e) {
-		      if (e instanceof BaseException) {
-		        context.exception = e.toDict();
-		        context.exception_message = event_type.concat(": ").concat(e.toString());
-		      } else {
-		        throw e;
+		  //context of the event, which builtins read request_id from
+		  var previous_context = gohan_context;
+		  gohan_context = context;
+		  try {
+		    for (var i = 0; i < gohan_handler[event_type].length; ++i) {
+		      var started = gohan_handler_started();
+		      try {
+		        gohan_handler[event_type][i](context);
+		        //backwards compatibility
+		        if (!_.isUndefined(context.response_code)) {
+		          throw new CustomException(context.response, context.response_code);
+		        }
+		      } catch(e) {
+		        if (e instanceof BaseException) {
+		          context.exception = e.toDict();
+		          context.exception_message = event_type.concat(": ").concat(e.toString());
+		        } else {
+		          throw e;
+		        }
+		      } finally {
+		        gohan_handler_finished(gohan_handler_extensions[event_type][i], event_type, started);
 		      }
 		    }
+		  } finally {
+		    gohan_context = previous_context;
 		  }
 		}
 		`)
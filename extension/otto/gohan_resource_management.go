@@ -70,13 +70,15 @@ func init() {
 						case string:
 							filter[key] = value
 						case []interface{}:
+							values := []string{}
 							for _, val := range value {
 								v, ok := val.(string)
 								if !ok {
 									ThrowOttoException(&call, "Filter not a string nor array of strings")
 								}
-								filter[key] = v
+								values = append(values, v)
 							}
+							filter[key] = values
 						}
 					}
 				}
@@ -204,6 +206,48 @@ func init() {
 				value, _ := vm.ToValue(resource)
 				return value
 			},
+			"gohan_model_update_tags": func(call otto.FunctionCall) otto.Value {
+				VerifyCallArguments(&call, "gohan_model_update_tags", 6)
+				rawContext, _ := call.Argument(0).Export()
+				context, ok := rawContext.(map[string]interface{})
+				if !ok {
+					ThrowOttoException(&call, noContextMessage)
+				}
+				schemaID := call.Argument(1).String()
+				manager := schema.GetManager()
+				currentSchema, ok := manager.Schema(schemaID)
+				if !ok {
+					ThrowOttoException(&call, unknownSchemaErrorMesssageFormat, schemaID)
+				}
+				context["schema"] = currentSchema
+				context["path"] = currentSchema.GetPluralURL()
+				resourceID := call.Argument(2).String()
+				rawAdded, _ := call.Argument(3).Export()
+				added, ok := rawAdded.(map[string]interface{})
+				if rawAdded != nil && !ok {
+					ThrowOttoException(&call, notADictionaryErrorMessageFormat, rawAdded)
+				}
+				rawRemoved, _ := call.Argument(4).Export()
+				removed := schema.RelatedIDs(rawRemoved)
+
+				rawTenantIDs, _ := call.Argument(5).Export()
+				tenantIDs, ok := rawTenantIDs.([]string)
+				if !ok {
+					tenantIDs = nil
+				}
+
+				err := resources.UpdateResourceTagsInTransaction(context, currentSchema, resourceID, added, removed, tenantIDs)
+				if err != nil {
+					handleChainError(env, &call, err)
+				}
+				response, ok := context["response"].(map[string]interface{})
+				if !ok {
+					ThrowOttoException(&call, "No response")
+				}
+				resource := response[currentSchema.Singular]
+				value, _ := vm.ToValue(resource)
+				return value
+			},
 			"gohan_model_delete": func(call otto.FunctionCall) otto.Value {
 				VerifyCallArguments(&call, "gohan_model_delete", 3)
 				rawContext, _ := call.Argument(0).Export()
@@ -23,13 +23,16 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
 	"os/exec"
+	"strings"
 	"text/template"
 	"time"
 
 	"github.com/dop251/otto"
 	"github.com/twinj/uuid"
 
+	l "github.com/cloudwan/gohan/log"
 	"github.com/cloudwan/gohan/schema"
 )
 
@@ -54,9 +57,11 @@ func init() {
 				headers := ConvertOttoToGo(call.Argument(2))
 				data := ConvertOttoToGo(call.Argument(3))
 				options := ConvertOttoToGo(call.Argument(4))
-				log.Debug("gohan_http  [%s] %s %s %s", method, headers, url, options)
-				code, headers, body, err := gohanHTTP(method, url, headers, data, options)
-				log.Debug("response code %d", code)
+				requestID := handledRequestID(vm)
+				logger := l.NewRequestLogger(log, requestID)
+				logger.Debug("gohan_http  [%s] %s %s %s", method, headers, url, options)
+				code, headers, body, err := gohanHTTP(method, url, headers, data, options, requestID)
+				logger.Debug("response code %d", code)
 				resp := map[string]interface{}{}
 				if err != nil {
 					resp["status"] = "err"
@@ -67,7 +72,7 @@ func init() {
 					resp["body"] = body
 					resp["headers"] = headers
 				}
-				log.Debug("response code %d", code)
+				logger.Debug("response code %d", code)
 				value, _ := vm.ToValue(resp)
 				return value
 			},
@@ -174,20 +179,64 @@ func init() {
 			vm.Set(name, object)
 		}
 
+		if console, err := vm.Get("console"); err == nil && console.IsObject() {
+			consoleOutputs := map[string]io.Writer{
+				"log":   os.Stdout,
+				"debug": os.Stdout,
+				"info":  os.Stdout,
+				"error": os.Stderr,
+				"warn":  os.Stderr,
+			}
+			for name, output := range consoleOutputs {
+				console.Object().Set(name, consoleFunc(output))
+			}
+		}
 	}
 	RegistInit(gohanUtilInit)
 }
 
-func gohanHTTP(method, rawURL string, headers interface{}, postData interface{}, options interface{}) (int, http.Header, string, error) {
+//handledRequestID returns ID of the request whose event is handled by the VM,
+//which is request_id of the context of the event
+func handledRequestID(vm *otto.Otto) string {
+	context, err := vm.Get("gohan_context")
+	if err != nil || !context.IsObject() {
+		return ""
+	}
+	requestID, err := context.Object().Get(l.RequestIDKey)
+	if err != nil || !requestID.IsString() {
+		return ""
+	}
+	return requestID.String()
+}
+
+//consoleFunc writes arguments to output like console of otto,
+//prefixed with ID of the request whose event is handled
+func consoleFunc(output io.Writer) func(call otto.FunctionCall) otto.Value {
+	return func(call otto.FunctionCall) otto.Value {
+		args := []string{}
+		for _, arg := range call.ArgumentList {
+			args = append(args, arg.String())
+		}
+		message := strings.Join(args, " ")
+		if requestID := handledRequestID(call.Otto); requestID != "" {
+			message = "[" + requestID + "] " + message
+		}
+		fmt.Fprintln(output, message)
+		return otto.UndefinedValue()
+	}
+}
+
+func gohanHTTP(method, rawURL string, headers interface{}, postData interface{}, options interface{}, requestID string) (int, http.Header, string, error) {
 	client := &http.Client{}
+	logger := l.NewRequestLogger(log, requestID)
 	var reader io.Reader
 	if postData != nil {
-		log.Debug("post data %v", postData)
+		logger.Debug("post data %v", postData)
 		jsonByte, err := json.Marshal(postData)
 		if err != nil {
 			return 0, http.Header{}, "", err
 		}
-		log.Debug("request data: %s", string(jsonByte))
+		logger.Debug("request data: %s", string(jsonByte))
 		reader = bytes.NewBuffer(jsonByte)
 	}
 	request, err := http.NewRequest(method, rawURL, reader)
@@ -200,6 +249,9 @@ func gohanHTTP(method, rawURL string, headers interface{}, postData interface{},
 	if err != nil {
 		return 0, http.Header{}, "", err
 	}
+	if requestID != "" && request.Header.Get("X-Request-ID") == "" {
+		request.Header.Set("X-Request-ID", requestID)
+	}
 
 	if options != nil {
 		if value, ok := options.(map[string]interface{})["opaque_url"]; ok {
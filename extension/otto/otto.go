@@ -17,9 +17,11 @@ package otto
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/cloudwan/gohan/db"
 	ext "github.com/cloudwan/gohan/extension"
+	"github.com/cloudwan/gohan/metrics"
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/server/middleware"
 
@@ -31,12 +33,21 @@ import (
 
 var inits = []func(env *Environment){}
 
+var extensionEventDuration = metrics.NewHistogramVec("gohan_extension_event_duration_seconds",
+	"Duration of extension event handlers", metrics.DefaultBuckets, "extension", "event")
+
+//goCallback is go based callback of extension
+type goCallback struct {
+	extensionID string
+	callback    ext.GoCallback
+}
+
 //GoCallback is type for go based callback
 
 //Environment javascript based environment for gohan extension
 type Environment struct {
 	VM          *otto.Otto
-	goCallbacks []ext.GoCallback
+	goCallbacks []goCallback
 	DataStore   db.DB
 	Identity    middleware.IdentityService
 }
@@ -54,7 +65,7 @@ func (env *Environment) SetUp() {
 	for _, init := range inits {
 		init(env)
 	}
-	env.goCallbacks = []ext.GoCallback{}
+	env.goCallbacks = []goCallback{}
 }
 
 //RegistInit registers init code
@@ -84,8 +95,11 @@ func (env *Environment) RegistObject(objectID string, object interface{}) {
 //LoadExtensionsForPath for returns extensions for specific path
 func (env *Environment) LoadExtensionsForPath(extensions []*schema.Extension, path string) error {
 	var err error
+	//handlers registered by extensions are measured by extension IDs
+	defer env.VM.Set("gohan_loading_extension", "")
 	for _, extension := range extensions {
 		if extension.Match(path) {
+			env.VM.Set("gohan_loading_extension", extension.ID)
 			code := extension.Code
 			if extension.CodeType == "donburi" {
 				err = env.runDonburi(code)
@@ -95,7 +109,7 @@ func (env *Environment) LoadExtensionsForPath(extensions []*schema.Extension, pa
 			} else if extension.CodeType == "go" {
 				callback := ext.GetGoCallback(code)
 				if callback != nil {
-					env.goCallbacks = append(env.goCallbacks, callback)
+					env.goCallbacks = append(env.goCallbacks, goCallback{extensionID: extension.ID, callback: callback})
 				}
 			} else {
 				script, err := env.VM.Compile(extension.URL, code)
@@ -163,7 +177,9 @@ func (env *Environment) HandleEvent(event string, context map[string]interface{}
 		}
 	}
 	for _, callback := range env.goCallbacks {
-		err = callback(event, context)
+		start := time.Now()
+		err = callback.callback(event, context)
+		extensionEventDuration.ObserveSince(start, callback.extensionID, event)
 		if err != nil {
 			return err
 		}
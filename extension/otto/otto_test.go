@@ -251,6 +251,36 @@ var _ = Describe("Otto extension manager", func() {
 				Expect(context).To(HaveKeyWithValue("resp", HaveKeyWithValue("body", "HELLO")))
 				server.Close()
 			})
+
+			It("Should send ID of the request in the context", func() {
+				server := ghttp.NewServer()
+				server.AppendHandlers(ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/contents"),
+					ghttp.VerifyHeaderKV("X-Request-ID", "req-1"),
+					ghttp.RespondWith(200, "HELLO"),
+				))
+
+				extension, err := schema.NewExtension(map[string]interface{}{
+					"id": "test_extension",
+					"code": `
+						gohan_register_handler("test_event", function(context){
+								context.resp = gohan_http('GET', '` + server.URL() + `/contents', {}, {});
+						});`,
+					"path": ".*",
+				})
+				Expect(err).ToNot(HaveOccurred())
+				extensions := []*schema.Extension{extension}
+				env := otto.NewEnvironment(testDB, &middleware.FakeIdentity{})
+				Expect(env.LoadExtensionsForPath(extensions, "test_path")).To(Succeed())
+
+				context := map[string]interface{}{
+					"id":         "test",
+					"request_id": "req-1",
+				}
+				Expect(env.HandleEvent("test_event", context)).To(Succeed())
+				Expect(context).To(HaveKeyWithValue("resp", HaveKeyWithValue("status_code", "200")))
+				server.Close()
+			})
 		})
 
 		Context("When the destination is not reachable", func() {
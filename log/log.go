@@ -76,6 +76,10 @@ func (f *gohanJSONFormatter) Format(calldepth int, record *logging.Record, outpu
 		"msg":            record.Message(),
 		"component_name": record.Module,
 	}
+	if id := recordRequestID(record); id != "" {
+		result["request_id"] = string(id)
+		result["msg"] = strings.TrimPrefix(record.Message(), id.String())
+	}
 	resultJSON, err := json.Marshal(result)
 	if err != nil {
 		return err
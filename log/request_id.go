@@ -0,0 +1,97 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	logging "github.com/op/go-logging"
+)
+
+//RequestIDKey is the key of request ID in contexts of requests
+const RequestIDKey = "request_id"
+
+//requestID is the first argument of log records of a request,
+//formatted as prefix of the message and recorded in request_id of JSON log lines
+type requestID string
+
+func (id requestID) String() string {
+	return "[" + string(id) + "] "
+}
+
+//recordRequestID returns ID of the request of the record, or empty ID
+func recordRequestID(record *logging.Record) requestID {
+	if len(record.Args) == 0 {
+		return ""
+	}
+	id, _ := record.Args[0].(requestID)
+	return id
+}
+
+//RequestLogger logs messages prefixed with ID of a request, so that log lines
+//emitted while serving the request can be correlated
+type RequestLogger struct {
+	logger    *logging.Logger
+	requestID string
+}
+
+//NewRequestLogger makes logger of the request with requestID from logger
+func NewRequestLogger(logger *logging.Logger, requestID string) *RequestLogger {
+	return &RequestLogger{logger: logger, requestID: requestID}
+}
+
+//ContextLogger makes logger of the request with ID in the context from logger
+func ContextLogger(logger *logging.Logger, context map[string]interface{}) *RequestLogger {
+	requestID, _ := context[RequestIDKey].(string)
+	return NewRequestLogger(logger, requestID)
+}
+
+//log logs a message by logf with the request ID as the first argument
+func (rl *RequestLogger) log(logf func(string, ...interface{}), format string, args []interface{}) {
+	if rl.requestID == "" {
+		logf(format, args...)
+		return
+	}
+	logf("%v"+format, append([]interface{}{requestID(rl.requestID)}, args...)...)
+}
+
+//Critical logs a message of the request with critical level
+func (rl *RequestLogger) Critical(format string, args ...interface{}) {
+	rl.log(rl.logger.Critical, format, args)
+}
+
+//Error logs a message of the request with error level
+func (rl *RequestLogger) Error(format string, args ...interface{}) {
+	rl.log(rl.logger.Error, format, args)
+}
+
+//Warning logs a message of the request with warning level
+func (rl *RequestLogger) Warning(format string, args ...interface{}) {
+	rl.log(rl.logger.Warning, format, args)
+}
+
+//Notice logs a message of the request with notice level
+func (rl *RequestLogger) Notice(format string, args ...interface{}) {
+	rl.log(rl.logger.Notice, format, args)
+}
+
+//Info logs a message of the request with info level
+func (rl *RequestLogger) Info(format string, args ...interface{}) {
+	rl.log(rl.logger.Info, format, args)
+}
+
+//Debug logs a message of the request with debug level
+func (rl *RequestLogger) Debug(format string, args ...interface{}) {
+	rl.log(rl.logger.Debug, format, args)
+}
@@ -0,0 +1,335 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//ContentType is the content type of Prometheus text format written by Write
+const ContentType = "text/plain; version=0.0.4"
+
+//DefaultBuckets are upper bounds of histogram buckets for durations in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+//Collector writes metrics in Prometheus text format
+type Collector interface {
+	Name() string
+	Write(w io.Writer) error
+}
+
+var registry = struct {
+	sync.Mutex
+	collectors []Collector
+}{}
+
+//Register registers collector, replacing a collector of the same name
+func Register(collector Collector) {
+	registry.Lock()
+	defer registry.Unlock()
+	for i, registered := range registry.collectors {
+		if registered.Name() == collector.Name() {
+			registry.collectors[i] = collector
+			return
+		}
+	}
+	registry.collectors = append(registry.collectors, collector)
+}
+
+//Write writes all registered metrics in Prometheus text format
+func Write(w io.Writer) error {
+	registry.Lock()
+	collectors := append([]Collector{}, registry.collectors...)
+	registry.Unlock()
+	buffered := bufio.NewWriter(w)
+	for _, collector := range collectors {
+		if err := collector.Write(buffered); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
+
+func writeHeader(w io.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, strings.Replace(help, "\n", " ", -1), name, metricType)
+}
+
+var labelValueReplacer = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+//formatLabels formats label pairs, with extra pairs appended
+func formatLabels(names, values []string, extra ...string) string {
+	pairs := []string{}
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, labelValueReplacer.Replace(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[i], extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+//series keeps values of a metric by label values
+type series struct {
+	name       string
+	help       string
+	labelNames []string
+	mutex      sync.Mutex
+	values     map[string][]string
+}
+
+func newSeries(name, help string, labelNames []string) series {
+	return series{name: name, help: help, labelNames: labelNames, values: map[string][]string{}}
+}
+
+//Name returns the name of the metric
+func (s *series) Name() string {
+	return s.name
+}
+
+//key returns the key of label values, which should be given for all label names
+func (s *series) key(labelValues []string) string {
+	if len(labelValues) != len(s.labelNames) {
+		panic(fmt.Sprintf("%s has labels %v, but %d values are given", s.name, s.labelNames, len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	if _, ok := s.values[key]; !ok {
+		s.values[key] = append([]string{}, labelValues...)
+	}
+	return key
+}
+
+//sortedKeys returns keys of label values in order
+func (s *series) sortedKeys() []string {
+	keys := []string{}
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	series
+	counts map[string]float64
+}
+
+//NewCounterVec makes and registers a counter
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	counter := &CounterVec{series: newSeries(name, help, labelNames), counts: map[string]float64{}}
+	Register(counter)
+	return counter
+}
+
+//Add adds value to the counter of label values
+func (counter *CounterVec) Add(value float64, labelValues ...string) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	counter.counts[counter.key(labelValues)] += value
+}
+
+//Inc increments the counter of label values
+func (counter *CounterVec) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+//Value returns the counter of label values
+func (counter *CounterVec) Value(labelValues ...string) float64 {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	return counter.counts[strings.Join(labelValues, "\xff")]
+}
+
+//Write writes the counter in Prometheus text format
+func (counter *CounterVec) Write(w io.Writer) error {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	writeHeader(w, counter.name, counter.help, "counter")
+	for _, key := range counter.sortedKeys() {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", counter.name,
+			formatLabels(counter.labelNames, counter.values[key]), formatValue(counter.counts[key]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	series
+	gauges map[string]float64
+}
+
+//NewGaugeVec makes and registers a gauge
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	gauge := &GaugeVec{series: newSeries(name, help, labelNames), gauges: map[string]float64{}}
+	Register(gauge)
+	return gauge
+}
+
+//Set sets the gauge of label values
+func (gauge *GaugeVec) Set(value float64, labelValues ...string) {
+	gauge.mutex.Lock()
+	defer gauge.mutex.Unlock()
+	gauge.gauges[gauge.key(labelValues)] = value
+}
+
+//Write writes the gauge in Prometheus text format
+func (gauge *GaugeVec) Write(w io.Writer) error {
+	gauge.mutex.Lock()
+	defer gauge.mutex.Unlock()
+	writeHeader(w, gauge.name, gauge.help, "gauge")
+	for _, key := range gauge.sortedKeys() {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", gauge.name,
+			formatLabels(gauge.labelNames, gauge.values[key]), formatValue(gauge.gauges[key]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//FuncMetric is a gauge or counter whose value is returned by a function when metrics are written
+type FuncMetric struct {
+	name       string
+	help       string
+	metricType string
+	function   func() float64
+}
+
+//NewGaugeFunc makes and registers a gauge of function
+func NewGaugeFunc(name, help string, function func() float64) *FuncMetric {
+	metric := &FuncMetric{name: name, help: help, metricType: "gauge", function: function}
+	Register(metric)
+	return metric
+}
+
+//NewCounterFunc makes and registers a counter of function, which should never decrease
+func NewCounterFunc(name, help string, function func() float64) *FuncMetric {
+	metric := &FuncMetric{name: name, help: help, metricType: "counter", function: function}
+	Register(metric)
+	return metric
+}
+
+//Name returns the name of the metric
+func (metric *FuncMetric) Name() string {
+	return metric.name
+}
+
+//Write writes the metric in Prometheus text format
+func (metric *FuncMetric) Write(w io.Writer) error {
+	writeHeader(w, metric.name, metric.help, metric.metricType)
+	_, err := fmt.Fprintf(w, "%s %s\n", metric.name, formatValue(metric.function()))
+	return err
+}
+
+//histogram keeps observations of label values
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+//HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	series
+	buckets    []float64
+	histograms map[string]*histogram
+}
+
+//NewHistogramVec makes and registers a histogram of buckets with given upper bounds
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	histogramVec := &HistogramVec{
+		series:     newSeries(name, help, labelNames),
+		buckets:    append([]float64{}, buckets...),
+		histograms: map[string]*histogram{},
+	}
+	sort.Float64s(histogramVec.buckets)
+	Register(histogramVec)
+	return histogramVec
+}
+
+//Observe observes value for label values
+func (histogramVec *HistogramVec) Observe(value float64, labelValues ...string) {
+	histogramVec.mutex.Lock()
+	defer histogramVec.mutex.Unlock()
+	key := histogramVec.key(labelValues)
+	observed, ok := histogramVec.histograms[key]
+	if !ok {
+		observed = &histogram{counts: make([]uint64, len(histogramVec.buckets))}
+		histogramVec.histograms[key] = observed
+	}
+	for i, upperBound := range histogramVec.buckets {
+		if value <= upperBound {
+			observed.counts[i]++
+		}
+	}
+	observed.count++
+	observed.sum += value
+}
+
+//ObserveSince observes seconds elapsed since start for label values
+func (histogramVec *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	histogramVec.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+//Write writes the histogram in Prometheus text format
+func (histogramVec *HistogramVec) Write(w io.Writer) error {
+	histogramVec.mutex.Lock()
+	defer histogramVec.mutex.Unlock()
+	writeHeader(w, histogramVec.name, histogramVec.help, "histogram")
+	for _, key := range histogramVec.sortedKeys() {
+		labelValues := histogramVec.values[key]
+		observed := histogramVec.histograms[key]
+		for i, upperBound := range histogramVec.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", histogramVec.name,
+				formatLabels(histogramVec.labelNames, labelValues, "le", formatValue(upperBound)), observed.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", histogramVec.name,
+			formatLabels(histogramVec.labelNames, labelValues, "le", "+Inf"), observed.count)
+		labels := formatLabels(histogramVec.labelNames, labelValues)
+		fmt.Fprintf(w, "%s_sum%s %s\n", histogramVec.name, labels, formatValue(observed.sum))
+		_, err := fmt.Fprintf(w, "%s_count%s %d\n", histogramVec.name, labels, observed.count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics_test
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudwan/gohan/metrics"
+)
+
+var _ = Describe("Metrics", func() {
+	write := func() string {
+		var output bytes.Buffer
+		Expect(metrics.Write(&output)).To(Succeed())
+		return output.String()
+	}
+
+	It("Should write counters and gauges in Prometheus text format", func() {
+		counter := metrics.NewCounterVec("test_requests_total", "Test requests", "schema", "status")
+		counter.Inc("network", "200")
+		counter.Add(2, "network", "200")
+		counter.Inc("sub\"net", "404")
+		metrics.NewGaugeFunc("test_queue_depth", "Test queue depth", func() float64 { return 7 })
+
+		output := write()
+		Expect(output).To(ContainSubstring("# TYPE test_requests_total counter\n"))
+		Expect(output).To(ContainSubstring("test_requests_total{schema=\"network\",status=\"200\"} 3\n"))
+		Expect(output).To(ContainSubstring("test_requests_total{schema=\"sub\\\"net\",status=\"404\"} 1\n"))
+		Expect(output).To(ContainSubstring("# TYPE test_queue_depth gauge\ntest_queue_depth 7\n"))
+		Expect(output).To(ContainSubstring("# TYPE go_goroutines gauge\n"))
+		Expect(counter.Value("network", "200")).To(BeEquivalentTo(3))
+	})
+
+	It("Should write cumulative histogram buckets", func() {
+		histogram := metrics.NewHistogramVec("test_duration_seconds", "Test durations", []float64{1, 0.1}, "action")
+		histogram.Observe(0.05, "read")
+		histogram.Observe(0.5, "read")
+		histogram.Observe(5, "read")
+
+		output := write()
+		Expect(output).To(ContainSubstring("# TYPE test_duration_seconds histogram\n" +
+			"test_duration_seconds_bucket{action=\"read\",le=\"0.1\"} 1\n" +
+			"test_duration_seconds_bucket{action=\"read\",le=\"1\"} 2\n" +
+			"test_duration_seconds_bucket{action=\"read\",le=\"+Inf\"} 3\n" +
+			"test_duration_seconds_sum{action=\"read\"} 5.55\n" +
+			"test_duration_seconds_count{action=\"read\"} 3\n"))
+	})
+
+	It("Should replace metrics registered by the same name", func() {
+		metrics.NewGaugeVec("test_replaced", "Test gauge").Set(1)
+		metrics.NewGaugeVec("test_replaced", "Test gauge").Set(2)
+		output := write()
+		Expect(output).To(ContainSubstring("test_replaced 2\n"))
+		Expect(output).ToNot(ContainSubstring("test_replaced 1\n"))
+	})
+})
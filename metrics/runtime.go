@@ -0,0 +1,72 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+func init() {
+	Register(runtimeCollector{})
+}
+
+//runtimeCollector writes statistics of Go runtime
+type runtimeCollector struct{}
+
+//Name returns the name of the collector
+func (runtimeCollector) Name() string {
+	return "go"
+}
+
+//Write writes statistics of Go runtime in Prometheus text format
+func (runtimeCollector) Write(w io.Writer) error {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	gauges := []struct {
+		name  string
+		help  string
+		value float64
+	}{
+		{"go_goroutines", "Number of goroutines", float64(runtime.NumGoroutine())},
+		{"go_memstats_alloc_bytes", "Bytes of allocated heap objects", float64(memStats.Alloc)},
+		{"go_memstats_sys_bytes", "Bytes of memory obtained from the OS", float64(memStats.Sys)},
+		{"go_memstats_heap_objects", "Number of allocated heap objects", float64(memStats.HeapObjects)},
+		{"go_memstats_last_gc_time_seconds", "Time of the last garbage collection since epoch", float64(memStats.LastGC) / float64(time.Second)},
+	}
+	for _, gauge := range gauges {
+		writeHeader(w, gauge.name, gauge.help, "gauge")
+		fmt.Fprintf(w, "%s %s\n", gauge.name, formatValue(gauge.value))
+	}
+	counters := []struct {
+		name  string
+		help  string
+		value float64
+	}{
+		{"go_memstats_alloc_bytes_total", "Bytes allocated for heap objects", float64(memStats.TotalAlloc)},
+		{"go_gc_count_total", "Number of completed garbage collections", float64(memStats.NumGC)},
+		{"go_gc_pause_seconds_total", "Seconds of garbage collection pauses", float64(memStats.PauseTotalNs) / float64(time.Second)},
+	}
+	for _, counter := range counters {
+		writeHeader(w, counter.name, counter.help, "counter")
+		if _, err := fmt.Fprintf(w, "%s %s\n", counter.name, formatValue(counter.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -17,10 +17,11 @@ package schema
 
 // Action struct
 type Action struct {
-	ID          string
-	Method      string
-	Path        string
-	InputSchema map[string]interface{}
+	ID           string
+	Method       string
+	Path         string
+	InputSchema  map[string]interface{}
+	Translations Translations
 }
 
 // NewAction create Action
@@ -39,5 +40,7 @@ func NewActionFromObject(id string, rawData interface{}) (Action, error) {
 	method, _ := actionData["method"].(string)
 	path, _ := actionData["path"].(string)
 	inputSchema, _ := actionData["input"]
-	return NewAction(id, method, path, inputSchema.(map[string]interface{})), nil
+	action := NewAction(id, method, path, inputSchema.(map[string]interface{}))
+	action.Translations = NewTranslations(actionData[i18nKey])
+	return action, nil
 }
@@ -0,0 +1,154 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"text/template"
+)
+
+//ComputedFunction computes value of a computed property
+type ComputedFunction func(resource *Resource) (interface{}, error)
+
+var computedFunctions = map[string]ComputedFunction{}
+
+//RegisterComputedFunction registers go function which can be referenced by computed properties
+func RegisterComputedFunction(name string, function ComputedFunction) {
+	computedFunctions[name] = function
+}
+
+//Computed describes how value of a computed property is derived.
+//Either Template or Function is set.
+type Computed struct {
+	Template *template.Template
+	Function string
+}
+
+//NewComputedFromObj makes Computed from obj
+func NewComputedFromObj(id string, raw interface{}) (*Computed, error) {
+	computedData, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("computed definition of %s should be an object", id)
+	}
+	computed := &Computed{}
+	computed.Function, _ = computedData["function"].(string)
+	templateString, _ := computedData["template"].(string)
+	if templateString != "" {
+		if computed.Function != "" {
+			return nil, fmt.Errorf("computed property %s can't have both template and function", id)
+		}
+		tmpl, err := template.New(id).Parse(templateString)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template of %s: %s", id, err)
+		}
+		computed.Template = tmpl
+	} else if computed.Function == "" {
+		return nil, fmt.Errorf("computed property %s needs template or function", id)
+	}
+	return computed, nil
+}
+
+//Compute computes value of property for resource
+func (computed *Computed) Compute(property *Property, resource *Resource) (interface{}, error) {
+	if computed.Function != "" {
+		function, ok := computedFunctions[computed.Function]
+		if !ok {
+			return nil, fmt.Errorf("computed function %s is not registered", computed.Function)
+		}
+		return function(resource)
+	}
+	b := bytes.NewBuffer(make([]byte, 0, 100))
+	err := computed.Template.Execute(b, resource.Data())
+	if err != nil {
+		return nil, err
+	}
+	switch property.Type {
+	case "integer":
+		return strconv.ParseInt(b.String(), 10, 64)
+	case "number":
+		return strconv.ParseFloat(b.String(), 64)
+	case "boolean":
+		return strconv.ParseBool(b.String())
+	}
+	return b.String(), nil
+}
+
+//IsComputed checks if property value is computed rather than stored
+func (property *Property) IsComputed() bool {
+	return property.Computed != nil
+}
+
+//SplitComputedFilter separates filters on computed properties, which can't be
+//evaluated by the database, from filters on stored properties
+func (schema *Schema) SplitComputedFilter(filter map[string]interface{}) (stored, computed map[string]interface{}) {
+	if filter == nil {
+		return nil, nil
+	}
+	stored = map[string]interface{}{}
+	computed = map[string]interface{}{}
+	for key, value := range filter {
+		property, err := schema.GetPropertyByID(key)
+		if err == nil && property.IsComputed() {
+			computed[key] = value
+		} else {
+			stored[key] = value
+		}
+	}
+	return
+}
+
+//PopulateComputed sets values of computed properties
+func (resource *Resource) PopulateComputed() error {
+	for _, property := range resource.schema.Properties {
+		if !property.IsComputed() {
+			continue
+		}
+		value, err := property.Computed.Compute(&property, resource)
+		if err != nil {
+			return fmt.Errorf("failed to compute %s: %s", property.ID, err)
+		}
+		resource.properties[property.ID] = value
+	}
+	return nil
+}
+
+//MatchFilter checks if resource values match filter
+//Filter values are a value or a list of values, compared as strings
+func (resource *Resource) MatchFilter(filter map[string]interface{}) bool {
+	for key, value := range filter {
+		actual := fmt.Sprint(resource.properties[key])
+		switch value := value.(type) {
+		case []string:
+			matched := false
+			for _, v := range value {
+				if v == actual {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		default:
+			if fmt.Sprint(value) != actual {
+				return false
+			}
+		}
+	}
+	return true
+}
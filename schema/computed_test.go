@@ -0,0 +1,107 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Computed properties", func() {
+	var s *Schema
+
+	BeforeEach(func() {
+		RegisterComputedFunction("name_length", func(resource *Resource) (interface{}, error) {
+			name, _ := resource.Get("name").(string)
+			return len(name), nil
+		})
+		var err error
+		s, err = NewSchemaFromObj(map[string]interface{}{
+			"id":          "computed",
+			"plural":      "computeds",
+			"singular":    "computed",
+			"title":       "Computed",
+			"description": "Computed",
+			"schema": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"id": map[string]interface{}{
+						"type":       "string",
+						"permission": []interface{}{"create"},
+					},
+					"name": map[string]interface{}{
+						"type":       "string",
+						"permission": []interface{}{"create", "update"},
+					},
+					"display_name": map[string]interface{}{
+						"type":       "string",
+						"permission": []interface{}{"create", "update"},
+						"computed":   map[string]interface{}{"template": "{{.name}} ({{.id}})"},
+					},
+					"name_length": map[string]interface{}{
+						"type":     "integer",
+						"computed": map[string]interface{}{"function": "name_length"},
+					},
+				},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Populates values from template and function", func() {
+		resource, err := NewResource(s, map[string]interface{}{"id": "red", "name": "Red"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resource.PopulateComputed()).To(Succeed())
+		Expect(resource.Get("display_name")).To(Equal("Red (red)"))
+		Expect(resource.Get("name_length")).To(Equal(3))
+	})
+
+	It("Reports unregistered functions", func() {
+		property, err := s.GetPropertyByID("name_length")
+		Expect(err).ToNot(HaveOccurred())
+		property.Computed.Function = "unknown"
+		resource, _ := NewResource(s, map[string]interface{}{"id": "red"})
+		_, err = property.Computed.Compute(property, resource)
+		Expect(err).To(MatchError("computed function unknown is not registered"))
+	})
+
+	It("Rejects computed values on input", func() {
+		Expect(s.ValidateOnCreate(map[string]interface{}{"id": "red", "name": "Red"})).To(Succeed())
+		Expect(s.ValidateOnCreate(map[string]interface{}{"id": "red", "display_name": "Red"})).ToNot(Succeed())
+		Expect(s.ValidateOnUpdate(map[string]interface{}{"display_name": "Red"})).ToNot(Succeed())
+	})
+
+	It("Splits filters on computed properties", func() {
+		stored, computed := s.SplitComputedFilter(map[string]interface{}{
+			"name":         []string{"Red"},
+			"display_name": []string{"Red (red)"},
+		})
+		Expect(stored).To(Equal(map[string]interface{}{"name": []string{"Red"}}))
+		Expect(computed).To(Equal(map[string]interface{}{"display_name": []string{"Red (red)"}}))
+	})
+
+	It("Matches filters against resource values", func() {
+		resource, _ := NewResource(s, map[string]interface{}{"id": "red", "name": "Red"})
+		Expect(resource.PopulateComputed()).To(Succeed())
+		Expect(resource.MatchFilter(map[string]interface{}{"name_length": []string{"2", "3"}})).To(BeTrue())
+		Expect(resource.MatchFilter(map[string]interface{}{"display_name": "Red (red)"})).To(BeTrue())
+		Expect(resource.MatchFilter(map[string]interface{}{"display_name": []string{"Blue (blue)"}})).To(BeFalse())
+	})
+
+	It("Requires template or function", func() {
+		_, err := NewComputedFromObj("broken", map[string]interface{}{})
+		Expect(err).To(MatchError("computed property broken needs template or function"))
+	})
+})
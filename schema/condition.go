@@ -0,0 +1,231 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+)
+
+//Comparison operators of attribute conditions
+const (
+	OperatorEq    = "eq"
+	OperatorNe    = "ne"
+	OperatorLt    = "lt"
+	OperatorLe    = "le"
+	OperatorGt    = "gt"
+	OperatorGe    = "ge"
+	OperatorIn    = "in"
+	OperatorNotIn = "not_in"
+)
+
+//ConditionsFilterKey is a key of list filter holding comparisons required by policy
+const ConditionsFilterKey = "_conditions"
+
+//ExclusionsFilterKey is a key of list filter holding groups of comparisons of deny policies,
+//resources satisfying all comparisons of any group are excluded
+const ExclusionsFilterKey = "_exclusions"
+
+var operatorAliases = map[string]string{
+	"==": OperatorEq,
+	"!=": OperatorNe,
+	"<":  OperatorLt,
+	"<=": OperatorLe,
+	">":  OperatorGt,
+	">=": OperatorGe,
+}
+
+var operators = []string{
+	OperatorEq, OperatorNe, OperatorLt, OperatorLe, OperatorGt, OperatorGe, OperatorIn, OperatorNotIn,
+}
+
+//requestFields are values of request which can be compared with resource properties
+var requestFields = map[string]func(Authorization) interface{}{
+	"tenant_id":   func(auth Authorization) interface{} { return auth.TenantID() },
+	"tenant_name": func(auth Authorization) interface{} { return auth.TenantName() },
+}
+
+//Comparison compares a property of resources with a value
+type Comparison struct {
+	Property string
+	Operator string
+	Value    interface{}
+}
+
+func (c Comparison) String() string {
+	return fmt.Sprintf("%s %s %v", c.Property, c.Operator, c.Value)
+}
+
+//AttributeCondition requires a property of resources to compare
+//with a constant value or with a field of request
+type AttributeCondition struct {
+	Comparison
+	RequestField string
+}
+
+func newAttributeCondition(policyID string, conditionObject map[string]interface{}) (*AttributeCondition, error) {
+	condition := &AttributeCondition{}
+	condition.Property, _ = conditionObject["property"].(string)
+	if condition.Property == "" {
+		return nil, fmt.Errorf("Condition %s of policy '%s' should have property", conditionTypeAttribute, policyID)
+	}
+	operator, _ := conditionObject["operator"].(string)
+	if operator == "" {
+		operator = OperatorEq
+	}
+	if alias, ok := operatorAliases[operator]; ok {
+		operator = alias
+	}
+	if !containsString(operators, operator) {
+		return nil, fmt.Errorf("Unknown operator '%s' in condition of policy '%s'", operator, policyID)
+	}
+	condition.Operator = operator
+	condition.Value = conditionObject["value"]
+	condition.RequestField, _ = conditionObject["request"].(string)
+	if condition.RequestField != "" {
+		if _, ok := requestFields[condition.RequestField]; !ok {
+			return nil, fmt.Errorf("Unknown request field '%s' in condition of policy '%s'", condition.RequestField, policyID)
+		}
+	}
+	if (operator == OperatorIn || operator == OperatorNotIn) && condition.RequestField == "" {
+		if _, ok := condition.Value.([]interface{}); !ok {
+			return nil, fmt.Errorf("Operator %s in condition of policy '%s' needs list value", operator, policyID)
+		}
+	}
+	return condition, nil
+}
+
+//Resolve returns comparison with value of request field filled in
+func (c *AttributeCondition) Resolve(auth Authorization) Comparison {
+	comparison := c.Comparison
+	if c.RequestField != "" {
+		comparison.Value = requestFields[c.RequestField](auth)
+	}
+	return comparison
+}
+
+//Match checks if resource data satisfies the comparison
+func (c Comparison) Match(data map[string]interface{}) bool {
+	value := data[c.Property]
+	switch c.Operator {
+	case OperatorEq:
+		return equalValues(value, c.Value)
+	case OperatorNe:
+		return !equalValues(value, c.Value)
+	case OperatorIn, OperatorNotIn:
+		found := false
+		for _, candidate := range listValue(c.Value) {
+			if equalValues(value, candidate) {
+				found = true
+				break
+			}
+		}
+		return found == (c.Operator == OperatorIn)
+	}
+	result, ok := compareValues(value, c.Value)
+	if !ok {
+		return false
+	}
+	switch c.Operator {
+	case OperatorLt:
+		return result < 0
+	case OperatorLe:
+		return result <= 0
+	case OperatorGt:
+		return result > 0
+	case OperatorGe:
+		return result >= 0
+	}
+	return false
+}
+
+//MatchAll checks if resource data satisfies all comparisons
+func MatchAll(comparisons []Comparison, data map[string]interface{}) bool {
+	for _, comparison := range comparisons {
+		if !comparison.Match(data) {
+			return false
+		}
+	}
+	return true
+}
+
+func listValue(value interface{}) []interface{} {
+	switch value := value.(type) {
+	case []interface{}:
+		return value
+	case []string:
+		list := make([]interface{}, len(value))
+		for i, item := range value {
+			list[i] = item
+		}
+		return list
+	}
+	return []interface{}{value}
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
+
+//equalValues compares values loaded from json, yaml and databases,
+//where numbers and booleans may have different types
+func equalValues(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if result, ok := compareValues(a, b); ok {
+		return result == 0
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+//compareValues compares numbers numerically and strings lexically, like databases compare
+//numeric and string columns. Numbers and strings aren't compared with each other
+func compareValues(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	numberA, okA := toFloat(a)
+	numberB, okB := toFloat(b)
+	if okA && okB {
+		switch {
+		case numberA < numberB:
+			return -1, true
+		case numberA > numberB:
+			return 1, true
+		}
+		return 0, true
+	}
+	stringA, okA := a.(string)
+	stringB, okB := b.(string)
+	if okA && okB {
+		switch {
+		case stringA < stringB:
+			return -1, true
+		case stringA > stringB:
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
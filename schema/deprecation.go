@@ -0,0 +1,145 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//Version statuses shown in version discovery
+const (
+	VersionCurrent    = "CURRENT"
+	VersionSupported  = "SUPPORTED"
+	VersionDeprecated = "DEPRECATED"
+)
+
+//deprecationDateFormats are accepted formats of deprecated and sunset dates
+var deprecationDateFormats = []string{"2006-01-02", time.RFC3339}
+
+//Deprecation describes since when an API is deprecated and when it will be removed
+type Deprecation struct {
+	Date   *time.Time
+	Sunset *time.Time
+}
+
+func parseDeprecationDate(raw interface{}, key string) (*time.Time, error) {
+	switch value := raw.(type) {
+	case nil:
+		return nil, nil
+	case time.Time:
+		return &value, nil
+	case string:
+		if value == "" {
+			return nil, nil
+		}
+		for _, format := range deprecationDateFormats {
+			if date, err := time.Parse(format, value); err == nil {
+				return &date, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("Invalid %s date %v, expected YYYY-MM-DD or RFC3339", key, raw)
+}
+
+//NewDeprecation makes deprecation from deprecated and sunset dates of raw object
+//It returns nil if neither of them is declared
+func NewDeprecation(raw map[string]interface{}) (*Deprecation, error) {
+	date, err := parseDeprecationDate(raw["deprecated"], "deprecated")
+	if err != nil {
+		return nil, err
+	}
+	sunset, err := parseDeprecationDate(raw["sunset"], "sunset")
+	if err != nil {
+		return nil, err
+	}
+	if date == nil && sunset == nil {
+		return nil, nil
+	}
+	return &Deprecation{Date: date, Sunset: sunset}, nil
+}
+
+//IsDeprecated checks if API is deprecated at the time
+func (deprecation *Deprecation) IsDeprecated(now time.Time) bool {
+	if deprecation == nil {
+		return false
+	}
+	if deprecation.Date != nil && !now.Before(*deprecation.Date) {
+		return true
+	}
+	return deprecation.Sunset != nil && !now.Before(*deprecation.Sunset)
+}
+
+//DateString returns deprecation date in RFC3339 format, or empty string
+func (deprecation *Deprecation) DateString() string {
+	if deprecation == nil || deprecation.Date == nil {
+		return ""
+	}
+	return deprecation.Date.UTC().Format(time.RFC3339)
+}
+
+//SunsetString returns sunset date in RFC3339 format, or empty string
+func (deprecation *Deprecation) SunsetString() string {
+	if deprecation == nil || deprecation.Sunset == nil {
+		return ""
+	}
+	return deprecation.Sunset.UTC().Format(time.RFC3339)
+}
+
+//SetHeaders sets Deprecation and Sunset headers of response
+//Deprecation header holds unix time of the date, Sunset header holds HTTP date
+func (deprecation *Deprecation) SetHeaders(header http.Header) {
+	if deprecation == nil {
+		return
+	}
+	if deprecation.Date != nil {
+		header.Set("Deprecation", "@"+strconv.FormatInt(deprecation.Date.Unix(), 10))
+	}
+	if deprecation.Sunset != nil {
+		header.Set("Sunset", deprecation.Sunset.UTC().Format(http.TimeFormat))
+	}
+}
+
+//GetDeprecation returns deprecation of namespace, or of its closest deprecated parent
+func (namespace *Namespace) GetDeprecation() *Deprecation {
+	for current := namespace; current != nil; current = current.ParentNamespace {
+		if current.Deprecation != nil {
+			return current.Deprecation
+		}
+	}
+	return nil
+}
+
+//GetDeprecation returns deprecation of schema, or of its namespace
+func (schema *Schema) GetDeprecation() *Deprecation {
+	if schema.Deprecation != nil {
+		return schema.Deprecation
+	}
+	if schema.Namespace != nil {
+		return schema.Namespace.GetDeprecation()
+	}
+	return nil
+}
+
+//VersionStatus returns status of namespace shown in version discovery
+func (namespace *Namespace) VersionStatus(now time.Time) string {
+	if namespace.GetDeprecation().IsDeprecated(now) {
+		return VersionDeprecated
+	}
+	return VersionSupported
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Deprecation", func() {
+	var (
+		parent *Namespace
+		child  *Namespace
+	)
+
+	BeforeEach(func() {
+		var err error
+		parent, err = NewNamespace(map[string]interface{}{
+			"id":         "v1",
+			"prefix":     "v1",
+			"deprecated": "2016-01-01",
+			"sunset":     "2016-07-01T00:00:00Z",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		child, err = NewNamespace(map[string]interface{}{
+			"id":     "v1_network",
+			"prefix": "network",
+			"parent": "v1",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		child.SetParentNamespace(parent)
+	})
+
+	AfterEach(func() {
+		ClearManager()
+	})
+
+	It("Parses deprecated and sunset dates", func() {
+		deprecation := parent.Deprecation
+		Expect(deprecation).ToNot(BeNil())
+		Expect(deprecation.DateString()).To(Equal("2016-01-01T00:00:00Z"))
+		Expect(deprecation.SunsetString()).To(Equal("2016-07-01T00:00:00Z"))
+	})
+
+	It("Rejects invalid dates", func() {
+		_, err := NewNamespace(map[string]interface{}{"id": "v1", "deprecated": "soon"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Doesn't deprecate namespaces without dates", func() {
+		namespace, err := NewNamespace(map[string]interface{}{"id": "v2"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(namespace.GetDeprecation()).To(BeNil())
+		Expect(namespace.VersionStatus(time.Now())).To(Equal(VersionSupported))
+	})
+
+	It("Inherits deprecation of parent namespaces", func() {
+		Expect(child.GetDeprecation()).To(Equal(parent.Deprecation))
+		schema := NewSchema("network", "networks", "Network", "Network", "network")
+		schema.SetNamespace(child)
+		Expect(schema.GetDeprecation()).To(Equal(parent.Deprecation))
+	})
+
+	It("Becomes deprecated at the deprecation date", func() {
+		before := time.Date(2015, 12, 31, 0, 0, 0, 0, time.UTC)
+		after := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+		Expect(child.VersionStatus(before)).To(Equal(VersionSupported))
+		Expect(child.VersionStatus(after)).To(Equal(VersionDeprecated))
+	})
+
+	It("Sets deprecation headers", func() {
+		header := http.Header{}
+		parent.Deprecation.SetHeaders(header)
+		Expect(header.Get("Deprecation")).To(Equal("@1451606400"))
+		Expect(header.Get("Sunset")).To(Equal("Fri, 01 Jul 2016 00:00:00 GMT"))
+	})
+
+	It("Prefers deprecation of schema", func() {
+		schema, err := NewSchemaFromObj(map[string]interface{}{
+			"id":          "network",
+			"plural":      "networks",
+			"singular":    "network",
+			"title":       "Network",
+			"description": "Network",
+			"deprecated":  "2017-01-01",
+			"schema": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		schema.SetNamespace(child)
+		Expect(schema.GetDeprecation().DateString()).To(Equal("2017-01-01T00:00:00Z"))
+		Expect(schema.GetDeprecation().Sunset).To(BeNil())
+	})
+})
@@ -0,0 +1,131 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import "strings"
+
+//PolicyEvaluation describes why a policy matches a request or not
+type PolicyEvaluation struct {
+	ID        string `json:"id"`
+	Principal string `json:"principal"`
+	Action    string `json:"action"`
+	Effect    string `json:"effect"`
+	Priority  int    `json:"priority"`
+	Matched   bool   `json:"matched"`
+	Selected  bool   `json:"selected"`
+	Reason    string `json:"reason"`
+}
+
+//PolicyExplanation describes how policies are applied to a request
+type PolicyExplanation struct {
+	Action          string              `json:"action"`
+	Path            string              `json:"path"`
+	TenantID        string              `json:"tenant_id"`
+	TenantName      string              `json:"tenant_name"`
+	UserID          string              `json:"user_id,omitempty"`
+	Groups          []string            `json:"groups,omitempty"`
+	Anonymous       bool                `json:"anonymous,omitempty"`
+	Roles           []string            `json:"roles"`
+	Policies        []*PolicyEvaluation `json:"policies"`
+	Allowed         bool                `json:"allowed"`
+	Policy          string              `json:"policy,omitempty"`
+	DeniedBy        string              `json:"denied_by,omitempty"`
+	Role            string              `json:"role,omitempty"`
+	Effect          string              `json:"effect,omitempty"`
+	Properties      []interface{}       `json:"properties,omitempty"`
+	TenantFilter    []string            `json:"tenant_filter,omitempty"`
+	TagFilter       []string            `json:"tag_filter,omitempty"`
+	AttributeFilter []string            `json:"attribute_filter,omitempty"`
+	ExclusionFilter []string            `json:"exclusion_filter,omitempty"`
+}
+
+//ExplainPolicies evaluates all policies for the request and describes the result
+func ExplainPolicies(action, path string, auth Authorization, policies []*Policy) *PolicyExplanation {
+	return explainPolicies(action, path, auth, policies, nil)
+}
+
+func explainPolicies(action, path string, auth Authorization, policies []*Policy, hierarchy RoleHierarchy) *PolicyExplanation {
+	explanation := &PolicyExplanation{
+		Action:     action,
+		Path:       path,
+		TenantID:   auth.TenantID(),
+		TenantName: auth.TenantName(),
+		UserID:     auth.UserID(),
+		Groups:     auth.Groups(),
+		Anonymous:  auth.Anonymous(),
+		Roles:      []string{},
+		Policies:   []*PolicyEvaluation{},
+	}
+	for _, role := range auth.Roles() {
+		explanation.Roles = append(explanation.Roles, role.Name)
+	}
+	selected, selectedRole, deniedBy, denials := evaluatePolicies(action, path, auth, policies, hierarchy)
+	for _, policy := range policies {
+		role, reason := policy.explainMatch(action, path, auth, hierarchy)
+		evaluation := &PolicyEvaluation{
+			ID:        policy.ID,
+			Principal: policy.Principal,
+			Action:    policy.Action,
+			Effect:    policy.Effect,
+			Priority:  policy.Priority,
+			Matched:   role != nil,
+			Reason:    reason,
+		}
+		switch {
+		case role == nil || policy == deniedBy:
+		case deniedBy != nil:
+			evaluation.Reason += ", but policy " + deniedBy.ID + " denies the request"
+		case policy.deniesConditionally(action):
+			evaluation.Reason += ", applied to resources matching its conditions"
+		case policy == selected:
+			evaluation.Selected = true
+		default:
+			evaluation.Reason += ", but policy " + selected.ID + " is applied"
+		}
+		explanation.Policies = append(explanation.Policies, evaluation)
+	}
+	if deniedBy != nil {
+		explanation.DeniedBy = deniedBy.ID
+		explanation.Effect = EffectDeny
+		return explanation
+	}
+	if selected == nil {
+		return explanation
+	}
+	explanation.Allowed = true
+	explanation.Policy = selected.ID
+	explanation.Role = selectedRole.Name
+	explanation.Effect = selected.Effect
+	explanation.Properties = selected.Resource.Properties
+	explanation.TenantFilter = selected.GetTenantIDFilter(action, auth.TenantID())
+	explanation.TagFilter = selected.GetTagFilter(action)
+	for _, comparison := range selected.GetAttributeFilter(action, auth) {
+		explanation.AttributeFilter = append(explanation.AttributeFilter, comparison.String())
+	}
+	for _, comparisons := range selected.withDenials(denials).GetExclusionFilter(action, auth) {
+		conditions := []string{}
+		for _, comparison := range comparisons {
+			conditions = append(conditions, comparison.String())
+		}
+		explanation.ExclusionFilter = append(explanation.ExclusionFilter, strings.Join(conditions, " and "))
+	}
+	return explanation
+}
+
+//ExplainPolicies describes how policies of manager are applied to the request
+func (manager *Manager) ExplainPolicies(action, path string, auth Authorization) *PolicyExplanation {
+	return explainPolicies(action, path, auth, manager.policies, manager.roleHierarchy)
+}
@@ -16,9 +16,13 @@
 package schema
 
 import (
+	"bytes"
 	"net"
+	"net/mail"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/twinj/uuid"
 	"github.com/xeipuuv/gojsonschema"
@@ -34,6 +38,29 @@ type nonHyphenatedUUIDFormatChecker struct{}
 type portFormatChecker struct{}
 type yamlFormatChecker struct{}
 type textFormatChecker struct{}
+type ipv6FormatChecker struct{}
+type ipv6CIDRFormatChecker struct{}
+type ipRangeFormatChecker struct{}
+type vlanIDFormatChecker struct{}
+type asnFormatChecker struct{}
+type hostnameFormatChecker struct{}
+type fqdnFormatChecker struct{}
+type routeDistinguisherFormatChecker struct{}
+type emailFormatChecker struct{}
+type semverFormatChecker struct{}
+type durationFormatChecker struct{}
+
+//FormatChecker validates string values of properties with a given format
+type FormatChecker interface {
+	IsFormat(input string) bool
+}
+
+var (
+	hostnameLabelRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+	semverRegexp        = regexp.MustCompile(`^(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)` +
+		`(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+	customFormatCheckers = map[string]FormatChecker{}
+)
 
 func (f macFormatChecker) IsFormat(input string) bool {
 	match, _ := regexp.MatchString(`^([0-9A-Fa-f]{2}:){5}[0-9A-Fa-f]{2}$`, input)
@@ -84,15 +111,155 @@ func (f textFormatChecker) IsFormat(input string) bool {
 	return true
 }
 
+func (f ipv6FormatChecker) IsFormat(input string) bool {
+	ip := net.ParseIP(input)
+	return ip != nil && strings.Contains(input, ":")
+}
+
+func (f ipv6CIDRFormatChecker) IsFormat(input string) bool {
+	_, _, err := net.ParseCIDR(input)
+	return err == nil && strings.Contains(input, ":")
+}
+
+func (f ipRangeFormatChecker) IsFormat(input string) bool {
+	addresses := strings.Split(input, "-")
+	if len(addresses) != 2 {
+		return false
+	}
+	start := net.ParseIP(strings.TrimSpace(addresses[0]))
+	end := net.ParseIP(strings.TrimSpace(addresses[1]))
+	if start == nil || end == nil {
+		return false
+	}
+	if (start.To4() == nil) != (end.To4() == nil) {
+		return false
+	}
+	return bytes.Compare(start.To16(), end.To16()) <= 0
+}
+
+func (f vlanIDFormatChecker) IsFormat(input string) bool {
+	vlanID, err := strconv.ParseInt(input, 10, 0)
+	return err == nil && 1 <= vlanID && vlanID <= 4094
+}
+
+func (f asnFormatChecker) IsFormat(input string) bool {
+	// Both asplain (65536) and asdot (1.0) notations are accepted
+	if parts := strings.Split(input, "."); len(parts) == 2 {
+		_, highErr := strconv.ParseUint(parts[0], 10, 16)
+		_, lowErr := strconv.ParseUint(parts[1], 10, 16)
+		return highErr == nil && lowErr == nil
+	}
+	asn, err := strconv.ParseUint(input, 10, 32)
+	return err == nil && asn >= 1
+}
+
+func (f hostnameFormatChecker) IsFormat(input string) bool {
+	input = strings.TrimSuffix(input, ".")
+	if input == "" || len(input) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(input, ".") {
+		if !hostnameLabelRegexp.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f fqdnFormatChecker) IsFormat(input string) bool {
+	return hostnameFormatChecker{}.IsFormat(input) && strings.Contains(strings.TrimSuffix(input, "."), ".")
+}
+
+func (f routeDistinguisherFormatChecker) IsFormat(input string) bool {
+	index := strings.LastIndex(input, ":")
+	if index < 0 {
+		return false
+	}
+	administrator, assigned := input[:index], input[index+1:]
+	if ip := net.ParseIP(administrator); ip != nil {
+		// Type 1: IPv4 address followed by a 2 byte number
+		_, err := strconv.ParseUint(assigned, 10, 16)
+		return ip.To4() != nil && err == nil
+	}
+	asn, err := strconv.ParseUint(administrator, 10, 32)
+	if err != nil {
+		return false
+	}
+	if asn <= 65535 {
+		// Type 0: 2 byte ASN followed by a 4 byte number
+		_, err = strconv.ParseUint(assigned, 10, 32)
+	} else {
+		// Type 2: 4 byte ASN followed by a 2 byte number
+		_, err = strconv.ParseUint(assigned, 10, 16)
+	}
+	return err == nil
+}
+
+func (f emailFormatChecker) IsFormat(input string) bool {
+	address, err := mail.ParseAddress(input)
+	return err == nil && address.Address == input
+}
+
+func (f semverFormatChecker) IsFormat(input string) bool {
+	return semverRegexp.MatchString(input)
+}
+
+func (f durationFormatChecker) IsFormat(input string) bool {
+	_, err := time.ParseDuration(input)
+	return err == nil
+}
+
+//RegisterFormatChecker registers custom format checker which can be used in schema properties
+func RegisterFormatChecker(name string, checker FormatChecker) {
+	customFormatCheckers[name] = checker
+	gojsonschema.FormatCheckers.Add(name, checker)
+}
+
+//IsFormat checks input against format checker registered for the format,
+//including formats built in JSON schema validator such as ipv4 and date-time.
+//Input is considered valid when no checker is registered for the format.
+func IsFormat(format, input string) bool {
+	if checker, ok := customFormatCheckers[format]; ok {
+		return checker.IsFormat(input)
+	}
+	if checker, ok := gohanFormatCheckers[format]; ok {
+		return checker.IsFormat(input)
+	}
+	if gojsonschema.FormatCheckers.Has(format) {
+		return gojsonschema.FormatCheckers.IsFormat(format, input)
+	}
+	return true
+}
+
+var gohanFormatCheckers = map[string]FormatChecker{
+	"mac":                 macFormatChecker{},
+	"cidr":                cidrFormatChecker{},
+	"cidr-or-ipv4":        cidrOrIPv4FormatChecker{},
+	"regex":               regexFormatChecker{},
+	"uuid":                uuidFormatChecker{},
+	"hyph-uuid":           hyphenatedUUIDFormatChecker{},
+	"non-hyph-uuid":       nonHyphenatedUUIDFormatChecker{},
+	"port":                portFormatChecker{},
+	"yaml":                yamlFormatChecker{},
+	"text":                textFormatChecker{},
+	"ipv6":                ipv6FormatChecker{},
+	"ipv6-cidr":           ipv6CIDRFormatChecker{},
+	"ip-range":            ipRangeFormatChecker{},
+	"vlan-id":             vlanIDFormatChecker{},
+	"asn":                 asnFormatChecker{},
+	"hostname":            hostnameFormatChecker{},
+	"fqdn":                fqdnFormatChecker{},
+	"route-distinguisher": routeDistinguisherFormatChecker{},
+	"email":               emailFormatChecker{},
+	"semver":              semverFormatChecker{},
+	"duration":            durationFormatChecker{},
+}
+
 func registerGohanFormats(checkers gojsonschema.FormatCheckerChain) {
-	checkers.Add("mac", macFormatChecker{})
-	checkers.Add("cidr", cidrFormatChecker{})
-	checkers.Add("cidr-or-ipv4", cidrOrIPv4FormatChecker{})
-	checkers.Add("regex", regexFormatChecker{})
-	checkers.Add("uuid", uuidFormatChecker{})
-	checkers.Add("hyph-uuid", hyphenatedUUIDFormatChecker{})
-	checkers.Add("non-hyph-uuid", nonHyphenatedUUIDFormatChecker{})
-	checkers.Add("port", portFormatChecker{})
-	checkers.Add("yaml", yamlFormatChecker{})
-	checkers.Add("text", textFormatChecker{})
+	for name, checker := range gohanFormatCheckers {
+		checkers.Add(name, checker)
+	}
+	for name, checker := range customFormatCheckers {
+		checkers.Add(name, checker)
+	}
 }
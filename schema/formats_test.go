@@ -295,4 +295,254 @@ var _ = Describe("format checkers", func() {
 			Expect(result).To(Equal(false))
 		})
 	})
+	Describe("IPv6 format checker", func() {
+		BeforeEach(func() {
+			formatChecker = ipv6FormatChecker{}
+		})
+
+		It("Should pass", func() {
+			result := formatChecker.IsFormat("fe80::1")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should pass - IPv4-mapped", func() {
+			result := formatChecker.IsFormat("::ffff:1.2.3.4")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should not pass - IPv4", func() {
+			result := formatChecker.IsFormat("127.0.0.1")
+			Expect(result).To(Equal(false))
+		})
+
+		It("Should not pass - CIDR", func() {
+			result := formatChecker.IsFormat("fe80::1/64")
+			Expect(result).To(Equal(false))
+		})
+	})
+
+	Describe("IPv6 CIDR format checker", func() {
+		BeforeEach(func() {
+			formatChecker = ipv6CIDRFormatChecker{}
+		})
+
+		It("Should pass", func() {
+			result := formatChecker.IsFormat("2001:db8::/32")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should not pass - IPv4 CIDR", func() {
+			result := formatChecker.IsFormat("10.0.0.0/8")
+			Expect(result).To(Equal(false))
+		})
+	})
+
+	Describe("IP range format checker", func() {
+		BeforeEach(func() {
+			formatChecker = ipRangeFormatChecker{}
+		})
+
+		It("Should pass - IPv4", func() {
+			result := formatChecker.IsFormat("10.0.0.1-10.0.0.100")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should pass - IPv6", func() {
+			result := formatChecker.IsFormat("2001:db8::1-2001:db8::ff")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should not pass - reversed range", func() {
+			result := formatChecker.IsFormat("10.0.0.100-10.0.0.1")
+			Expect(result).To(Equal(false))
+		})
+
+		It("Should not pass - mixed families", func() {
+			result := formatChecker.IsFormat("10.0.0.1-2001:db8::1")
+			Expect(result).To(Equal(false))
+		})
+	})
+
+	Describe("VLAN ID format checker", func() {
+		BeforeEach(func() {
+			formatChecker = vlanIDFormatChecker{}
+		})
+
+		It("Should pass", func() {
+			result := formatChecker.IsFormat("100")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should not pass - zero", func() {
+			result := formatChecker.IsFormat("0")
+			Expect(result).To(Equal(false))
+		})
+
+		It("Should not pass - reserved", func() {
+			result := formatChecker.IsFormat("4095")
+			Expect(result).To(Equal(false))
+		})
+	})
+
+	Describe("ASN format checker", func() {
+		BeforeEach(func() {
+			formatChecker = asnFormatChecker{}
+		})
+
+		It("Should pass - asplain", func() {
+			result := formatChecker.IsFormat("4200000000")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should pass - asdot", func() {
+			result := formatChecker.IsFormat("1.10")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should not pass - too big", func() {
+			result := formatChecker.IsFormat("4294967296")
+			Expect(result).To(Equal(false))
+		})
+	})
+
+	Describe("Hostname format checker", func() {
+		BeforeEach(func() {
+			formatChecker = hostnameFormatChecker{}
+		})
+
+		It("Should pass", func() {
+			result := formatChecker.IsFormat("compute-01")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should not pass - leading hyphen", func() {
+			result := formatChecker.IsFormat("-compute")
+			Expect(result).To(Equal(false))
+		})
+
+		It("Should not pass - underscore", func() {
+			result := formatChecker.IsFormat("compute_01")
+			Expect(result).To(Equal(false))
+		})
+	})
+
+	Describe("FQDN format checker", func() {
+		BeforeEach(func() {
+			formatChecker = fqdnFormatChecker{}
+		})
+
+		It("Should pass", func() {
+			result := formatChecker.IsFormat("compute-01.example.com.")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should not pass - single label", func() {
+			result := formatChecker.IsFormat("compute-01")
+			Expect(result).To(Equal(false))
+		})
+	})
+
+	Describe("Route distinguisher format checker", func() {
+		BeforeEach(func() {
+			formatChecker = routeDistinguisherFormatChecker{}
+		})
+
+		It("Should pass - type 0", func() {
+			result := formatChecker.IsFormat("64512:4294967295")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should pass - type 1", func() {
+			result := formatChecker.IsFormat("192.0.2.1:100")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should pass - type 2", func() {
+			result := formatChecker.IsFormat("4200000000:100")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should not pass - type 2 assigned number too big", func() {
+			result := formatChecker.IsFormat("4200000000:65536")
+			Expect(result).To(Equal(false))
+		})
+
+		It("Should not pass - no delimiter", func() {
+			result := formatChecker.IsFormat("64512")
+			Expect(result).To(Equal(false))
+		})
+	})
+
+	Describe("Email format checker", func() {
+		BeforeEach(func() {
+			formatChecker = emailFormatChecker{}
+		})
+
+		It("Should pass", func() {
+			result := formatChecker.IsFormat("admin@example.com")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should not pass - display name", func() {
+			result := formatChecker.IsFormat("Admin <admin@example.com>")
+			Expect(result).To(Equal(false))
+		})
+	})
+
+	Describe("Semver format checker", func() {
+		BeforeEach(func() {
+			formatChecker = semverFormatChecker{}
+		})
+
+		It("Should pass", func() {
+			result := formatChecker.IsFormat("1.2.3-rc.1+build.5")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should not pass - leading zero", func() {
+			result := formatChecker.IsFormat("01.2.3")
+			Expect(result).To(Equal(false))
+		})
+	})
+
+	Describe("Duration format checker", func() {
+		BeforeEach(func() {
+			formatChecker = durationFormatChecker{}
+		})
+
+		It("Should pass", func() {
+			result := formatChecker.IsFormat("1h30m")
+			Expect(result).To(Equal(true))
+		})
+
+		It("Should not pass - no unit", func() {
+			result := formatChecker.IsFormat("90")
+			Expect(result).To(Equal(false))
+		})
+	})
+
+	Describe("Custom format checkers", func() {
+		It("Should use registered format checker", func() {
+			RegisterFormatChecker("even-length", evenLengthFormatChecker{})
+			Expect(IsFormat("even-length", "ab")).To(BeTrue())
+			Expect(IsFormat("even-length", "abc")).To(BeFalse())
+		})
+
+		It("Should use format checkers built in JSON schema validator", func() {
+			Expect(IsFormat("ipv4", "10.0.0.1")).To(BeTrue())
+			Expect(IsFormat("ipv4", "10.0.0.256")).To(BeFalse())
+			Expect(IsFormat("date-time", "2015-10-19T09:00:00Z")).To(BeTrue())
+			Expect(IsFormat("date-time", "yesterday")).To(BeFalse())
+		})
+
+		It("Should pass unknown formats", func() {
+			Expect(IsFormat("unknown-format", "anything")).To(BeTrue())
+		})
+	})
 })
+
+type evenLengthFormatChecker struct{}
+
+func (f evenLengthFormatChecker) IsFormat(input string) bool {
+	return len(input)%2 == 0
+}
@@ -0,0 +1,278 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//Graph node kinds
+const (
+	GraphNodeSchema    = "schema"
+	GraphNodeNamespace = "namespace"
+)
+
+//Graph edge kinds
+const (
+	GraphEdgeParent    = "parent"
+	GraphEdgeRelation  = "relation"
+	GraphEdgeNamespace = "namespace"
+)
+
+//GraphNode is a schema or a namespace
+type GraphNode struct {
+	ID      string   `json:"id"`
+	Kind    string   `json:"kind"`
+	Label   string   `json:"label"`
+	URL     string   `json:"url,omitempty"`
+	Actions []string `json:"actions,omitempty"`
+}
+
+//GraphEdge is a dependency between nodes
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Kind  string `json:"kind"`
+	Label string `json:"label,omitempty"`
+}
+
+//Graph describes dependencies between schemas and namespaces
+type Graph struct {
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []*GraphEdge `json:"edges"`
+}
+
+func namespaceNodeID(id string) string {
+	return "namespace:" + id
+}
+
+//NewGraph makes graph of schemas, including their namespaces
+func NewGraph(schemas []*Schema) *Graph {
+	graph := &Graph{Nodes: []*GraphNode{}, Edges: []*GraphEdge{}}
+	namespaces := map[string]*Namespace{}
+	for _, s := range schemas {
+		actions := []string{}
+		for _, action := range s.Actions {
+			actions = append(actions, fmt.Sprintf("%s %s %s", action.ID, action.Method, action.Path))
+		}
+		sort.Strings(actions)
+		graph.Nodes = append(graph.Nodes, &GraphNode{
+			ID:      s.ID,
+			Kind:    GraphNodeSchema,
+			Label:   s.Title,
+			URL:     s.GetPluralURL(),
+			Actions: actions,
+		})
+		if s.Parent != "" {
+			graph.Edges = append(graph.Edges, &GraphEdge{
+				From: s.ID, To: s.Parent, Kind: GraphEdgeParent, Label: s.ParentSchemaPropertyID()})
+		}
+		relations := []*GraphEdge{}
+		for _, property := range s.Properties {
+			if property.Relation == "" || property.ID == s.ParentSchemaPropertyID() {
+				continue
+			}
+			relations = append(relations, &GraphEdge{
+				From: s.ID, To: property.Relation, Kind: GraphEdgeRelation, Label: property.ID})
+		}
+		sort.Sort(edgesByLabel(relations))
+		graph.Edges = append(graph.Edges, relations...)
+		for namespace := s.Namespace; namespace != nil; namespace = namespace.ParentNamespace {
+			namespaces[namespace.ID] = namespace
+		}
+		if s.Namespace != nil {
+			graph.Edges = append(graph.Edges, &GraphEdge{
+				From: s.ID, To: namespaceNodeID(s.Namespace.ID), Kind: GraphEdgeNamespace})
+		}
+	}
+	namespaceIDs := []string{}
+	for id := range namespaces {
+		namespaceIDs = append(namespaceIDs, id)
+	}
+	sort.Strings(namespaceIDs)
+	for _, id := range namespaceIDs {
+		namespace := namespaces[id]
+		graph.Nodes = append(graph.Nodes, &GraphNode{
+			ID:    namespaceNodeID(id),
+			Kind:  GraphNodeNamespace,
+			Label: namespace.GetFullPrefix(),
+		})
+		if namespace.Parent != "" {
+			graph.Edges = append(graph.Edges, &GraphEdge{
+				From: namespaceNodeID(id), To: namespaceNodeID(namespace.Parent), Kind: GraphEdgeNamespace})
+		}
+	}
+	return graph
+}
+
+type edgesByLabel []*GraphEdge
+
+func (e edgesByLabel) Len() int           { return len(e) }
+func (e edgesByLabel) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e edgesByLabel) Less(i, j int) bool { return e[i].Label < e[j].Label }
+
+//Graph makes graph of all schemas in manager
+func (manager *Manager) Graph() *Graph {
+	return NewGraph(manager.OrderedSchemas())
+}
+
+//Focus returns subgraph of nodes within depth edges from the node, in any direction
+func (graph *Graph) Focus(nodeID string, depth int) (*Graph, error) {
+	if graph.node(nodeID) == nil {
+		return nil, fmt.Errorf("Node %s not found in graph", nodeID)
+	}
+	included := map[string]bool{nodeID: true}
+	frontier := []string{nodeID}
+	for i := 0; i < depth && len(frontier) > 0; i++ {
+		next := []string{}
+		for _, id := range frontier {
+			for _, edge := range graph.Edges {
+				var neighbour string
+				if edge.From == id {
+					neighbour = edge.To
+				} else if edge.To == id {
+					neighbour = edge.From
+				} else {
+					continue
+				}
+				if !included[neighbour] {
+					included[neighbour] = true
+					next = append(next, neighbour)
+				}
+			}
+		}
+		frontier = next
+	}
+	subgraph := &Graph{Nodes: []*GraphNode{}, Edges: []*GraphEdge{}}
+	for _, node := range graph.Nodes {
+		if included[node.ID] {
+			subgraph.Nodes = append(subgraph.Nodes, node)
+		}
+	}
+	for _, edge := range graph.Edges {
+		if included[edge.From] && included[edge.To] {
+			subgraph.Edges = append(subgraph.Edges, edge)
+		}
+	}
+	return subgraph, nil
+}
+
+func (graph *Graph) node(id string) *GraphNode {
+	for _, node := range graph.Nodes {
+		if node.ID == id {
+			return node
+		}
+	}
+	return nil
+}
+
+//JSON returns graph as json
+func (graph *Graph) JSON() (string, error) {
+	bytes, err := json.MarshalIndent(graph, "", "    ")
+	return string(bytes), err
+}
+
+//DOT returns graph in Graphviz DOT format
+func (graph *Graph) DOT() string {
+	var b bytes.Buffer
+	b.WriteString("digraph gohan {\n")
+	for _, node := range graph.Nodes {
+		label := node.Label
+		shape := "box"
+		if node.Kind == GraphNodeNamespace {
+			shape = "folder"
+		} else {
+			label = node.ID + "\\n" + node.URL
+			for _, action := range node.Actions {
+				label += "\\n" + action
+			}
+		}
+		fmt.Fprintf(&b, "    %s [label=%s, shape=%s];\n", dotQuote(node.ID), dotQuote(label), shape)
+	}
+	for _, edge := range graph.Edges {
+		style := "solid"
+		switch edge.Kind {
+		case GraphEdgeRelation:
+			style = "dashed"
+		case GraphEdgeNamespace:
+			style = "dotted"
+		}
+		fmt.Fprintf(&b, "    %s -> %s [label=%s, style=%s];\n",
+			dotQuote(edge.From), dotQuote(edge.To), dotQuote(edge.Label), style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dotQuote(str string) string {
+	return `"` + strings.Replace(str, `"`, `\"`, -1) + `"`
+}
+
+//Mermaid returns graph in Mermaid flowchart format
+func (graph *Graph) Mermaid() string {
+	var b bytes.Buffer
+	b.WriteString("graph LR\n")
+	ids := map[string]string{}
+	for i, node := range graph.Nodes {
+		ids[node.ID] = fmt.Sprintf("n%d", i)
+		label := node.Label
+		if node.Kind == GraphNodeSchema {
+			label = node.ID + "<br/>" + node.URL
+			for _, action := range node.Actions {
+				label += "<br/>" + action
+			}
+			fmt.Fprintf(&b, "    %s[%s]\n", ids[node.ID], mermaidQuote(label))
+		} else {
+			fmt.Fprintf(&b, "    %s{{%s}}\n", ids[node.ID], mermaidQuote(label))
+		}
+	}
+	for _, edge := range graph.Edges {
+		arrow := "-->"
+		switch edge.Kind {
+		case GraphEdgeRelation:
+			arrow = "-.->"
+		case GraphEdgeNamespace:
+			arrow = "==>"
+		}
+		if edge.Label != "" {
+			fmt.Fprintf(&b, "    %s %s|%s| %s\n", ids[edge.From], arrow, mermaidQuote(edge.Label), ids[edge.To])
+		} else {
+			fmt.Fprintf(&b, "    %s %s %s\n", ids[edge.From], arrow, ids[edge.To])
+		}
+	}
+	return b.String()
+}
+
+func mermaidQuote(str string) string {
+	return `"` + strings.Replace(str, `"`, "#quot;", -1) + `"`
+}
+
+//Format returns graph in given format (dot, mermaid or json)
+func (graph *Graph) Format(format string) (string, error) {
+	switch format {
+	case "dot":
+		return graph.DOT(), nil
+	case "mermaid":
+		return graph.Mermaid(), nil
+	case "json", "":
+		return graph.JSON()
+	}
+	return "", fmt.Errorf("Unknown graph format %s", format)
+}
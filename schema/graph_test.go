@@ -0,0 +1,89 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Graph", func() {
+	var graph *Graph
+
+	nodeIDs := func(graph *Graph) []string {
+		ids := []string{}
+		for _, node := range graph.Nodes {
+			ids = append(ids, node.ID)
+		}
+		return ids
+	}
+
+	BeforeEach(func() {
+		manager := GetManager()
+		Expect(manager.LoadSchemaFromFile("./test_data/graph.yaml")).To(Succeed())
+		graph = manager.Graph()
+	})
+
+	AfterEach(func() {
+		ClearManager()
+	})
+
+	It("Contains schemas, namespaces and their dependencies", func() {
+		Expect(nodeIDs(graph)).To(Equal([]string{
+			"network", "subnet", "port", "server", "namespace:neutron", "namespace:neutronV2"}))
+		Expect(graph.Nodes[0].URL).To(Equal("/neutron/v2.0/networks"))
+		Expect(graph.Nodes[0].Actions).To(Equal([]string{"reboot POST /:id/reboot"}))
+		Expect(graph.Edges).To(ContainElement(&GraphEdge{
+			From: "subnet", To: "network", Kind: GraphEdgeParent, Label: "network_id"}))
+		Expect(graph.Edges).To(ContainElement(&GraphEdge{
+			From: "port", To: "subnet", Kind: GraphEdgeRelation, Label: "subnet_id"}))
+		Expect(graph.Edges).To(ContainElement(&GraphEdge{
+			From: "namespace:neutronV2", To: "namespace:neutron", Kind: GraphEdgeNamespace}))
+		Expect(graph.Edges).ToNot(ContainElement(&GraphEdge{
+			From: "port", To: "network", Kind: GraphEdgeRelation, Label: "network_id"}))
+	})
+
+	It("Focuses on a subgraph", func() {
+		subgraph, err := graph.Focus("server", 1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeIDs(subgraph)).To(Equal([]string{"port", "server"}))
+		Expect(subgraph.Edges).To(HaveLen(1))
+
+		subgraph, err = graph.Focus("server", 2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodeIDs(subgraph)).To(Equal([]string{"network", "subnet", "port", "server", "namespace:neutronV2"}))
+
+		_, err = graph.Focus("router", 1)
+		Expect(err).To(MatchError("Node router not found in graph"))
+	})
+
+	It("Renders DOT and Mermaid", func() {
+		subgraph, _ := graph.Focus("server", 1)
+		Expect(subgraph.DOT()).To(Equal(`digraph gohan {
+    "port" [label="port\n/neutron/v2.0/ports", shape=box];
+    "server" [label="server\n/v1.0/servers", shape=box];
+    "server" -> "port" [label="port_id", style=dashed];
+}
+`))
+		Expect(subgraph.Mermaid()).To(Equal(`graph LR
+    n0["port<br/>/neutron/v2.0/ports"]
+    n1["server<br/>/v1.0/servers"]
+    n1 -.->|"port_id"| n0
+`))
+		_, err := graph.Format("svg")
+		Expect(err).To(MatchError("Unknown graph format svg"))
+	})
+})
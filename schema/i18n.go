@@ -0,0 +1,162 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//i18nKey is a key of translations in schemas, properties and actions
+const i18nKey = "i18n"
+
+//localizedFields are fields which can be translated
+var localizedFields = []string{"title", "description"}
+
+//Translations maps language to translated fields
+type Translations map[string]map[string]string
+
+//NewTranslations makes translations from i18n object
+func NewTranslations(raw interface{}) Translations {
+	translations := Translations{}
+	rawMap, _ := raw.(map[string]interface{})
+	for language, rawFields := range rawMap {
+		fields := map[string]string{}
+		rawFields, _ := rawFields.(map[string]interface{})
+		for key, value := range rawFields {
+			if value, ok := value.(string); ok {
+				fields[key] = value
+			}
+		}
+		translations[strings.ToLower(language)] = fields
+	}
+	return translations
+}
+
+//Get returns field translated to the first of languages which has it, or fallback
+//Language with region, such as ja-JP, falls back to the language without region
+func (translations Translations) Get(languages []string, field, fallback string) string {
+	for _, language := range languages {
+		language = strings.ToLower(language)
+		candidates := []string{language}
+		if i := strings.Index(language, "-"); i > 0 {
+			candidates = append(candidates, language[:i])
+		}
+		for _, candidate := range candidates {
+			if value, ok := translations[candidate][field]; ok {
+				return value
+			}
+		}
+	}
+	return fallback
+}
+
+type weightedLanguage struct {
+	language string
+	quality  float64
+}
+
+type languagesByQuality []weightedLanguage
+
+func (l languagesByQuality) Len() int           { return len(l) }
+func (l languagesByQuality) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l languagesByQuality) Less(i, j int) bool { return l[i].quality > l[j].quality }
+
+//ParseAcceptLanguage returns languages of Accept-Language header ordered by preference
+func ParseAcceptLanguage(header string) []string {
+	weighted := languagesByQuality{}
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(strings.TrimSpace(part), ";")
+		language := strings.TrimSpace(params[0])
+		if language == "" || language == "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			weighted = append(weighted, weightedLanguage{language: language, quality: quality})
+		}
+	}
+	sort.Stable(weighted)
+	languages := []string{}
+	for _, w := range weighted {
+		languages = append(languages, w.language)
+	}
+	return languages
+}
+
+//localizeObject returns copy of raw object with fields translated to the languages
+func localizeObject(raw map[string]interface{}, languages []string) map[string]interface{} {
+	translations := NewTranslations(raw[i18nKey])
+	localized := map[string]interface{}{}
+	for key, value := range raw {
+		localized[key] = value
+	}
+	for _, field := range localizedFields {
+		fallback, _ := raw[field].(string)
+		if value := translations.Get(languages, field, fallback); value != "" {
+			localized[field] = value
+		}
+	}
+	return localized
+}
+
+//LocalizeRawSchema returns copy of raw schema data with titles and descriptions
+//of schema, its properties and actions translated to the languages
+func LocalizeRawSchema(raw map[string]interface{}, languages []string) map[string]interface{} {
+	if len(languages) == 0 {
+		return raw
+	}
+	localized := localizeObject(raw, languages)
+	if jsonSchema, ok := raw["schema"].(map[string]interface{}); ok {
+		localizedSchema := map[string]interface{}{}
+		for key, value := range jsonSchema {
+			localizedSchema[key] = value
+		}
+		if properties, ok := jsonSchema["properties"].(map[string]interface{}); ok {
+			localizedProperties := map[string]interface{}{}
+			for id, property := range properties {
+				if property, ok := property.(map[string]interface{}); ok {
+					localizedProperties[id] = localizeObject(property, languages)
+				} else {
+					localizedProperties[id] = property
+				}
+			}
+			localizedSchema["properties"] = localizedProperties
+		}
+		localized["schema"] = localizedSchema
+	}
+	if actions, ok := raw["actions"].(map[string]interface{}); ok {
+		localizedActions := map[string]interface{}{}
+		for id, action := range actions {
+			if action, ok := action.(map[string]interface{}); ok {
+				localizedActions[id] = localizeObject(action, languages)
+			} else {
+				localizedActions[id] = action
+			}
+		}
+		localized["actions"] = localizedActions
+	}
+	return localized
+}
@@ -0,0 +1,101 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Translations", func() {
+	var raw map[string]interface{}
+
+	BeforeEach(func() {
+		raw = map[string]interface{}{
+			"id":          "network",
+			"plural":      "networks",
+			"singular":    "network",
+			"title":       "Network",
+			"description": "Virtual network",
+			"i18n": map[string]interface{}{
+				"ja": map[string]interface{}{"title": "ネットワーク"},
+			},
+			"actions": map[string]interface{}{
+				"reboot": map[string]interface{}{
+					"method": "POST",
+					"path":   "/:id/reboot",
+					"input":  map[string]interface{}{"type": "object"},
+					"i18n": map[string]interface{}{
+						"ja": map[string]interface{}{"title": "再起動"},
+					},
+				},
+			},
+			"schema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{
+						"title": "Name",
+						"type":  "string",
+						"i18n": map[string]interface{}{
+							"ja": map[string]interface{}{"title": "名前"},
+						},
+					},
+				},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		ClearManager()
+	})
+
+	It("Orders Accept-Language by quality", func() {
+		Expect(ParseAcceptLanguage("en;q=0.5, ja-JP, fr;q=0, *;q=0.1")).To(Equal([]string{"ja-JP", "en"}))
+		Expect(ParseAcceptLanguage("")).To(BeEmpty())
+	})
+
+	It("Falls back to language without region and to default", func() {
+		translations := NewTranslations(raw["i18n"])
+		Expect(translations.Get([]string{"ja-JP"}, "title", "Network")).To(Equal("ネットワーク"))
+		Expect(translations.Get([]string{"fr", "ja"}, "title", "Network")).To(Equal("ネットワーク"))
+		Expect(translations.Get([]string{"ja"}, "description", "Virtual network")).To(Equal("Virtual network"))
+		Expect(translations.Get(nil, "title", "Network")).To(Equal("Network"))
+	})
+
+	It("Loads translations of schema, properties and actions", func() {
+		schema, err := NewSchemaFromObj(raw)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(schema.Translations["ja"]["title"]).To(Equal("ネットワーク"))
+		Expect(schema.Actions[0].Translations["ja"]["title"]).To(Equal("再起動"))
+		property, err := schema.GetPropertyByID("name")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(property.Translations["ja"]["title"]).To(Equal("名前"))
+	})
+
+	It("Localizes copy of raw schema", func() {
+		localized := LocalizeRawSchema(raw, []string{"ja"})
+		Expect(localized["title"]).To(Equal("ネットワーク"))
+		Expect(localized["description"]).To(Equal("Virtual network"))
+		properties := localized["schema"].(map[string]interface{})["properties"].(map[string]interface{})
+		Expect(properties["name"]).To(HaveKeyWithValue("title", "名前"))
+		actions := localized["actions"].(map[string]interface{})
+		Expect(actions["reboot"]).To(HaveKeyWithValue("title", "再起動"))
+
+		Expect(raw["title"]).To(Equal("Network"))
+		rawProperties := raw["schema"].(map[string]interface{})["properties"].(map[string]interface{})
+		Expect(rawProperties["name"]).To(HaveKeyWithValue("title", "Name"))
+	})
+})
@@ -0,0 +1,389 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cloudwan/gohan/util"
+)
+
+//Lint issue levels
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+//LintBackends are database backends checked for SQL type compatibility
+var LintBackends = []string{"sqlite3", "mysql"}
+
+//reservedPropertyIDs are filled in by gohan and can't be used as properties
+var reservedPropertyIDs = []string{"tenant_name"}
+
+//reservedPlurals collide with routes registered by gohan
+var reservedPlurals = []string{"_all", "_graph"}
+
+//sqlKeywords are commonly reserved by sql backends
+var sqlKeywords = []string{
+	"add", "all", "alter", "and", "as", "between", "by", "case", "check", "column",
+	"create", "default", "delete", "desc", "distinct", "drop", "from", "group",
+	"having", "in", "index", "insert", "into", "join", "key", "like", "limit",
+	"not", "null", "or", "order", "primary", "references", "select", "set",
+	"table", "to", "union", "update", "values", "where",
+}
+
+//LintIssue is a problem found by Lint
+type LintIssue struct {
+	Level   string `json:"level"`
+	Check   string `json:"check"`
+	File    string `json:"file,omitempty"`
+	Object  string `json:"object,omitempty"`
+	Message string `json:"message"`
+}
+
+func (issue *LintIssue) String() string {
+	location := issue.File
+	if issue.Object != "" {
+		if location != "" {
+			location += ": "
+		}
+		location += issue.Object
+	}
+	return fmt.Sprintf("%s [%s] %s: %s", strings.ToUpper(issue.Level), issue.Check, location, issue.Message)
+}
+
+type propertiesByID []Property
+
+func (p propertiesByID) Len() int           { return len(p) }
+func (p propertiesByID) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p propertiesByID) Less(i, j int) bool { return p[i].ID < p[j].ID }
+
+type linter struct {
+	manager       *Manager
+	issues        []*LintIssue
+	schemaFiles   map[string]string
+	policyFiles   map[*Policy]string
+	extensionFile map[*Extension]string
+}
+
+func (l *linter) report(level, check, file, object, format string, args ...interface{}) {
+	l.issues = append(l.issues, &LintIssue{
+		Level:   level,
+		Check:   check,
+		File:    file,
+		Object:  object,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+//Lint loads schema files and reports problems found in schemas, policies and extensions
+//Files are loaded into a separate manager, so the global manager is not modified
+func Lint(filePaths ...string) []*LintIssue {
+	l := &linter{
+		manager: &Manager{
+			schemas:     make(Map),
+			schemaOrder: []string{},
+			namespaces:  map[string]*Namespace{},
+			policies:    []*Policy{},
+			Extensions:  []*Extension{},
+		},
+		issues:        []*LintIssue{},
+		schemaFiles:   map[string]string{},
+		policyFiles:   map[*Policy]string{},
+		extensionFile: map[*Extension]string{},
+	}
+	for _, filePath := range filePaths {
+		l.loadFile(filePath)
+	}
+	for _, schema := range l.manager.OrderedSchemas() {
+		l.lintSchema(schema)
+	}
+	l.lintPolicies()
+	l.lintExtensions()
+	return l.issues
+}
+
+func (l *linter) loadFile(filePath string) {
+	data, err := util.LoadFile(filePath)
+	if err != nil {
+		l.report(LintError, "load", filePath, "", "%s", err)
+		return
+	}
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		l.report(LintError, "load", filePath, "", "%s", err)
+		return
+	}
+	if err := os.Chdir(filepath.Dir(filePath)); err != nil {
+		l.report(LintError, "load", filePath, "", "%s", err)
+		return
+	}
+	defer os.Chdir(workingDirectory)
+
+	namespaces, _ := data["namespaces"].([]interface{})
+	for _, namespaceData := range namespaces {
+		namespace, err := NewNamespace(namespaceData)
+		if err == nil {
+			err = l.manager.RegisterNamespace(namespace)
+		}
+		if err != nil {
+			l.report(LintError, "namespace", filePath, "", "%s", err)
+		}
+	}
+	list, _ := data["schemas"].([]interface{})
+	for _, schemaData := range list {
+		schema, err := l.manager.newSchemaFromObj(schemaData)
+		if err != nil {
+			l.report(LintError, "schema", filePath, "", "%s", err)
+			continue
+		}
+		object := "schema " + schema.ID
+		if _, ok := l.manager.Schema(schema.ID); ok {
+			l.report(LintError, "duplicate", filePath, object, "schema is already defined in %s", l.schemaFiles[schema.ID])
+			continue
+		}
+		if schema.Parent != "" {
+			if _, ok := l.manager.Schema(schema.Parent); !ok {
+				l.report(LintError, "missing_parent", filePath, object, "parent schema %s is not defined before this schema", schema.Parent)
+				continue
+			}
+		}
+		if err := l.manager.RegisterSchema(schema); err != nil {
+			l.report(LintError, "schema", filePath, object, "%s", err)
+			continue
+		}
+		l.schemaFiles[schema.ID] = filePath
+	}
+	roles, _ := data["roles"].([]interface{})
+	for _, roleData := range roles {
+		if err := l.manager.RegisterRole(roleData); err != nil {
+			l.report(LintError, "role", filePath, "", "%s", err)
+		}
+	}
+	policies, _ := data["policies"].([]interface{})
+	for _, policyData := range policies {
+		policy, err := NewPolicy(policyData)
+		if err != nil {
+			l.report(LintError, "policy", filePath, "", "%s", err)
+			continue
+		}
+		l.manager.policies = append(l.manager.policies, policy)
+		l.policyFiles[policy] = filePath
+	}
+	extensions, _ := data["extensions"].([]interface{})
+	for _, extensionData := range extensions {
+		extension, err := NewExtension(extensionData)
+		if err != nil {
+			l.report(LintError, "extension", filePath, "", "%s", err)
+			continue
+		}
+		l.manager.Extensions = append(l.manager.Extensions, extension)
+		l.extensionFile[extension] = filePath
+	}
+}
+
+func (l *linter) lintSchema(schema *Schema) {
+	file := l.schemaFiles[schema.ID]
+	object := "schema " + schema.ID
+	if containsString(reservedPlurals, schema.Plural) {
+		l.report(LintError, "reserved_name", file, object, "plural %s collides with a gohan route", schema.Plural)
+	}
+	for _, other := range l.manager.OrderedSchemas() {
+		if other.ID != schema.ID && other.GetPluralURL() == schema.GetPluralURL() {
+			l.report(LintError, "reserved_name", file, object, "URL %s is also used by schema %s", schema.GetPluralURL(), other.ID)
+		}
+	}
+	if containsString(sqlKeywords, strings.ToLower(schema.GetDbTableName())) {
+		l.report(LintWarning, "reserved_name", file, object, "table name %s is a SQL keyword", schema.GetDbTableName())
+	}
+	properties := make([]Property, len(schema.Properties))
+	copy(properties, schema.Properties)
+	sort.Sort(propertiesByID(properties))
+	for _, property := range properties {
+		propertyObject := fmt.Sprintf("property %s.%s", schema.ID, property.ID)
+		if property.Type == "" {
+			l.report(LintError, "property_type", file, propertyObject, "property has no type")
+		}
+		if property.Relation != "" {
+			if _, ok := l.manager.Schema(property.Relation); !ok {
+				l.report(LintError, "dangling_relation", file, propertyObject, "related schema %s is not defined", property.Relation)
+			}
+		}
+		if containsString(reservedPropertyIDs, property.ID) {
+			l.report(LintError, "reserved_name", file, propertyObject, "%s is reserved by gohan", property.ID)
+		}
+		if containsString(sqlKeywords, strings.ToLower(property.ID)) {
+			l.report(LintWarning, "reserved_name", file, propertyObject, "%s is a SQL keyword", property.ID)
+		}
+		if !property.IsComputed() && !property.IsManyToMany() {
+			for _, backend := range LintBackends {
+				if message := sqlTypeProblem(backend, &property); message != "" {
+					l.report(LintError, "sql_type", file, propertyObject, "%s: %s", backend, message)
+				}
+			}
+		}
+	}
+	for _, action := range schema.Actions {
+		if !l.actionHandled(schema, action.ID) {
+			l.report(LintWarning, "unused_action", file, fmt.Sprintf("action %s.%s", schema.ID, action.ID),
+				"no extension handles this action")
+		}
+	}
+}
+
+func sqlTypeProblem(backend string, property *Property) string {
+	sqlType := strings.ToLower(property.SQLType)
+	textColumn := strings.Contains(sqlType, "text") || strings.Contains(sqlType, "blob")
+	if sqlType == "" {
+		textColumn = property.Type == "object" || property.Type == "array"
+	}
+	switch backend {
+	case "sqlite3":
+		if strings.Contains(sqlType, "enum(") || strings.Contains(sqlType, "set(") {
+			return fmt.Sprintf("sql type %s is not supported", property.SQLType)
+		}
+	case "mysql":
+		if strings.Contains(sqlType, "autoincrement") {
+			return "use auto_increment instead of autoincrement"
+		}
+		if textColumn && (property.Unique || property.Relation != "") {
+			return "text column can't be unique or used as a foreign key"
+		}
+	}
+	return ""
+}
+
+func (l *linter) schemaURLs() []string {
+	urls := []string{}
+	for _, schema := range l.manager.OrderedSchemas() {
+		urls = append(urls, schema.GetPluralURL(), schema.GetSingleURL())
+		for _, action := range schema.Actions {
+			urls = append(urls, schema.GetActionURL(action.Path))
+		}
+	}
+	return urls
+}
+
+func (l *linter) actionHandled(schema *Schema, actionID string) bool {
+	event := regexp.MustCompile(`["'](pre_|post_)?` + regexp.QuoteMeta(actionID) + `(_in_transaction)?["']`)
+	for _, extension := range l.manager.Extensions {
+		if !extension.Match(schema.GetPluralURL()) {
+			continue
+		}
+		//Handlers of go extensions can't be inspected
+		if extension.CodeType == "go" || event.MatchString(extension.Code) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *linter) lintPolicies() {
+	urls := l.schemaURLs()
+	policies := l.manager.Policies()
+	for i, policy := range policies {
+		file := l.policyFiles[policy]
+		object := "policy " + policy.ID
+		matched := []string{}
+		for _, url := range urls {
+			if policy.Resource.Path.MatchString(url) {
+				matched = append(matched, url)
+			}
+		}
+		if len(matched) == 0 {
+			l.report(LintWarning, "policy_path", file, object, "path %s doesn't match any schema URL", policy.Resource.Path)
+			continue
+		}
+		if policy.isDeny() {
+			continue
+		}
+		for j, other := range policies {
+			//Allow policy is applied only when no deny policy matches and
+			//no other allow policy of higher priority, or earlier one of the same priority matches.
+			//Deny policies with conditions deny only some of resources
+			precedes := (other.isDeny() && len(other.Condition) == 0) || other.Priority > policy.Priority || (other.Priority == policy.Priority && j < i)
+			if j != i && precedes && other.shadows(policy, matched, l.manager.RoleHierarchy()) {
+				l.report(LintWarning, "unreachable_policy", file, object, "policy is shadowed by policy %s", other.ID)
+				break
+			}
+		}
+	}
+}
+
+//shadows checks if p always matches before other for given urls
+func (p *Policy) shadows(other *Policy, urls []string, hierarchy RoleHierarchy) bool {
+	if !p.coversPrincipals(other, hierarchy) {
+		return false
+	}
+	if p.Action != ActionGlob && p.Action != other.Action {
+		return false
+	}
+	if p.TenantID.String() != globalRegexp || p.TenantName.String() != globalRegexp {
+		return false
+	}
+	for _, url := range urls {
+		if !p.Resource.Path.MatchString(url) {
+			return false
+		}
+	}
+	return true
+}
+
+//coversPrincipals checks if any request matching principals of other matches principals of p
+func (p *Policy) coversPrincipals(other *Policy, hierarchy RoleHierarchy) bool {
+	if len(other.Principals) == 0 {
+		return false
+	}
+	for _, principal := range other.Principals {
+		covered := false
+		for _, candidate := range p.Principals {
+			if candidate.covers(principal, hierarchy) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *linter) lintExtensions() {
+	urls := l.schemaURLs()
+	for _, extension := range l.manager.Extensions {
+		path := extension.Path.String()
+		if strings.Contains(path, "://") {
+			continue
+		}
+		matched := false
+		for _, url := range urls {
+			if extension.Match(url) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			l.report(LintWarning, "extension_path", l.extensionFile[extension], "extension "+extension.ID,
+				"path %s doesn't match any schema URL", path)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lint", func() {
+	var issues []*LintIssue
+
+	findIssue := func(check, object string) *LintIssue {
+		for _, issue := range issues {
+			if issue.Check == check && issue.Object == object {
+				return issue
+			}
+		}
+		return nil
+	}
+
+	BeforeEach(func() {
+		issues = Lint("./test_data/lint.yaml")
+	})
+
+	AfterEach(func() {
+		ClearManager()
+	})
+
+	It("Doesn't modify the global manager", func() {
+		_, ok := GetManager().Schema("network")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Reports schema problems", func() {
+		Expect(findIssue("missing_parent", "schema port")).ToNot(BeNil())
+		Expect(findIssue("dangling_relation", "property network.router_id").Message).To(
+			Equal("related schema router is not defined"))
+		Expect(findIssue("property_type", "property network.untyped")).ToNot(BeNil())
+		Expect(findIssue("reserved_name", "property network.tenant_name").Level).To(Equal(LintError))
+		Expect(findIssue("reserved_name", "property network.order").Level).To(Equal(LintWarning))
+		Expect(findIssue("reserved_name", "schema all")).ToNot(BeNil())
+		Expect(findIssue("reserved_name", "property network.name")).To(BeNil())
+	})
+
+	It("Reports SQL types incompatible with backends", func() {
+		Expect(findIssue("sql_type", "property network.data").Message).To(
+			Equal("mysql: text column can't be unique or used as a foreign key"))
+		Expect(findIssue("sql_type", "property network.kind").Message).To(
+			Equal("sqlite3: sql type enum('a','b') is not supported"))
+	})
+
+	It("Reports unused actions", func() {
+		Expect(findIssue("unused_action", "action network.reboot")).ToNot(BeNil())
+		Expect(findIssue("unused_action", "action network.hello")).To(BeNil())
+	})
+
+	It("Reports policy problems", func() {
+		Expect(findIssue("unreachable_policy", "policy admin_network").Message).To(
+			Equal("policy is shadowed by policy admin_statement"))
+		Expect(findIssue("policy_path", "policy member_nothing")).ToNot(BeNil())
+		Expect(findIssue("unreachable_policy", "policy admin_statement")).To(BeNil())
+		Expect(findIssue("unreachable_policy", "policy owner_network").Message).To(
+			Equal("policy is shadowed by policy operators"))
+		Expect(findIssue("unreachable_policy", "policy ops_member_network")).To(BeNil())
+	})
+
+	It("Reports extension paths which match no schema", func() {
+		Expect(findIssue("extension_path", "extension orphan")).ToNot(BeNil())
+		Expect(findIssue("extension_path", "extension hello")).To(BeNil())
+		Expect(findIssue("extension_path", "extension cron")).To(BeNil())
+	})
+
+	It("Reports files which can't be loaded", func() {
+		issues = Lint("./test_data/not_existing.yaml")
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Check).To(Equal("load"))
+	})
+})
@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/xeipuuv/gojsonschema"
 
@@ -30,6 +32,9 @@ import (
 //manager singleton schema manager
 var manager *Manager
 
+//managerLock guards manager, which is replaced on schema reload while requests are served
+var managerLock sync.RWMutex
+
 //Manager manages handling of schemas
 //Manager manages routing with external data
 //and gohan resource representation
@@ -40,6 +45,8 @@ type Manager struct {
 	policies    []*Policy
 	Extensions  []*Extension
 	namespaces  map[string]*Namespace
+	//roleHierarchy maps roles to roles they imply
+	roleHierarchy RoleHierarchy
 }
 
 func (manager *Manager) String() string {
@@ -136,6 +143,25 @@ func (manager *Manager) OrderedSchemas() []*Schema {
 	return res
 }
 
+//RelationReference is a property of a schema referring another schema
+type RelationReference struct {
+	Schema   *Schema
+	Property *Property
+}
+
+//RelationsTo returns properties of all schemas which have relation to the schema
+func (manager *Manager) RelationsTo(schemaID string) []*RelationReference {
+	references := []*RelationReference{}
+	for _, s := range manager.OrderedSchemas() {
+		for i := range s.Properties {
+			if s.Properties[i].Relation == schemaID {
+				references = append(references, &RelationReference{Schema: s, Property: &s.Properties[i]})
+			}
+		}
+	}
+	return references
+}
+
 //Policies gets policies from manager
 func (manager *Manager) Policies() []*Policy {
 	return manager.policies
@@ -229,7 +255,7 @@ func (manager *Manager) LoadSchemaFromFile(filePath string) error {
 	}
 	list, _ := schemas["schemas"].([]interface{})
 	for _, schemaData := range list {
-		schemaObj, err := NewSchemaFromObj(schemaData)
+		schemaObj, err := manager.newSchemaFromObj(schemaData)
 		if err != nil {
 			return err
 		}
@@ -238,6 +264,12 @@ func (manager *Manager) LoadSchemaFromFile(filePath string) error {
 			return err
 		}
 	}
+	roles, _ := schemas["roles"].([]interface{})
+	for _, roleData := range roles {
+		if err := manager.RegisterRole(roleData); err != nil {
+			return err
+		}
+	}
 	policies, _ := schemas["policies"].([]interface{})
 	if policies != nil {
 		for _, policyData := range policies {
@@ -261,6 +293,19 @@ func (manager *Manager) LoadSchemaFromFile(filePath string) error {
 	return nil
 }
 
+//RegisterRole registers role definition object, which lists roles implied by the role
+func (manager *Manager) RegisterRole(raw interface{}) error {
+	if manager.roleHierarchy == nil {
+		manager.roleHierarchy = NewRoleHierarchy()
+	}
+	return manager.roleHierarchy.AddRole(raw)
+}
+
+//RoleHierarchy gets roles implied by each role
+func (manager *Manager) RoleHierarchy() RoleHierarchy {
+	return manager.roleHierarchy
+}
+
 //LoadPolicies register policy by db object
 func (manager *Manager) LoadPolicies(policies []*Resource) error {
 	for _, policyData := range policies {
@@ -303,27 +348,100 @@ func (manager *Manager) ClearExtensions() {
 	manager.Extensions = []*Extension{}
 }
 
+//NewManager makes an empty manager, which isn't used by GetManager until it's set by SetManager
+func NewManager() *Manager {
+	registerGohanFormats(gojsonschema.FormatCheckers)
+	return &Manager{
+		schemas:     make(Map),
+		schemaOrder: []string{},
+		namespaces:  map[string]*Namespace{},
+		policies:    []*Policy{},
+		Extensions:  []*Extension{},
+	}
+}
+
 //GetManager get manager
 func GetManager() *Manager {
+	managerLock.RLock()
+	current := manager
+	managerLock.RUnlock()
+	if current != nil {
+		return current
+	}
+	managerLock.Lock()
+	defer managerLock.Unlock()
 	if manager == nil {
-		manager = &Manager{
-			schemas:     make(Map),
-			schemaOrder: []string{},
-			namespaces:  map[string]*Namespace{},
-			policies:    []*Policy{},
-			Extensions:  []*Extension{},
-		}
+		manager = NewManager()
 	}
-	registerGohanFormats(gojsonschema.FormatCheckers)
 	return manager
 }
 
 //ClearManager clears manager
 func ClearManager() {
+	managerLock.Lock()
+	defer managerLock.Unlock()
 	manager = nil
 }
 
+//LoadManagerFromFiles loads schema files into a new manager, which isn't used until it's set
+//by SetManager, so the current manager keeps serving requests while the new one is prepared
+func LoadManagerFromFiles(filePaths ...string) (*Manager, error) {
+	newManager := NewManager()
+	if err := newManager.LoadSchemasFromFiles(filePaths...); err != nil {
+		return nil, err
+	}
+	return newManager, nil
+}
+
+//SetManager replaces the current manager at once, and returns the previous one
+func SetManager(newManager *Manager) *Manager {
+	managerLock.Lock()
+	defer managerLock.Unlock()
+	previous := manager
+	manager = newManager
+	return previous
+}
+
+//SchemaDiff describes differences between schemas of two managers
+type SchemaDiff struct {
+	Added   []*Schema
+	Removed []*Schema
+	Changed []*Schema
+}
+
+//Empty checks if there are no differences
+func (diff *SchemaDiff) Empty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0
+}
+
+//Diff compares schemas of manager with schemas of previous manager
+func (manager *Manager) Diff(previous *Manager) *SchemaDiff {
+	diff := &SchemaDiff{
+		Added:   []*Schema{},
+		Removed: []*Schema{},
+		Changed: []*Schema{},
+	}
+	if previous == nil {
+		diff.Added = manager.OrderedSchemas()
+		return diff
+	}
+	for _, schema := range manager.OrderedSchemas() {
+		oldSchema, ok := previous.Schema(schema.ID)
+		if !ok {
+			diff.Added = append(diff.Added, schema)
+		} else if !reflect.DeepEqual(schema.RawData, oldSchema.RawData) {
+			diff.Changed = append(diff.Changed, schema)
+		}
+	}
+	for _, oldSchema := range previous.OrderedSchemas() {
+		if _, ok := manager.Schema(oldSchema.ID); !ok {
+			diff.Removed = append(diff.Removed, oldSchema)
+		}
+	}
+	return diff
+}
+
 //PolicyValidate API request using policy statements
 func (manager *Manager) PolicyValidate(action, path string, auth Authorization) (*Policy, *Role) {
-	return PolicyValidate(action, path, auth, manager.policies)
+	return validatePolicies(action, path, auth, manager.policies, manager.roleHierarchy)
 }
@@ -1,18 +1,23 @@
 package schema
 
+import "fmt"
+
 // Namespace describes a group of schemas that form a common endpoint
 type Namespace struct {
 	ID              string
 	Parent          string
 	ParentNamespace *Namespace
 	Prefix          string
+	Deprecation     *Deprecation
 }
 
 // Version ...
 type Version struct {
-	Status string `json:"status"`
-	ID     string `json:"id"`
-	Links  []Link `json:"links"`
+	Status     string `json:"status"`
+	ID         string `json:"id"`
+	Links      []Link `json:"links"`
+	Deprecated string `json:"deprecated,omitempty"`
+	Sunset     string `json:"sunset,omitempty"`
 }
 
 // NamespaceResource ...
@@ -20,6 +25,8 @@ type NamespaceResource struct {
 	Links      []Link `json:"links"`
 	Name       string `json:"name"`
 	Collection string `json:"collection"`
+	Deprecated string `json:"deprecated,omitempty"`
+	Sunset     string `json:"sunset,omitempty"`
 }
 
 // Link ...
@@ -35,6 +42,11 @@ func NewNamespace(raw interface{}) (*Namespace, error) {
 	namespace.ID, _ = typeData["id"].(string)
 	namespace.Prefix, _ = typeData["prefix"].(string)
 	namespace.Parent, _ = typeData["parent"].(string)
+	deprecation, err := NewDeprecation(typeData)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid namespace %s: %s", namespace.ID, err)
+	}
+	namespace.Deprecation = deprecation
 	return namespace, nil
 }
 
@@ -18,11 +18,14 @@ package schema
 import (
 	"fmt"
 	"regexp"
+	"strings"
 )
 
 const (
 	conditionIsOwner       = "is_owner"
 	conditionTypeBelongsTo = "belongs_to"
+	conditionTypeHasTags   = "has_tags"
+	conditionTypeAttribute = "attribute"
 	// ActionGlob allows to perform all actions
 	ActionGlob = "*"
 	// ActionCreate allows to create a resource
@@ -34,6 +37,11 @@ const (
 	// ActionDelete allows to delete a resource
 	ActionDelete = "delete"
 
+	// EffectAllow allows requests matching a policy
+	EffectAllow = "allow"
+	// EffectDeny denies requests matching a policy, even if other policies allow them
+	EffectDeny = "deny"
+
 	globalRegexp = ".*"
 
 	onlyOneOfTenantIDTenantNameError = "Only one of [tenant_id, tenant_name] should be specified"
@@ -70,6 +78,8 @@ func (t Tenant) String() string {
 //Policy describes policy configuraion for APIs
 type Policy struct {
 	ID, Description, Principal, Action, Effect string
+	Principals                                 []*Principal
+	Priority                                   int
 	Condition                                  []interface{}
 	Resource                                   *ResourcePolicy
 	RawData                                    interface{}
@@ -77,6 +87,9 @@ type Policy struct {
 	TenantName                                 *regexp.Regexp
 	requireOwner                               bool
 	actionTenantFilter                         map[string][]Tenant
+	actionTagFilter                            map[string][]string
+	actionAttributeConditions                  map[string][]*AttributeCondition
+	denials                                    []*Policy
 }
 
 //ResourcePolicy describes targe resources
@@ -90,8 +103,11 @@ type Authorization interface {
 	TenantID() string
 	TenantName() string
 	AuthToken() string
+	UserID() string
+	Groups() []string
 	Roles() []*Role
 	Catalog() []*Catalog
+	Anonymous() bool
 }
 
 //BaseAuthorization is base struct for Authorization
@@ -99,25 +115,50 @@ type BaseAuthorization struct {
 	tenantID   string
 	tenantName string
 	authToken  string
+	userID     string
+	groups     []string
 	roles      []*Role
 	catalog    []*Catalog
+	anonymous  bool
 }
 
 //NewAuthorization is a constructor for auth info
 func NewAuthorization(tenantID, tenantName, authToken string, roleIDs []string, catalog []*Catalog) Authorization {
+	return NewUserAuthorization(tenantID, tenantName, authToken, "", roleIDs, nil, catalog)
+}
+
+//NewUserAuthorization is a constructor for auth info including user ID and groups of the user
+func NewUserAuthorization(tenantID, tenantName, authToken, userID string, roleIDs, groups []string, catalog []*Catalog) Authorization {
 	roles := []*Role{}
 	for _, roleID := range roleIDs {
 		roles = append(roles, &Role{Name: roleID})
 	}
+	if groups == nil {
+		groups = []string{}
+	}
 	return &BaseAuthorization{
 		tenantID:   tenantID,
 		roles:      roles,
 		tenantName: tenantName,
 		authToken:  authToken,
+		userID:     userID,
+		groups:     groups,
 		catalog:    catalog,
 	}
 }
 
+//NewAnonymousAuthorization returns authorization of requests without credentials,
+//which matches only anonymous principals
+func NewAnonymousAuthorization(tenantID, tenantName string) Authorization {
+	return &BaseAuthorization{
+		tenantID:   tenantID,
+		tenantName: tenantName,
+		roles:      []*Role{},
+		groups:     []string{},
+		anonymous:  true,
+	}
+}
+
 //Roles returns authorized roles
 func (auth *BaseAuthorization) Roles() []*Role {
 	return auth.roles
@@ -138,11 +179,26 @@ func (auth *BaseAuthorization) AuthToken() string {
 	return auth.authToken
 }
 
+//UserID returns ID of authorized user
+func (auth *BaseAuthorization) UserID() string {
+	return auth.userID
+}
+
+//Groups returns groups of authorized user
+func (auth *BaseAuthorization) Groups() []string {
+	return auth.groups
+}
+
 //Catalog returns service catalog
 func (auth *BaseAuthorization) Catalog() []*Catalog {
 	return auth.catalog
 }
 
+//Anonymous checks if the request has no credentials
+func (auth *BaseAuthorization) Anonymous() bool {
+	return auth.anonymous
+}
+
 //Role describes user role
 type Role struct {
 	Name string
@@ -183,10 +239,39 @@ func NewPolicy(raw interface{}) (*Policy, error) {
 	policy := &Policy{}
 	policy.ID, _ = typeData["id"].(string)
 	policy.Description, _ = typeData["description"].(string)
-	policy.Principal, _ = typeData["principal"].(string)
+	principals, err := newPrincipals(policy.ID, typeData["principal"])
+	if err != nil {
+		return nil, err
+	}
+	policy.Principals = principals
+	rawPrincipals := []string{}
+	for _, principal := range principals {
+		rawPrincipals = append(rawPrincipals, principal.String())
+	}
+	policy.Principal = strings.Join(rawPrincipals, ", ")
 	policy.Action, _ = typeData["action"].(string)
 	policy.Effect, _ = typeData["effect"].(string)
+	if policy.Effect != "" && !policy.isAllow() && !policy.isDeny() {
+		return nil, fmt.Errorf("Unknown effect '%s' of policy '%s'", policy.Effect, policy.ID)
+	}
+	switch priority := typeData["priority"].(type) {
+	case nil:
+	case int:
+		policy.Priority = priority
+	case float64:
+		policy.Priority = int(priority)
+	default:
+		return nil, fmt.Errorf("Priority of policy '%s' should be an integer", policy.ID)
+	}
 	policy.Condition, _ = typeData["condition"].([]interface{})
+	if policy.isDeny() {
+		for _, condition := range policy.Condition {
+			conditionObject, _ := condition.(map[string]interface{})
+			if conditionObject["type"] != conditionTypeAttribute {
+				return nil, fmt.Errorf("Deny policy '%s' can have only attribute conditions", policy.ID)
+			}
+		}
+	}
 	policy.RawData = raw
 	resourceData, _ := typeData["resource"].(map[string]interface{})
 	resource := &ResourcePolicy{}
@@ -229,6 +314,8 @@ func NewPolicy(raw interface{}) (*Policy, error) {
 
 func (p *Policy) precomputeConditions() error {
 	p.actionTenantFilter = map[string][]Tenant{}
+	p.actionTagFilter = map[string][]string{}
+	p.actionAttributeConditions = map[string][]*AttributeCondition{}
 	for _, condition := range p.Condition {
 		switch condition.(type) {
 		case string:
@@ -265,6 +352,34 @@ func (p *Policy) precomputeConditions() error {
 				for _, action := range actions {
 					p.AddTenantToFilter(action, Tenant{ID: tenantID, Name: tenantName})
 				}
+			case conditionTypeHasTags:
+				actions := allActions
+				if action, ok := conditionObject["action"]; ok && action != ActionGlob {
+					actions = []string{action.(string)}
+				}
+				rawTags, _ := conditionObject["tags"].([]interface{})
+				if len(rawTags) == 0 {
+					return fmt.Errorf("Condition %s of policy '%s' should have tags", conditionTypeHasTags, p.ID)
+				}
+				tags := []string{}
+				for _, tag := range rawTags {
+					tags = append(tags, fmt.Sprint(tag))
+				}
+				for _, action := range actions {
+					p.actionTagFilter[action] = append(p.actionTagFilter[action], tags...)
+				}
+			case conditionTypeAttribute:
+				actions := allActions
+				if action, ok := conditionObject["action"]; ok && action != ActionGlob {
+					actions = []string{action.(string)}
+				}
+				attributeCondition, err := newAttributeCondition(p.ID, conditionObject)
+				if err != nil {
+					return err
+				}
+				for _, action := range actions {
+					p.actionAttributeConditions[action] = append(p.actionAttributeConditions[action], attributeCondition)
+				}
 			default:
 				return fmt.Errorf("Unknown condition type '%s' for policy '%s'", conditionObject["type"], p.ID)
 			}
@@ -281,33 +396,58 @@ func NewEmptyPolicy() *Policy {
 	return &Policy{Resource: &ResourcePolicy{}}
 }
 
-func (p *Policy) match(action, path string, auth Authorization) *Role {
+func (p *Policy) match(action, path string, auth Authorization, hierarchy RoleHierarchy) *Role {
+	role, _ := p.explainMatch(action, path, auth, hierarchy)
+	return role
+}
+
+//explainMatch returns matching role, and reason why the policy matches the request or not
+func (p *Policy) explainMatch(action, path string, auth Authorization, hierarchy RoleHierarchy) (*Role, string) {
 	if p.Action != "*" && action != p.Action {
-		return nil
+		return nil, fmt.Sprintf("action %s doesn't match %s", action, p.Action)
 	}
 	if !p.Resource.Path.MatchString(path) {
-		return nil
+		return nil, fmt.Sprintf("path %s doesn't match %s", path, p.Resource.Path)
 	}
 
 	if !p.TenantID.MatchString(auth.TenantID()) {
-		return nil
+		return nil, fmt.Sprintf("tenant ID %s doesn't match %s", auth.TenantID(), p.TenantID)
 	}
 
 	if !p.TenantName.MatchString(auth.TenantName()) {
-		return nil
+		return nil, fmt.Sprintf("tenant name %s doesn't match %s", auth.TenantName(), p.TenantName)
 	}
 
-	roles := auth.Roles()
-	for _, role := range roles {
-		if role.Match(p.Principal) {
-			return role
+	for _, principal := range p.Principals {
+		if role, reason := principal.Match(auth, hierarchy); role != nil {
+			return role, reason
 		}
 	}
-	return nil
+	return nil, fmt.Sprintf("no role matches principal %s", p.Principal)
 }
 
+//isAllow checks if policy allows requests, which is the default effect
 func (p *Policy) isAllow() bool {
-	return p.Effect == "Allow"
+	return p.Effect == "" || strings.EqualFold(p.Effect, EffectAllow)
+}
+
+func (p *Policy) isDeny() bool {
+	return strings.EqualFold(p.Effect, EffectDeny)
+}
+
+//deniesConditionally checks if deny policy denies the action only for resources matching its conditions
+func (p *Policy) deniesConditionally(action string) bool {
+	return p.isDeny() && len(p.actionAttributeConditions[action]) > 0
+}
+
+//withDenials returns a copy of allow policy restricted by conditional deny policies
+func (p *Policy) withDenials(denials []*Policy) *Policy {
+	if len(denials) == 0 {
+		return p
+	}
+	restricted := *p
+	restricted.denials = denials
+	return &restricted
 }
 
 //RequireOwner ...
@@ -433,6 +573,59 @@ func (p *Policy) GetTenantFilter(action string, tenant Tenant) []Tenant {
 	return append(p.actionTenantFilter[action], tenant)
 }
 
+// GetTagFilter returns tags resources should have for the action
+func (p *Policy) GetTagFilter(action string) []string {
+	return p.actionTagFilter[action]
+}
+
+//CheckTags checks if tags have all tags required for the action
+func (p *Policy) CheckTags(action string, tags interface{}) error {
+	filter := p.GetTagFilter(action)
+	if !MatchTags(tags, filter) {
+		return fmt.Errorf("Resource doesn't have tags %s required by policy", strings.Join(filter, ", "))
+	}
+	return nil
+}
+
+// GetAttributeFilter returns comparisons resources should satisfy for the action performed by the user
+func (p *Policy) GetAttributeFilter(action string, authorization Authorization) []Comparison {
+	conditions := p.actionAttributeConditions[action]
+	if len(conditions) == 0 {
+		return nil
+	}
+	result := []Comparison{}
+	for _, condition := range conditions {
+		result = append(result, condition.Resolve(authorization))
+	}
+	return result
+}
+
+// GetExclusionFilter returns comparisons of conditional deny policies matching the request.
+// Resources satisfying all comparisons of any of them are denied
+func (p *Policy) GetExclusionFilter(action string, authorization Authorization) [][]Comparison {
+	var result [][]Comparison
+	for _, denial := range p.denials {
+		result = append(result, denial.GetAttributeFilter(action, authorization))
+	}
+	return result
+}
+
+//CheckAttributes checks if resource data satisfies attribute conditions for the action
+//and isn't denied by conditional deny policies
+func (p *Policy) CheckAttributes(action string, authorization Authorization, data map[string]interface{}) error {
+	for _, comparison := range p.GetAttributeFilter(action, authorization) {
+		if !comparison.Match(data) {
+			return fmt.Errorf("Resource doesn't satisfy condition %s required by policy", comparison)
+		}
+	}
+	for i, comparisons := range p.GetExclusionFilter(action, authorization) {
+		if MatchAll(comparisons, data) {
+			return fmt.Errorf("Resource is denied by policy %s", p.denials[i].ID)
+		}
+	}
+	return nil
+}
+
 func (p *Policy) isTenantAllowed(action string, owner, tenant Tenant) bool {
 	for _, allowedTenant := range p.GetTenantFilter(action, tenant) {
 		if owner.equal(allowedTenant) {
@@ -443,13 +636,45 @@ func (p *Policy) isTenantAllowed(action string, owner, tenant Tenant) bool {
 }
 
 //PolicyValidate validates api request using policy validation
+//Request is denied if any deny policy without conditions matches it. Otherwise the matching allow policy
+//of the highest priority is applied, and the first one of them if priorities are equal.
+//Deny policies with conditions matching the request are applied together with it
 func PolicyValidate(action, path string, auth Authorization, policies []*Policy) (*Policy, *Role) {
+	return validatePolicies(action, path, auth, policies, nil)
+}
+
+//validatePolicies validates api request like PolicyValidate, with roles implying other roles in hierarchy
+func validatePolicies(action, path string, auth Authorization, policies []*Policy, hierarchy RoleHierarchy) (*Policy, *Role) {
+	policy, role, deniedBy, denials := evaluatePolicies(action, path, auth, policies, hierarchy)
+	if deniedBy != nil || policy == nil {
+		return nil, nil
+	}
+	return policy.withDenials(denials), role
+}
+
+//evaluatePolicies returns allow policy applied to the request and its role,
+//the first deny policy matching the request and deny policies applied only to resources matching their conditions
+func evaluatePolicies(action, path string, auth Authorization, policies []*Policy, hierarchy RoleHierarchy) (selected *Policy, selectedRole *Role, deniedBy *Policy, denials []*Policy) {
 	for _, policy := range policies {
-		if role := policy.match(action, path, auth); role != nil {
-			return policy, role
+		role := policy.match(action, path, auth, hierarchy)
+		if role == nil {
+			continue
+		}
+		if policy.deniesConditionally(action) {
+			denials = append(denials, policy)
+			continue
+		}
+		if policy.isDeny() {
+			if deniedBy == nil {
+				deniedBy = policy
+			}
+			continue
+		}
+		if selected == nil || policy.Priority > selected.Priority {
+			selected, selectedRole = policy, role
 		}
 	}
-	return nil, nil
+	return
 }
 
 func getRegexp(input string) (*regexp.Regexp, error) {
@@ -154,6 +154,347 @@ var _ = Describe("Policies", func() {
 			Expect(policy.GetTenantIDFilter("update", "xyz")).To(ConsistOf("xyz", "acf5662bbff44060b93ac3db3c25a590"))
 			Expect(policy.GetTenantIDFilter("delete", "xyz")).To(ConsistOf("xyz", "acf5662bbff44060b93ac3db3c25a590"))
 		})
+
+		It("tests tag conditions", func() {
+			testPolicy["condition"] = []interface{}{
+				map[string]interface{}{
+					"action": "read",
+					"tags":   []interface{}{"env:prod", "team"},
+					"type":   "has_tags",
+				},
+			}
+			policy, err := NewPolicy(testPolicy)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.GetTagFilter("read")).To(ConsistOf("env:prod", "team"))
+			Expect(policy.GetTagFilter("update")).To(BeEmpty())
+			Expect(policy.CheckTags("read", map[string]interface{}{"env": "prod", "team": "a"})).To(Succeed())
+			Expect(policy.CheckTags("read", map[string]interface{}{"env": "dev", "team": "a"})).To(
+				MatchError("Resource doesn't have tags env:prod, team required by policy"))
+			Expect(policy.CheckTags("update", nil)).To(Succeed())
+		})
+
+		It("should show error - tag condition without tags", func() {
+			testPolicy["condition"] = []interface{}{
+				map[string]interface{}{
+					"type": "has_tags",
+				},
+			}
+			_, err := NewPolicy(testPolicy)
+			Expect(err).To(MatchError("Condition has_tags of policy 'policy1' should have tags"))
+		})
+
+		It("tests attribute conditions", func() {
+			testPolicy["condition"] = []interface{}{
+				map[string]interface{}{
+					"action":   "update",
+					"property": "status",
+					"operator": "==",
+					"value":    "ACTIVE",
+					"type":     "attribute",
+				},
+				map[string]interface{}{
+					"action":   "delete",
+					"property": "protected",
+					"operator": "ne",
+					"value":    true,
+					"type":     "attribute",
+				},
+				map[string]interface{}{
+					"action":   "read",
+					"property": "owner",
+					"request":  "tenant_name",
+					"type":     "attribute",
+				},
+			}
+			policy, err := NewPolicy(testPolicy)
+			Expect(err).NotTo(HaveOccurred())
+			auth := NewAuthorization("tenantID", "tenantName", "token", []string{}, nil)
+			Expect(policy.GetAttributeFilter("create", auth)).To(BeEmpty())
+			Expect(policy.GetAttributeFilter("read", auth)).To(Equal([]Comparison{
+				{Property: "owner", Operator: OperatorEq, Value: "tenantName"}}))
+			Expect(policy.CheckAttributes("update", auth, map[string]interface{}{"status": "ACTIVE"})).To(Succeed())
+			Expect(policy.CheckAttributes("update", auth, map[string]interface{}{"status": "ERROR"})).To(
+				MatchError("Resource doesn't satisfy condition status eq ACTIVE required by policy"))
+			Expect(policy.CheckAttributes("delete", auth, map[string]interface{}{"protected": false})).To(Succeed())
+			Expect(policy.CheckAttributes("delete", auth, map[string]interface{}{"protected": true})).NotTo(Succeed())
+			Expect(policy.CheckAttributes("read", auth, map[string]interface{}{"owner": "tenantName"})).To(Succeed())
+		})
+
+		It("should show error - attribute condition with unknown operator", func() {
+			testPolicy["condition"] = []interface{}{
+				map[string]interface{}{
+					"property": "status",
+					"operator": "like",
+					"type":     "attribute",
+				},
+			}
+			_, err := NewPolicy(testPolicy)
+			Expect(err).To(MatchError("Unknown operator 'like' in condition of policy 'policy1'"))
+		})
+
+		It("should show error - attribute condition with unknown request field", func() {
+			testPolicy["condition"] = []interface{}{
+				map[string]interface{}{
+					"property": "owner",
+					"request":  "password",
+					"type":     "attribute",
+				},
+			}
+			_, err := NewPolicy(testPolicy)
+			Expect(err).To(MatchError("Unknown request field 'password' in condition of policy 'policy1'"))
+		})
+	})
+
+	Describe("Policy precedence", func() {
+		var (
+			memberAuth = NewAuthorization("tenant1", "demo", "token", []string{"_member_"}, nil)
+			adminAuth  = NewAuthorization("tenant2", "admin", "token", []string{"admin", "_member_"}, nil)
+		)
+
+		newPolicy := func(id, principal, action, effect, path, tenantID string, priority int) *Policy {
+			policy, err := NewPolicy(map[string]interface{}{
+				"id":        id,
+				"principal": principal,
+				"action":    action,
+				"effect":    effect,
+				"priority":  priority,
+				"tenant_id": tenantID,
+				"resource":  map[string]interface{}{"path": path},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			return policy
+		}
+
+		validate := func(action, path string, auth Authorization, policies ...*Policy) string {
+			policy, _ := PolicyValidate(action, path, auth, policies)
+			if policy == nil {
+				return ""
+			}
+			return policy.ID
+		}
+
+		It("applies the first matching allow policy of the same priority", func() {
+			policies := []*Policy{
+				newPolicy("networks", "_member_", "*", "allow", "/v2.0/networks.*", "", 0),
+				newPolicy("all", "_member_", "*", "allow", ".*", "", 0),
+			}
+			Expect(validate("read", "/v2.0/networks", memberAuth, policies...)).To(Equal("networks"))
+			Expect(validate("read", "/v2.0/subnets", memberAuth, policies...)).To(Equal("all"))
+		})
+
+		It("applies allow policy of higher priority", func() {
+			policies := []*Policy{
+				newPolicy("all", "_member_", "*", "allow", ".*", "", 0),
+				newPolicy("networks", "_member_", "*", "allow", "/v2.0/networks.*", "", 10),
+			}
+			Expect(validate("read", "/v2.0/networks", memberAuth, policies...)).To(Equal("networks"))
+			Expect(validate("read", "/v2.0/subnets", memberAuth, policies...)).To(Equal("all"))
+		})
+
+		It("denies requests matching deny policy regardless of order and priority", func() {
+			policies := []*Policy{
+				newPolicy("all", "_member_", "*", "allow", ".*", "", 100),
+				newPolicy("no_delete", "_member_", "delete", "deny", "/v2.0/networks.*", "", 0),
+			}
+			Expect(validate("delete", "/v2.0/networks/red", memberAuth, policies...)).To(BeEmpty())
+			Expect(validate("update", "/v2.0/networks/red", memberAuth, policies...)).To(Equal("all"))
+			Expect(validate("delete", "/v2.0/subnets/red", memberAuth, policies...)).To(Equal("all"))
+		})
+
+		It("denies only principals and tenants matching deny policy", func() {
+			policies := []*Policy{
+				newPolicy("no_tenant1", "_member_", "*", "deny", ".*", "tenant1", 0),
+				newPolicy("members", "_member_", "*", "allow", ".*", "", 0),
+				newPolicy("no_admin_subnets", "admin", "*", "deny", "/v2.0/subnets.*", "", 0),
+			}
+			Expect(validate("read", "/v2.0/networks", memberAuth, policies...)).To(BeEmpty())
+			Expect(validate("read", "/v2.0/networks", adminAuth, policies...)).To(Equal("members"))
+			Expect(validate("read", "/v2.0/subnets", adminAuth, policies...)).To(BeEmpty())
+		})
+
+		It("explains denied requests", func() {
+			policies := []*Policy{
+				newPolicy("all", "_member_", "*", "allow", ".*", "", 0),
+				newPolicy("no_delete", "_member_", "delete", "deny", ".*", "", 0),
+			}
+			explanation := ExplainPolicies("delete", "/v2.0/networks/red", memberAuth, policies)
+			Expect(explanation.Allowed).To(BeFalse())
+			Expect(explanation.DeniedBy).To(Equal("no_delete"))
+			Expect(explanation.Policies[0].Matched).To(BeTrue())
+			Expect(explanation.Policies[0].Reason).To(ContainSubstring("but policy no_delete denies the request"))
+		})
+
+		It("should show error - invalid effect and priority", func() {
+			_, err := NewPolicy(map[string]interface{}{"id": "policy1", "effect": "maybe"})
+			Expect(err).To(MatchError("Unknown effect 'maybe' of policy 'policy1'"))
+			_, err = NewPolicy(map[string]interface{}{"id": "policy1", "priority": "high"})
+			Expect(err).To(MatchError("Priority of policy 'policy1' should be an integer"))
+		})
+
+		It("should show error - deny policy with conditions other than attribute", func() {
+			_, err := NewPolicy(map[string]interface{}{"id": "policy1", "effect": "deny", "condition": []interface{}{"is_owner"}})
+			Expect(err).To(MatchError("Deny policy 'policy1' can have only attribute conditions"))
+		})
+
+		Context("Deny policies with conditions", func() {
+			var policies []*Policy
+
+			BeforeEach(func() {
+				protected, err := NewPolicy(map[string]interface{}{
+					"id":        "no_delete_protected",
+					"principal": "_member_",
+					"action":    "delete",
+					"effect":    "deny",
+					"resource":  map[string]interface{}{"path": "/v2.0/networks.*"},
+					"condition": []interface{}{
+						map[string]interface{}{
+							"type":     "attribute",
+							"property": "protected",
+							"value":    true,
+						},
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				policies = []*Policy{
+					newPolicy("all", "_member_", "*", "allow", ".*", "", 0),
+					protected,
+				}
+			})
+
+			It("applies deny policy only to resources matching its conditions", func() {
+				policy, _ := PolicyValidate("delete", "/v2.0/networks/red", memberAuth, policies)
+				Expect(policy).NotTo(BeNil())
+				Expect(policy.ID).To(Equal("all"))
+				Expect(policy.GetExclusionFilter("delete", memberAuth)).To(Equal([][]Comparison{
+					{{Property: "protected", Operator: OperatorEq, Value: true}}}))
+				Expect(policy.CheckAttributes("delete", memberAuth, map[string]interface{}{"protected": false})).To(Succeed())
+				Expect(policy.CheckAttributes("delete", memberAuth, map[string]interface{}{"protected": true})).To(
+					MatchError("Resource is denied by policy no_delete_protected"))
+				Expect(policies[0].GetExclusionFilter("delete", memberAuth)).To(BeEmpty())
+			})
+
+			It("doesn't apply deny policy to requests it doesn't match", func() {
+				policy, _ := PolicyValidate("update", "/v2.0/networks/red", memberAuth, policies)
+				Expect(policy).To(Equal(policies[0]))
+				Expect(policy.CheckAttributes("update", memberAuth, map[string]interface{}{"protected": true})).To(Succeed())
+			})
+
+			It("explains conditional deny policies", func() {
+				explanation := ExplainPolicies("delete", "/v2.0/networks/red", memberAuth, policies)
+				Expect(explanation.Allowed).To(BeTrue())
+				Expect(explanation.DeniedBy).To(BeEmpty())
+				Expect(explanation.ExclusionFilter).To(Equal([]string{"protected eq true"}))
+				Expect(explanation.Policies[1].Reason).To(ContainSubstring("applied to resources matching its conditions"))
+			})
+		})
+	})
+
+	Describe("Principals", func() {
+		var (
+			memberAuth = NewUserAuthorization("tenant1", "demo", "token", "alice", []string{"_member_"}, []string{"developers"}, nil)
+			adminAuth  = NewUserAuthorization("tenant2", "admin", "token", "bob", []string{"admin"}, nil, nil)
+			hierarchy  RoleHierarchy
+		)
+
+		BeforeEach(func() {
+			hierarchy = NewRoleHierarchy()
+			Expect(hierarchy.AddRole(map[string]interface{}{"id": "admin", "implies": []interface{}{"net_admin"}})).To(Succeed())
+			Expect(hierarchy.AddRole(map[string]interface{}{"id": "net_admin", "implies": []interface{}{"_member_"}})).To(Succeed())
+		})
+
+		newPolicy := func(principal interface{}) *Policy {
+			policy, err := NewPolicy(map[string]interface{}{
+				"id":        "policy1",
+				"principal": principal,
+				"action":    "*",
+				"resource":  map[string]interface{}{"path": ".*"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			return policy
+		}
+
+		match := func(policy *Policy, auth Authorization) string {
+			role, _ := policy.explainMatch("read", "/v2.0/networks", auth, hierarchy)
+			if role == nil {
+				return ""
+			}
+			return role.Name
+		}
+
+		It("matches roles implied by roles of the user", func() {
+			policy := newPolicy("_member_")
+			Expect(match(policy, memberAuth)).To(Equal("_member_"))
+			Expect(match(policy, adminAuth)).To(Equal("admin"))
+			_, reason := policy.explainMatch("read", "/v2.0/networks", adminAuth, hierarchy)
+			Expect(reason).To(Equal("role admin implies role _member_ matching principal _member_"))
+			Expect(match(newPolicy("admin"), memberAuth)).To(BeEmpty())
+		})
+
+		It("matches lists of principals", func() {
+			Expect(newPolicy([]interface{}{"admin", "group:developers"}).Principal).To(Equal("admin, group:developers"))
+			Expect(match(newPolicy([]interface{}{"admin", "group:developers"}), memberAuth)).To(Equal("group:developers"))
+			Expect(match(newPolicy("role:net_admin, user:alice"), memberAuth)).To(Equal("user:alice"))
+			Expect(match(newPolicy("role:net_admin, user:alice"), adminAuth)).To(Equal("admin"))
+			Expect(match(newPolicy("user:carol, group:ops"), memberAuth)).To(BeEmpty())
+		})
+
+		It("matches wildcard principals", func() {
+			Expect(match(newPolicy("*"), NewAuthorization("tenant1", "demo", "token", []string{}, nil))).To(Equal("*"))
+			Expect(match(newPolicy("net_*"), adminAuth)).To(Equal("admin"))
+			Expect(match(newPolicy("net_*"), memberAuth)).To(BeEmpty())
+			Expect(match(newPolicy("group:dev*"), memberAuth)).To(Equal("group:dev*"))
+			Expect(match(newPolicy("user:*"), NewAuthorization("tenant1", "demo", "token", []string{"_member_"}, nil))).To(BeEmpty())
+		})
+
+		It("matches anonymous requests only by anonymous principal", func() {
+			anonymousAuth := NewAnonymousAuthorization("", "")
+			Expect(match(newPolicy("anonymous"), anonymousAuth)).To(Equal("anonymous"))
+			Expect(match(newPolicy("anonymous"), memberAuth)).To(BeEmpty())
+			Expect(match(newPolicy("*"), anonymousAuth)).To(BeEmpty())
+			Expect(match(newPolicy("user:*, group:*"), anonymousAuth)).To(BeEmpty())
+			Expect(NewPrincipal("*").covers(NewPrincipal("anonymous"), hierarchy)).To(BeFalse())
+		})
+
+		It("handles cycles in role hierarchy", func() {
+			Expect(hierarchy.AddRole(map[string]interface{}{"id": "_member_", "implies": []interface{}{"admin"}})).To(Succeed())
+			Expect(hierarchy.Implied("admin")).To(Equal([]string{"admin", "net_admin", "_member_"}))
+		})
+
+		It("should show error - invalid principal and role definition", func() {
+			_, err := NewPolicy(map[string]interface{}{"id": "policy1", "principal": 1})
+			Expect(err).To(MatchError("Principal of policy 'policy1' should be a string or a list"))
+			Expect(hierarchy.AddRole(map[string]interface{}{"implies": []interface{}{"admin"}})).To(MatchError("Role definition should have id"))
+			Expect(hierarchy.AddRole(map[string]interface{}{"id": "admin", "implies": "_member_"})).To(MatchError("Implied roles of role 'admin' should be a list"))
+		})
+	})
+
+	Describe("Comparisons", func() {
+		It("compares numbers of different types", func() {
+			Expect(Comparison{Property: "size", Operator: OperatorGe, Value: 10}.Match(
+				map[string]interface{}{"size": float64(10)})).To(BeTrue())
+			Expect(Comparison{Property: "size", Operator: OperatorLt, Value: int64(5)}.Match(
+				map[string]interface{}{"size": 7})).To(BeFalse())
+		})
+
+		It("compares lists", func() {
+			comparison := Comparison{Property: "status", Operator: OperatorNotIn, Value: []interface{}{"ERROR", "DOWN"}}
+			Expect(comparison.Match(map[string]interface{}{"status": "ACTIVE"})).To(BeTrue())
+			Expect(comparison.Match(map[string]interface{}{"status": "DOWN"})).To(BeFalse())
+		})
+
+		It("compares strings lexically and doesn't order strings with numbers", func() {
+			Expect(Comparison{Property: "name", Operator: OperatorLt, Value: "9"}.Match(
+				map[string]interface{}{"name": "10"})).To(BeTrue())
+			Expect(Comparison{Property: "name", Operator: OperatorGt, Value: 9}.Match(
+				map[string]interface{}{"name": "10"})).To(BeFalse())
+			Expect(Comparison{Property: "name", Operator: OperatorLe, Value: 9}.Match(
+				map[string]interface{}{"name": "10"})).To(BeFalse())
+		})
+
+		It("doesn't order missing values", func() {
+			comparison := Comparison{Property: "size", Operator: OperatorGt, Value: 1}
+			Expect(comparison.Match(map[string]interface{}{})).To(BeFalse())
+		})
 	})
 
 	Describe("Tenants", func() {
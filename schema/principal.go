@@ -0,0 +1,207 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//Principal types
+const (
+	PrincipalRole      = "role"
+	PrincipalUser      = "user"
+	PrincipalGroup     = "group"
+	PrincipalAny       = "*"
+	PrincipalAnonymous = "anonymous"
+)
+
+//Principal describes to whom a policy is applied
+//Role principals are written either as a role name or as role:<name>,
+//user and group principals as user:<user ID> and group:<group ID or name>.
+//Names may contain * wildcards, and * alone matches any authenticated request.
+//anonymous matches only requests without credentials
+type Principal struct {
+	Type    string
+	Name    string
+	raw     string
+	pattern *regexp.Regexp
+}
+
+//NewPrincipal parses a principal of a policy
+func NewPrincipal(raw string) *Principal {
+	raw = strings.TrimSpace(raw)
+	principal := &Principal{Type: PrincipalRole, Name: raw, raw: raw}
+	if raw == PrincipalAny || raw == PrincipalAnonymous {
+		principal.Type = raw
+		return principal
+	}
+	if index := strings.Index(raw, ":"); index >= 0 {
+		switch prefix := raw[:index]; prefix {
+		case PrincipalRole, PrincipalUser, PrincipalGroup:
+			principal.Type = prefix
+			principal.Name = raw[index+1:]
+		}
+	}
+	pattern := regexp.QuoteMeta(principal.Name)
+	pattern = strings.Replace(pattern, regexp.QuoteMeta("*"), ".*", -1)
+	principal.pattern = regexp.MustCompile("^" + pattern + "$")
+	return principal
+}
+
+//newPrincipals parses principal of a policy, which is a comma separated string or a list
+func newPrincipals(policyID string, raw interface{}) ([]*Principal, error) {
+	rawPrincipals := []string{}
+	switch raw := raw.(type) {
+	case nil:
+	case string:
+		rawPrincipals = strings.Split(raw, ",")
+	case []interface{}:
+		for _, rawPrincipal := range raw {
+			rawPrincipals = append(rawPrincipals, fmt.Sprint(rawPrincipal))
+		}
+	default:
+		return nil, fmt.Errorf("Principal of policy '%s' should be a string or a list", policyID)
+	}
+	principals := []*Principal{}
+	for _, rawPrincipal := range rawPrincipals {
+		if strings.TrimSpace(rawPrincipal) == "" {
+			continue
+		}
+		principals = append(principals, NewPrincipal(rawPrincipal))
+	}
+	return principals, nil
+}
+
+func (p *Principal) String() string {
+	return p.raw
+}
+
+//matchName checks if name matches the principal name
+func (p *Principal) matchName(name string) bool {
+	return name != "" && p.pattern.MatchString(name)
+}
+
+//Match returns role under which auth matches the principal, and the reason
+//Roles of auth match role principals also through roles they imply in hierarchy.
+//Auth matching a user, group or wildcard principal gets the role named after the principal
+func (p *Principal) Match(auth Authorization, hierarchy RoleHierarchy) (*Role, string) {
+	if auth.Anonymous() != (p.Type == PrincipalAnonymous) {
+		return nil, ""
+	}
+	switch p.Type {
+	case PrincipalAnonymous:
+		return &Role{Name: p.raw}, "anonymous request matches principal anonymous"
+	case PrincipalAny:
+		return &Role{Name: p.raw}, fmt.Sprintf("principal %s matches any authenticated request", p)
+	case PrincipalUser:
+		if p.matchName(auth.UserID()) {
+			return &Role{Name: p.raw}, fmt.Sprintf("user %s matches principal %s", auth.UserID(), p)
+		}
+	case PrincipalGroup:
+		for _, group := range auth.Groups() {
+			if p.matchName(group) {
+				return &Role{Name: p.raw}, fmt.Sprintf("group %s matches principal %s", group, p)
+			}
+		}
+	default:
+		for _, role := range auth.Roles() {
+			for _, name := range hierarchy.Implied(role.Name) {
+				if !p.matchName(name) {
+					continue
+				}
+				if name == role.Name {
+					return role, fmt.Sprintf("role %s matches principal %s", role.Name, p)
+				}
+				return role, fmt.Sprintf("role %s implies role %s matching principal %s", role.Name, name, p)
+			}
+		}
+	}
+	return nil, ""
+}
+
+//covers checks if any request matching other principal matches p too
+func (p *Principal) covers(other *Principal, hierarchy RoleHierarchy) bool {
+	if (p.Type == PrincipalAnonymous) != (other.Type == PrincipalAnonymous) {
+		return false
+	}
+	if p.Type == PrincipalAny || p.Type == PrincipalAnonymous {
+		return true
+	}
+	if p.Type != other.Type {
+		return false
+	}
+	if p.Name == other.Name {
+		return true
+	}
+	if strings.Contains(other.Name, "*") {
+		return false
+	}
+	if p.Type != PrincipalRole {
+		return p.matchName(other.Name)
+	}
+	for _, name := range hierarchy.Implied(other.Name) {
+		if p.matchName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+//RoleHierarchy maps role names to names of roles they imply
+type RoleHierarchy map[string][]string
+
+//NewRoleHierarchy returns empty role hierarchy
+func NewRoleHierarchy() RoleHierarchy {
+	return RoleHierarchy{}
+}
+
+//AddRole registers role definition object with id and list of implied roles
+func (hierarchy RoleHierarchy) AddRole(raw interface{}) error {
+	roleData, _ := raw.(map[string]interface{})
+	id, _ := roleData["id"].(string)
+	if id == "" {
+		return fmt.Errorf("Role definition should have id")
+	}
+	var implies []interface{}
+	switch rawImplies := roleData["implies"].(type) {
+	case nil:
+	case []interface{}:
+		implies = rawImplies
+	default:
+		return fmt.Errorf("Implied roles of role '%s' should be a list", id)
+	}
+	for _, implied := range implies {
+		hierarchy[id] = append(hierarchy[id], fmt.Sprint(implied))
+	}
+	return nil
+}
+
+//Implied returns role name followed by names of all roles it implies directly or indirectly
+func (hierarchy RoleHierarchy) Implied(name string) []string {
+	implied := []string{name}
+	visited := map[string]bool{name: true}
+	for i := 0; i < len(implied); i++ {
+		for _, next := range hierarchy[implied[i]] {
+			if !visited[next] {
+				visited[next] = true
+				implied = append(implied, next)
+			}
+		}
+	}
+	return implied
+}
@@ -15,6 +15,20 @@
 
 package schema
 
+import (
+	"fmt"
+)
+
+//RelationManyToMany is a relation type of properties holding a list of related IDs
+const RelationManyToMany = "many_to_many"
+
+//Actions taken on resources referring a deleted resource
+const (
+	OnDeleteCascade  = "cascade"
+	OnDeleteRestrict = "restrict"
+	OnDeleteSetNull  = "set_null"
+)
+
 //Property is a definition of each Property
 type Property struct {
 	ID, Title, Description string
@@ -22,10 +36,14 @@ type Property struct {
 	Properties             map[string]interface{}
 	Relation               string
 	RelationProperty       string
+	RelationType           string
+	OnDelete               string
 	Unique                 bool
 	Nullable               bool
 	SQLType                string
 	Default                interface{}
+	Computed               *Computed
+	Translations           Translations
 }
 
 //PropertyMap is a map of Property
@@ -82,5 +100,45 @@ func NewPropertyFromObj(id string, rawTypeData interface{}, required bool) (*Pro
 	}
 	sqlType, _ := typeData["sql"].(string)
 	Property := NewProperty(id, title, description, typeID, format, relation, relationProperty, sqlType, unique, nullable, properties, defaultValue)
+	Property.Translations = NewTranslations(typeData[i18nKey])
+	Property.RelationType, _ = typeData["relation_type"].(string)
+	if Property.RelationType == RelationManyToMany && (relation == "" || typeID != "array") {
+		return nil, fmt.Errorf("many_to_many property %s should be an array with relation", id)
+	}
+	Property.OnDelete, _ = typeData["on_delete"].(string)
+	if Property.OnDelete != "" && relation == "" {
+		return nil, fmt.Errorf("on_delete of property %s requires relation", id)
+	}
+	if Property.OnDelete == OnDeleteSetNull && (!nullable || Property.RelationType == RelationManyToMany) {
+		return nil, fmt.Errorf("on_delete of property %s can't be set_null, property isn't nullable", id)
+	}
+	if rawComputed, ok := typeData["computed"]; ok {
+		computed, err := NewComputedFromObj(id, rawComputed)
+		if err != nil {
+			return nil, err
+		}
+		Property.Computed = computed
+	}
 	return &Property, nil
 }
+
+//IsManyToMany checks if property holds a list of IDs of related resources
+func (property *Property) IsManyToMany() bool {
+	return property.Relation != "" && property.RelationType == RelationManyToMany
+}
+
+//RelatedIDs converts value of a many to many property, or a filter on it, to a list of IDs
+func RelatedIDs(value interface{}) []string {
+	ids := []string{}
+	switch value := value.(type) {
+	case string:
+		ids = append(ids, value)
+	case []string:
+		ids = append(ids, value...)
+	case []interface{}:
+		for _, id := range value {
+			ids = append(ids, fmt.Sprint(id))
+		}
+	}
+	return ids
+}
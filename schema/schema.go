@@ -41,6 +41,10 @@ type Schema struct {
 	Singular                       string
 	URL                            string
 	URLWithParents                 string
+	StateMachine                   *StateMachine
+	Tagging                        bool
+	Translations                   Translations
+	Deprecation                    *Deprecation
 	createHandler                  func(*Resource)
 	updateHandler                  func(*Resource)
 	deleteHandler                  func(*Resource)
@@ -82,9 +86,17 @@ func NewSchema(id, plural, title, description, singular string) *Schema {
 
 //NewSchemaFromObj is a constructor for a schema by obj
 func NewSchemaFromObj(rawTypeData interface{}) (*Schema, error) {
-	typeData := rawTypeData.(map[string]interface{})
+	return GetManager().newSchemaFromObj(rawTypeData)
+}
 
-	metaschema, ok := GetManager().Schema("schema")
+//newSchemaFromObj makes a schema by obj, validated by the metaschema of the manager
+func (manager *Manager) newSchemaFromObj(rawTypeData interface{}) (*Schema, error) {
+	typeData, ok := rawTypeData.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Schema should be a map, not %T", rawTypeData)
+	}
+
+	metaschema, ok := manager.Schema("schema")
 	if ok {
 		err := metaschema.Validate(metaschema.JSONSchema, typeData)
 		if err != nil {
@@ -130,21 +142,39 @@ func NewSchemaFromObj(rawTypeData interface{}) (*Schema, error) {
 	if required == nil {
 		required = []interface{}{}
 	}
-	if parent != "" && jsonSchema["properties"].(map[string]interface{})[FormatParentID(parent)] == nil {
-		jsonSchema["properties"].(map[string]interface{})[FormatParentID(parent)] = getParentPropertyObj(parent, parent)
-		jsonSchema["propertiesOrder"] = append(jsonSchema["propertiesOrder"].([]interface{}), FormatParentID(parent))
-		required = append(required.([]interface{}), FormatParentID(parent))
+	tagging, _ := typeData["tagging"].(bool)
+	requiredList, ok := required.([]interface{})
+	if !ok {
+		return nil, &typeAssertionError{"required"}
+	}
+	properties, _ := jsonSchema["properties"].(map[string]interface{})
+	if properties == nil && (parent != "" || tagging) {
+		properties = map[string]interface{}{}
+		jsonSchema["properties"] = properties
+	}
+	if parent != "" && properties[FormatParentID(parent)] == nil {
+		properties[FormatParentID(parent)] = getParentPropertyObj(parent, parent)
+		if propertiesOrder, ok := jsonSchema["propertiesOrder"].([]interface{}); ok {
+			jsonSchema["propertiesOrder"] = append(propertiesOrder, FormatParentID(parent))
+		}
+		requiredList = append(requiredList, FormatParentID(parent))
+	}
+
+	if tagging && properties[TagsPropertyID] == nil {
+		properties[TagsPropertyID] = getTagsPropertyObj()
+		if propertiesOrder, ok := jsonSchema["propertiesOrder"].([]interface{}); ok {
+			jsonSchema["propertiesOrder"] = append(propertiesOrder, TagsPropertyID)
+		}
 	}
 
-	jsonSchema["required"] = required
+	jsonSchema["required"] = requiredList
 
 	requiredStrings := []string{}
-	for _, req := range required.([]interface{}) {
-		requiredStrings = append(requiredStrings, req.(string))
+	for _, req := range requiredList {
+		requiredStrings = append(requiredStrings, fmt.Sprint(req))
 	}
 
 	metadata, _ := typeData["metadata"].(map[string]interface{})
-	properties, _ := jsonSchema["properties"].(map[string]interface{})
 
 	policy, _ := typeData["policy"].([]interface{})
 	singular, ok := typeData["singular"].(string)
@@ -169,6 +199,20 @@ func NewSchemaFromObj(rawTypeData interface{}) (*Schema, error) {
 		RawData:            rawTypeData,
 		Singular:           singular,
 		Required:           requiredStrings,
+		Tagging:            tagging,
+		Translations:       NewTranslations(typeData[i18nKey]),
+	}
+	deprecation, err := NewDeprecation(typeData)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid schema %s: %s", id, err)
+	}
+	schema.Deprecation = deprecation
+	if rawStateMachine, ok := typeData["state_machine"]; ok {
+		stateMachine, err := NewStateMachine(rawStateMachine)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid state machine of %s: %s", id, err)
+		}
+		schema.StateMachine = stateMachine
 	}
 	//TODO(nati) load tags
 	schema.Tags = make(Tags)
@@ -228,6 +272,16 @@ func (schema *Schema) GetDbTableName() string {
 	return schema.ID + "s"
 }
 
+// GetJoinTableName returns a name of DB table used for storing many to many relation of the property
+func (schema *Schema) GetJoinTableName(property *Property) string {
+	return schema.GetDbTableName() + "_" + property.ID
+}
+
+// GetTagTableName returns a name of DB table used for storing tags of schema instances
+func (schema *Schema) GetTagTableName() string {
+	return schema.GetDbTableName() + "_tags"
+}
+
 // GetParentURL returns Parent URL
 func (schema *Schema) GetParentURL() string {
 	if schema.Parent == "" {
@@ -245,6 +299,9 @@ func filterSchemaByPermission(schema map[string]interface{}, permission string)
 		if ok == false {
 			continue
 		}
+		if _, computed := propertyMap["computed"]; computed {
+			continue
+		}
 		allowedList, ok := propertyMap["permission"]
 		if ok == false {
 			continue
@@ -380,3 +437,35 @@ func (schema *Schema) GetPropertyByID(id string) (*Property, error) {
 func FormatParentID(parent string) string {
 	return fmt.Sprintf("%s_id", parent)
 }
+
+//NewProperties returns properties added since the previous version of the schema
+//It returns an error if the change can't be applied to an existing table
+//without losing data, e.g. a property was removed or its type was changed
+func (schema *Schema) NewProperties(previous *Schema) ([]Property, error) {
+	if schema.Parent != previous.Parent {
+		return nil, fmt.Errorf("Parent of schema %s changed from '%s' to '%s'", schema.ID, previous.Parent, schema.Parent)
+	}
+	for _, oldProperty := range previous.Properties {
+		property, err := schema.GetPropertyByID(oldProperty.ID)
+		if err != nil {
+			return nil, fmt.Errorf("Property %s of schema %s was removed", oldProperty.ID, schema.ID)
+		}
+		if property.Type != oldProperty.Type || property.SQLType != oldProperty.SQLType || property.Relation != oldProperty.Relation {
+			return nil, fmt.Errorf("Property %s of schema %s changed its type", property.ID, schema.ID)
+		}
+		if oldProperty.Nullable && !property.Nullable {
+			return nil, fmt.Errorf("Property %s of schema %s is no longer nullable", property.ID, schema.ID)
+		}
+	}
+	newProperties := []Property{}
+	for _, property := range schema.Properties {
+		if _, err := previous.GetPropertyByID(property.ID); err == nil {
+			continue
+		}
+		if !property.Nullable && property.Default == nil {
+			return nil, fmt.Errorf("New property %s of schema %s must be nullable or have a default value", property.ID, schema.ID)
+		}
+		newProperties = append(newProperties, property)
+	}
+	return newProperties, nil
+}
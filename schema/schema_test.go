@@ -103,6 +103,125 @@ var _ = Describe("Schema", func() {
 			Expect(netSchema.ValidateOnCreate(netMap)).To(Succeed())
 		})
 	})
+
+	Describe("Reloading", func() {
+		schemaPath := "../etc/apps/example.json"
+
+		newTestSchema := func(properties map[string]interface{}, required ...interface{}) *Schema {
+			s, err := NewSchemaFromObj(map[string]interface{}{
+				"id":          "test",
+				"plural":      "tests",
+				"singular":    "test",
+				"title":       "Test",
+				"description": "Test",
+				"schema": map[string]interface{}{
+					"properties": properties,
+					"required":   required,
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			return s
+		}
+
+		BeforeEach(func() {
+			Expect(GetManager().LoadSchemaFromFile(schemaPath)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			ClearManager()
+		})
+
+		It("Loads a new manager without replacing the current one until it's set", func() {
+			current := GetManager()
+			manager, err := LoadManagerFromFiles(schemaPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(manager).ToNot(BeIdenticalTo(current))
+			Expect(GetManager()).To(BeIdenticalTo(current))
+			Expect(manager.Diff(current).Empty()).To(BeTrue())
+
+			Expect(SetManager(manager)).To(BeIdenticalTo(current))
+			Expect(GetManager()).To(BeIdenticalTo(manager))
+		})
+
+		It("Keeps current manager on error", func() {
+			current := GetManager()
+			_, err := LoadManagerFromFiles(schemaPath, "./not_existing.json")
+			Expect(err).To(HaveOccurred())
+			Expect(GetManager()).To(BeIdenticalTo(current))
+		})
+
+		It("Reports added, removed and changed schemas", func() {
+			previous := GetManager()
+			manager, err := LoadManagerFromFiles(schemaPath)
+			Expect(err).ToNot(HaveOccurred())
+			network, _ := manager.Schema("network")
+			Expect(manager.UnRegisterSchema(network)).To(Succeed())
+			subnet, _ := manager.Schema("subnet")
+			subnet.RawData = map[string]interface{}{"id": "subnet"}
+			test := newTestSchema(map[string]interface{}{})
+			Expect(manager.RegisterSchema(test)).To(Succeed())
+
+			diff := manager.Diff(previous)
+			Expect(diff.Added).To(ConsistOf(test))
+			Expect(diff.Changed).To(ConsistOf(subnet))
+			Expect(diff.Removed).To(HaveLen(1))
+			Expect(diff.Removed[0].ID).To(Equal("network"))
+		})
+
+		Describe("New properties", func() {
+			var previous *Schema
+
+			BeforeEach(func() {
+				previous = newTestSchema(map[string]interface{}{
+					"id":   map[string]interface{}{"type": "string"},
+					"name": map[string]interface{}{"type": "string"},
+				}, "id", "name")
+			})
+
+			It("Returns nullable and defaulted properties", func() {
+				current := newTestSchema(map[string]interface{}{
+					"id":          map[string]interface{}{"type": "string"},
+					"name":        map[string]interface{}{"type": "string", "title": "Name"},
+					"description": map[string]interface{}{"type": "string"},
+					"size":        map[string]interface{}{"type": "number", "default": 1.0},
+				}, "id", "name", "size")
+				properties, err := current.NewProperties(previous)
+				Expect(err).ToNot(HaveOccurred())
+				ids := []string{}
+				for _, property := range properties {
+					ids = append(ids, property.ID)
+				}
+				Expect(ids).To(ConsistOf("description", "size"))
+			})
+
+			It("Rejects removed properties", func() {
+				current := newTestSchema(map[string]interface{}{
+					"id": map[string]interface{}{"type": "string"},
+				}, "id")
+				_, err := current.NewProperties(previous)
+				Expect(err).To(MatchError("Property name of schema test was removed"))
+			})
+
+			It("Rejects type changes", func() {
+				current := newTestSchema(map[string]interface{}{
+					"id":   map[string]interface{}{"type": "string"},
+					"name": map[string]interface{}{"type": "number"},
+				}, "id", "name")
+				_, err := current.NewProperties(previous)
+				Expect(err).To(MatchError("Property name of schema test changed its type"))
+			})
+
+			It("Rejects required properties without default", func() {
+				current := newTestSchema(map[string]interface{}{
+					"id":   map[string]interface{}{"type": "string"},
+					"name": map[string]interface{}{"type": "string"},
+					"size": map[string]interface{}{"type": "number"},
+				}, "id", "name", "size")
+				_, err := current.NewProperties(previous)
+				Expect(err).To(MatchError("New property size of schema test must be nullable or have a default value"))
+			})
+		})
+	})
 })
 
 func getErrorMessage(fieldName string, formatterName string) string {
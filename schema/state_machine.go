@@ -0,0 +1,216 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+)
+
+//ActionStateUpdate is the action name used for state updates done by extensions
+const ActionStateUpdate = "state_update"
+
+//StateMachine restricts changes of a status property to declared transitions
+type StateMachine struct {
+	Property      string
+	States        []string
+	InitialStates []string
+	Transitions   []*Transition
+}
+
+//Transition is an allowed change of state
+//Empty From, Actions or Roles match anything
+type Transition struct {
+	From    []string
+	To      string
+	Actions []string
+	Roles   []string
+}
+
+//StateTransition describes a change of state of a resource
+type StateTransition struct {
+	Property string
+	From     string
+	To       string
+}
+
+//TransitionError is returned when a state transition isn't allowed
+type TransitionError struct {
+	StateTransition
+	Reason string
+	//Denied is set if the transition is defined, but not for the action or the role
+	Denied bool
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("Transition of %s from '%s' to '%s' is not allowed: %s", e.Property, e.From, e.To, e.Reason)
+}
+
+func stringList(raw interface{}) []string {
+	result := []string{}
+	switch raw := raw.(type) {
+	case string:
+		result = append(result, raw)
+	case []interface{}:
+		for _, value := range raw {
+			if str, ok := value.(string); ok {
+				result = append(result, str)
+			}
+		}
+	}
+	return result
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+//NewStateMachine makes StateMachine from obj
+func NewStateMachine(raw interface{}) (*StateMachine, error) {
+	data, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("state_machine should be an object")
+	}
+	stateMachine := &StateMachine{
+		States:        stringList(data["states"]),
+		InitialStates: stringList(data["initial_states"]),
+		Transitions:   []*Transition{},
+	}
+	stateMachine.Property, _ = data["property"].(string)
+	if stateMachine.Property == "" {
+		stateMachine.Property = "status"
+	}
+	if len(stateMachine.States) == 0 {
+		return nil, fmt.Errorf("state_machine should define states")
+	}
+	for _, state := range stateMachine.InitialStates {
+		if !containsString(stateMachine.States, state) {
+			return nil, fmt.Errorf("initial_states uses unknown state '%s'", state)
+		}
+	}
+	rawTransitions, _ := data["transitions"].([]interface{})
+	for _, rawTransition := range rawTransitions {
+		transitionData, ok := rawTransition.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("transition should be an object")
+		}
+		transition := &Transition{
+			From:    stringList(transitionData["from"]),
+			Actions: stringList(transitionData["actions"]),
+			Roles:   stringList(transitionData["roles"]),
+		}
+		transition.To, _ = transitionData["to"].(string)
+		for _, state := range append(transition.From, transition.To) {
+			if !containsString(stateMachine.States, state) {
+				return nil, fmt.Errorf("transition uses unknown state '%s'", state)
+			}
+		}
+		stateMachine.Transitions = append(stateMachine.Transitions, transition)
+	}
+	return stateMachine, nil
+}
+
+func (transition *Transition) matchRoles(auth Authorization) bool {
+	if len(transition.Roles) == 0 || auth == nil {
+		return true
+	}
+	for _, role := range auth.Roles() {
+		for _, principal := range transition.Roles {
+			if role.Match(principal) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//CheckTransition checks if property can be changed from one state to another
+//by the action. Roles are checked only if auth is given.
+//It returns nil transition if the state doesn't change.
+func (stateMachine *StateMachine) CheckTransition(from, to interface{}, action string, auth Authorization) (*StateTransition, error) {
+	if to == nil {
+		return nil, nil
+	}
+	stateTransition := StateTransition{
+		Property: stateMachine.Property,
+		To:       fmt.Sprint(to),
+	}
+	if from != nil {
+		stateTransition.From = fmt.Sprint(from)
+	}
+	if stateTransition.From == stateTransition.To {
+		return nil, nil
+	}
+	if !containsString(stateMachine.States, stateTransition.To) {
+		return nil, &TransitionError{stateTransition, "unknown state", false}
+	}
+	reason := "no transition defined"
+	denied := false
+	for _, transition := range stateMachine.Transitions {
+		if transition.To != stateTransition.To {
+			continue
+		}
+		if len(transition.From) > 0 && !containsString(transition.From, stateTransition.From) {
+			continue
+		}
+		if len(transition.Actions) > 0 && !containsString(transition.Actions, action) {
+			reason = fmt.Sprintf("action %s can't trigger it", action)
+			denied = true
+			continue
+		}
+		if !transition.matchRoles(auth) {
+			reason = "not permitted for your role"
+			denied = true
+			continue
+		}
+		return &stateTransition, nil
+	}
+	return nil, &TransitionError{stateTransition, reason, denied}
+}
+
+//CheckInitialState checks if a resource can be created in the state.
+//Declared initial states are allowed, or if there are none, states reachable
+//from no state by the action.
+func (stateMachine *StateMachine) CheckInitialState(state interface{}, action string, auth Authorization) error {
+	if state == nil {
+		return nil
+	}
+	if len(stateMachine.InitialStates) == 0 {
+		_, err := stateMachine.CheckTransition(nil, state, action, auth)
+		return err
+	}
+	stateTransition := StateTransition{
+		Property: stateMachine.Property,
+		To:       fmt.Sprint(state),
+	}
+	if !containsString(stateMachine.InitialStates, stateTransition.To) {
+		return &TransitionError{stateTransition, "not an initial state", false}
+	}
+	return nil
+}
+
+//Data returns transition as a map, which is passed to extensions
+func (stateTransition *StateTransition) Data() map[string]interface{} {
+	return map[string]interface{}{
+		"property": stateTransition.Property,
+		"from":     stateTransition.From,
+		"to":       stateTransition.To,
+	}
+}
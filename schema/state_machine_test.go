@@ -0,0 +1,118 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("State machine", func() {
+	var stateMachine *StateMachine
+	var admin, member Authorization
+
+	BeforeEach(func() {
+		var err error
+		stateMachine, err = NewStateMachine(map[string]interface{}{
+			"states": []interface{}{"BUILDING", "ACTIVE", "ERROR", "DISABLED"},
+			"transitions": []interface{}{
+				map[string]interface{}{
+					"from":    []interface{}{"BUILDING"},
+					"to":      "ACTIVE",
+					"actions": []interface{}{"state_update"},
+				},
+				map[string]interface{}{
+					"to": "ERROR",
+				},
+				map[string]interface{}{
+					"from":  []interface{}{"ACTIVE"},
+					"to":    "DISABLED",
+					"roles": []interface{}{"admin"},
+				},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		admin = NewAuthorization("tenant", "tenant", "token", []string{"admin"}, nil)
+		member = NewAuthorization("tenant", "tenant", "token", []string{"Member"}, nil)
+	})
+
+	It("Uses status property by default", func() {
+		Expect(stateMachine.Property).To(Equal("status"))
+	})
+
+	It("Allows declared transitions", func() {
+		transition, err := stateMachine.CheckTransition("BUILDING", "ACTIVE", ActionStateUpdate, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(transition.Data()).To(Equal(map[string]interface{}{
+			"property": "status",
+			"from":     "BUILDING",
+			"to":       "ACTIVE",
+		}))
+		_, err = stateMachine.CheckTransition("ACTIVE", "ERROR", ActionUpdate, member)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Ignores unchanged state", func() {
+		transition, err := stateMachine.CheckTransition("ACTIVE", "ACTIVE", ActionUpdate, member)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(transition).To(BeNil())
+	})
+
+	It("Rejects undeclared transitions", func() {
+		_, err := stateMachine.CheckTransition("ERROR", "ACTIVE", ActionStateUpdate, nil)
+		Expect(err).To(MatchError("Transition of status from 'ERROR' to 'ACTIVE' is not allowed: no transition defined"))
+		_, err = stateMachine.CheckTransition("ACTIVE", "DELETED", ActionStateUpdate, nil)
+		Expect(err).To(MatchError("Transition of status from 'ACTIVE' to 'DELETED' is not allowed: unknown state"))
+		Expect(err.(*TransitionError).Denied).To(BeFalse())
+	})
+
+	It("Checks actions and roles", func() {
+		_, err := stateMachine.CheckTransition("BUILDING", "ACTIVE", ActionUpdate, admin)
+		Expect(err).To(MatchError("Transition of status from 'BUILDING' to 'ACTIVE' is not allowed: action update can't trigger it"))
+		_, err = stateMachine.CheckTransition("ACTIVE", "DISABLED", ActionUpdate, member)
+		Expect(err).To(MatchError("Transition of status from 'ACTIVE' to 'DISABLED' is not allowed: not permitted for your role"))
+		Expect(err.(*TransitionError).Denied).To(BeTrue())
+		_, err = stateMachine.CheckTransition("ACTIVE", "DISABLED", ActionUpdate, admin)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Allows initial states reachable from no state", func() {
+		Expect(stateMachine.CheckInitialState(nil, ActionCreate, member)).To(Succeed())
+		Expect(stateMachine.CheckInitialState("ERROR", ActionCreate, member)).To(Succeed())
+		Expect(stateMachine.CheckInitialState("ACTIVE", ActionCreate, member)).To(
+			MatchError("Transition of status from '' to 'ACTIVE' is not allowed: no transition defined"))
+	})
+
+	It("Allows declared initial states", func() {
+		var err error
+		stateMachine, err = NewStateMachine(map[string]interface{}{
+			"states":         []interface{}{"BUILDING", "ACTIVE"},
+			"initial_states": []interface{}{"BUILDING"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stateMachine.CheckInitialState("BUILDING", ActionCreate, member)).To(Succeed())
+		Expect(stateMachine.CheckInitialState("ACTIVE", ActionCreate, member)).To(
+			MatchError("Transition of status from '' to 'ACTIVE' is not allowed: not an initial state"))
+	})
+
+	It("Rejects transitions to unknown states", func() {
+		_, err := NewStateMachine(map[string]interface{}{
+			"states":      []interface{}{"ACTIVE"},
+			"transitions": []interface{}{map[string]interface{}{"to": "ERROR"}},
+		})
+		Expect(err).To(MatchError("transition uses unknown state 'ERROR'"))
+	})
+})
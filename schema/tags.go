@@ -0,0 +1,95 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+//TagsPropertyID is an ID of property holding tags of resources
+const TagsPropertyID = "tags"
+
+func getTagsPropertyObj() map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "object",
+		"title":       "Tags",
+		"description": "key value tags",
+		"permission":  []interface{}{"create", "update"},
+		"patternProperties": map[string]interface{}{
+			".*": map[string]interface{}{"type": "string"},
+		},
+	}
+}
+
+//IsTagsProperty checks if property holds tags of a tagged schema
+func (schema *Schema) IsTagsProperty(property *Property) bool {
+	return schema.Tagging && property.ID == TagsPropertyID
+}
+
+//ParseTag splits tag filter in key:value format
+//Filter without value matches any value of the key
+func ParseTag(tag string) (key, value string, hasValue bool) {
+	i := strings.Index(tag, ":")
+	if i < 0 {
+		return tag, "", false
+	}
+	return tag[:i], tag[i+1:], true
+}
+
+//TagsMap converts value of tags property to a map
+func TagsMap(value interface{}) map[string]string {
+	tags := map[string]string{}
+	switch value := value.(type) {
+	case map[string]string:
+		for key, tagValue := range value {
+			tags[key] = tagValue
+		}
+	case map[string]interface{}:
+		for key, tagValue := range value {
+			tags[key] = fmt.Sprint(tagValue)
+		}
+	}
+	return tags
+}
+
+//MatchTags checks if tags match all tag filters
+func MatchTags(value interface{}, filters []string) bool {
+	tags := TagsMap(value)
+	for _, filter := range filters {
+		key, filterValue, hasValue := ParseTag(filter)
+		tagValue, ok := tags[key]
+		if !ok || (hasValue && tagValue != filterValue) {
+			return false
+		}
+	}
+	return true
+}
+
+//MergeTags returns tags with added tags set and tags of removed keys deleted
+func MergeTags(value interface{}, added map[string]interface{}, removed []string) map[string]interface{} {
+	tags := map[string]interface{}{}
+	for key, tagValue := range TagsMap(value) {
+		tags[key] = tagValue
+	}
+	for key, tagValue := range added {
+		tags[key] = fmt.Sprint(tagValue)
+	}
+	for _, key := range removed {
+		delete(tags, key)
+	}
+	return tags
+}
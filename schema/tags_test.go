@@ -0,0 +1,73 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tags", func() {
+	AfterEach(func() {
+		ClearManager()
+	})
+
+	It("Adds tags property to tagged schemas", func() {
+		schema, err := NewSchemaFromObj(map[string]interface{}{
+			"id":          "server",
+			"plural":      "servers",
+			"singular":    "server",
+			"title":       "Server",
+			"description": "Server",
+			"tagging":     true,
+			"schema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id": map[string]interface{}{"type": "string"},
+				},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		property, err := schema.GetPropertyByID(TagsPropertyID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(property.Type).To(Equal("object"))
+		Expect(schema.IsTagsProperty(property)).To(BeTrue())
+		Expect(schema.GetTagTableName()).To(Equal("servers_tags"))
+	})
+
+	It("Parses tag filters", func() {
+		key, value, hasValue := ParseTag("env:prod")
+		Expect([]interface{}{key, value, hasValue}).To(Equal([]interface{}{"env", "prod", true}))
+		key, _, hasValue = ParseTag("env")
+		Expect(key).To(Equal("env"))
+		Expect(hasValue).To(BeFalse())
+	})
+
+	It("Matches tags", func() {
+		tags := map[string]interface{}{"env": "prod", "team": "net"}
+		Expect(MatchTags(tags, []string{"env:prod", "team"})).To(BeTrue())
+		Expect(MatchTags(tags, []string{"env:dev"})).To(BeFalse())
+		Expect(MatchTags(nil, []string{"env"})).To(BeFalse())
+		Expect(MatchTags(nil, nil)).To(BeTrue())
+	})
+
+	It("Merges tags", func() {
+		tags := map[string]interface{}{"env": "prod", "team": "net"}
+		Expect(MergeTags(tags, map[string]interface{}{"env": "dev"}, []string{"team"})).To(Equal(
+			map[string]interface{}{"env": "dev"}))
+		Expect(tags).To(HaveLen(2))
+	})
+})
@@ -19,13 +19,17 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/cloudwan/gohan/cloud"
 	"github.com/cloudwan/gohan/db"
 	"github.com/cloudwan/gohan/extension"
+	l "github.com/cloudwan/gohan/log"
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/server/middleware"
 	"github.com/cloudwan/gohan/server/resources"
 	"github.com/cloudwan/gohan/sync"
+	"github.com/cloudwan/gohan/util"
 	"github.com/drone/routes"
 	"github.com/go-martini/martini"
 )
@@ -37,18 +41,24 @@ var (
 
 func authorization(w http.ResponseWriter, r *http.Request, action, path string, s *schema.Schema, auth schema.Authorization) (*schema.Policy, *schema.Role) {
 	manager := schema.GetManager()
-	log.Debug("[authorization*] %s %v", action, auth)
+	logger := requestLogger(r)
+	logger.Debug("[authorization*] %s %v", action, auth)
 	if auth == nil {
 		return schema.NewEmptyPolicy(), nil
 	}
 	policy, role := manager.PolicyValidate(action, path, auth)
 	if policy == nil {
-		log.Debug("No maching policy: %s %s", action, path)
+		logger.Debug("No maching policy: %s %s", action, path)
 		return nil, nil
 	}
 	return policy, role
 }
 
+//requestLogger makes logger of the request with ID set by Logging middleware
+func requestLogger(r *http.Request) *l.RequestLogger {
+	return l.NewRequestLogger(log, r.Header.Get("X-Request-ID"))
+}
+
 func addParamToQuery(r *http.Request, key, value string) {
 	r.URL.RawQuery += "&" + key + "=" + value
 }
@@ -166,6 +176,31 @@ func fillInContext(context middleware.Context, r *http.Request, w http.ResponseW
 	context["sync"] = sync
 	context["identity_service"] = identityService
 	context["service_auth"], _ = identityService.GetServiceAuthorization()
+	context["languages"] = requestLanguages(r)
+	handleDeprecation(context, r, w, s)
+}
+
+//handleDeprecation sets deprecation headers of deprecated schemas
+//and logs which tenants still use them
+func handleDeprecation(context middleware.Context, r *http.Request, w http.ResponseWriter, s *schema.Schema) {
+	deprecation := s.GetDeprecation()
+	if deprecation == nil {
+		return
+	}
+	deprecation.SetHeaders(w.Header())
+	if deprecation.IsDeprecated(time.Now()) {
+		tenantID, _ := context["tenant_id"].(string)
+		l.ContextLogger(log, context).Warning("Deprecated API %s %s of schema %s is used by tenant %s", r.Method, r.URL.Path, s.ID, tenantID)
+	}
+}
+
+//requestLanguages returns languages of Accept-Language header followed by default language
+func requestLanguages(r *http.Request) []string {
+	languages := schema.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if defaultLanguage := util.GetConfig().GetString("default_language", ""); defaultLanguage != "" {
+		languages = append(languages, defaultLanguage)
+	}
+	return languages
 }
 
 //MapRouteBySchema setup api route by schema
@@ -304,12 +339,67 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 			putSingleFunc(w, r, p, identityService, context)
 		})
 
+	//setup tag routes
+	if s.Tagging {
+		getTagsFunc := func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+			addJSONContentTypeHeader(w)
+			fillInContext(context, r, w, s, server.sync, identityService)
+			id := p["id"]
+			if err := resources.GetSingleResource(context, dataStore, s, id); err != nil {
+				handleError(w, err)
+				return
+			}
+			routes.ServeJson(w, responseTags(s, context))
+		}
+		postTagsFunc := func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+			addJSONContentTypeHeader(w)
+			fillInContext(context, r, w, s, server.sync, identityService)
+			id := p["id"]
+			dataMap, err := middleware.ReadJSON(r)
+			if err != nil {
+				handleError(w, resources.NewResourceError(err, fmt.Sprintf("Failed to parse data: %s", err), resources.WrongData))
+				return
+			}
+			added, ok := dataMap[schema.TagsPropertyID].(map[string]interface{})
+			if !ok {
+				err := fmt.Errorf("%s should be an object", schema.TagsPropertyID)
+				handleError(w, resources.NewResourceError(err, err.Error(), resources.WrongData))
+				return
+			}
+			if err := resources.UpdateResourceTags(context, dataStore, identityService, s, id, added, nil); err != nil {
+				handleError(w, err)
+				return
+			}
+			routes.ServeJson(w, responseTags(s, context))
+		}
+		deleteTagFunc := func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+			addJSONContentTypeHeader(w)
+			fillInContext(context, r, w, s, server.sync, identityService)
+			id := p["id"]
+			if err := resources.UpdateResourceTags(context, dataStore, identityService, s, id, nil, []string{p["key"]}); err != nil {
+				handleError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+		for _, url := range []string{singleURL, singleURLWithParents} {
+			route.Get(url+"/tags", middleware.Authorization(schema.ActionRead), getTagsFunc)
+			route.Post(url+"/tags", middleware.Authorization(schema.ActionUpdate), postTagsFunc)
+			route.Delete(url+"/tags/:key", middleware.Authorization(schema.ActionUpdate), deleteTagFunc)
+		}
+	}
+
 	//Custom action support
 	for _, actionExt := range s.Actions {
 		action := actionExt
 		ActionFunc := func(w http.ResponseWriter, r *http.Request, p martini.Params,
 			identityService middleware.IdentityService, auth schema.Authorization, context middleware.Context) {
 			addJSONContentTypeHeader(w)
+			context["action"] = action.ID
+			context["tenant_id"] = auth.TenantID()
+			context["auth_token"] = auth.AuthToken()
+			context["catalog"] = auth.Catalog()
+			context["auth"] = auth
 			fillInContext(context, r, w, s, server.sync, identityService)
 			id := p["id"]
 			input, err := middleware.ReadJSON(r)
@@ -323,11 +413,7 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 				return
 			}
 			context["policy"] = policy
-			context["tenant_id"] = auth.TenantID()
-			context["auth_token"] = auth.AuthToken()
 			context["role"] = role
-			context["catalog"] = auth.Catalog()
-			context["auth"] = auth
 
 			if err != nil {
 				handleError(w, resources.NewResourceError(err, fmt.Sprintf("Failed to parse data: %s", err), resources.WrongData))
@@ -345,6 +431,17 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 	}
 }
 
+//responseTags returns tags of the resource in response
+func responseTags(s *schema.Schema, context middleware.Context) map[string]interface{} {
+	response, _ := context["response"].(map[string]interface{})
+	resource, _ := response[s.Singular].(map[string]interface{})
+	tags, ok := resource[schema.TagsPropertyID]
+	if !ok {
+		tags = map[string]interface{}{}
+	}
+	return map[string]interface{}{schema.TagsPropertyID: tags}
+}
+
 //MapRouteBySchemas setup route for all loaded schema
 func MapRouteBySchemas(server *Server, dataStore db.DB) {
 	route := server.martini
@@ -380,11 +477,187 @@ func MapRouteBySchemas(server *Server, dataStore db.DB) {
 		}
 		routes.ServeJson(w, responses)
 	})
+	route.Get("/_graph", func(w http.ResponseWriter, r *http.Request, auth schema.Authorization) {
+		schemas := []*schema.Schema{}
+		for _, s := range schemaManager.OrderedSchemas() {
+			if policy, _ := authorization(w, r, schema.ActionRead, s.GetPluralURL(), s, auth); policy != nil {
+				schemas = append(schemas, s)
+			}
+		}
+		graph := schema.NewGraph(schemas)
+		query := r.URL.Query()
+		if focus := query.Get("focus"); focus != "" {
+			depth := 1
+			if query.Get("depth") != "" {
+				var err error
+				depth, err = strconv.Atoi(query.Get("depth"))
+				if err != nil {
+					middleware.HTTPJSONError(w, "depth should be an integer", http.StatusBadRequest)
+					return
+				}
+			}
+			var err error
+			graph, err = graph.Focus(focus, depth)
+			if err != nil {
+				middleware.HTTPJSONError(w, err.Error(), http.StatusNotFound)
+				return
+			}
+		}
+		switch format := query.Get("format"); format {
+		case "", "json":
+			routes.ServeJson(w, graph)
+		case "dot", "mermaid":
+			output, _ := graph.Format(format)
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, output)
+		default:
+			middleware.HTTPJSONError(w, fmt.Sprintf("Unknown graph format %s", format), http.StatusBadRequest)
+		}
+	})
+	route.Post(policyExplainPath, func(w http.ResponseWriter, r *http.Request, auth schema.Authorization, identityService middleware.IdentityService) {
+		if policy, _ := authorization(w, r, schema.ActionRead, policyExplainPath, nil, auth); policy == nil {
+			middleware.HTTPJSONError(w, "Only admin can explain policies", http.StatusUnauthorized)
+			return
+		}
+		input, err := middleware.ReadJSON(r)
+		if err != nil {
+			middleware.HTTPJSONError(w, fmt.Sprintf("Failed to parse data: %s", err), http.StatusBadRequest)
+			return
+		}
+		action, _ := input["action"].(string)
+		path, _ := input["path"].(string)
+		if action == "" || path == "" {
+			middleware.HTTPJSONError(w, "action and path are required", http.StatusBadRequest)
+			return
+		}
+		target, err := explainedAuthorization(input, auth, identityService)
+		if err != nil {
+			middleware.HTTPJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		routes.ServeJson(w, schemaManager.ExplainPolicies(action, path, target))
+	})
+	route.Get(tenantDirectoryPath, func(w http.ResponseWriter, r *http.Request, auth schema.Authorization, identityService middleware.IdentityService) {
+		if policy, _ := authorization(w, r, schema.ActionRead, tenantDirectoryPath, nil, auth); policy == nil {
+			middleware.HTTPJSONError(w, "Only admin can view tenants", http.StatusUnauthorized)
+			return
+		}
+		keystoneIdentity := findKeystoneIdentity(identityService)
+		if keystoneIdentity == nil {
+			middleware.HTTPJSONError(w, "Keystone isn't configured", http.StatusNotFound)
+			return
+		}
+		query := r.URL.Query()
+		tenants := map[string]string{}
+		var err error
+		if query["id"] == nil && query["name"] == nil {
+			tenants, err = keystoneIdentity.Tenants()
+		} else {
+			err = lookupTenants(keystoneIdentity, query["id"], query["name"], tenants)
+		}
+		if err != nil {
+			middleware.HTTPJSONError(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		tenantList := []map[string]string{}
+		for tenantID, tenantName := range tenants {
+			tenantList = append(tenantList, map[string]string{"id": tenantID, "name": tenantName})
+		}
+		routes.ServeJson(w, map[string]interface{}{
+			"tenants": tenantList,
+			"stats":   keystoneIdentity.TenantDirectoryStats(),
+		})
+	})
+	route.Delete(tenantDirectoryPath, func(w http.ResponseWriter, r *http.Request, auth schema.Authorization, identityService middleware.IdentityService) {
+		if policy, _ := authorization(w, r, schema.ActionDelete, tenantDirectoryPath, nil, auth); policy == nil {
+			middleware.HTTPJSONError(w, "Only admin can flush tenants", http.StatusUnauthorized)
+			return
+		}
+		keystoneIdentity := findKeystoneIdentity(identityService)
+		if keystoneIdentity == nil {
+			middleware.HTTPJSONError(w, "Keystone isn't configured", http.StatusNotFound)
+			return
+		}
+		keystoneIdentity.FlushTenants()
+		w.WriteHeader(http.StatusNoContent)
+	})
 	for _, s := range schemaManager.Schemas() {
 		MapRouteBySchema(server, dataStore, s)
 	}
 }
 
+//policyExplainPath is a path of API explaining policies, allowed by policies matching it
+const policyExplainPath = "/_policy/explain"
+
+//tenantDirectoryPath is a path of API viewing and flushing cached keystone tenants
+const tenantDirectoryPath = "/_tenants"
+
+//findKeystoneIdentity returns keystone identity in the chain of identity services, or nil
+func findKeystoneIdentity(identityService middleware.IdentityService) *cloud.KeystoneIdentity {
+	for _, identity := range middleware.WrappedIdentityServices(identityService) {
+		if keystoneIdentity, ok := identity.(*cloud.KeystoneIdentity); ok {
+			return keystoneIdentity
+		}
+	}
+	return nil
+}
+
+//lookupTenants adds tenants of the given IDs and names to tenants
+func lookupTenants(keystoneIdentity *cloud.KeystoneIdentity, tenantIDs, tenantNames []string, tenants map[string]string) error {
+	if len(tenantIDs) > 0 {
+		names, err := keystoneIdentity.GetTenantNames(tenantIDs)
+		if err != nil {
+			return err
+		}
+		for tenantID, tenantName := range names {
+			tenants[tenantID] = tenantName
+		}
+	}
+	if len(tenantNames) > 0 {
+		ids, err := keystoneIdentity.GetTenantIDs(tenantNames)
+		if err != nil {
+			return err
+		}
+		for tenantName, tenantID := range ids {
+			tenants[tenantID] = tenantName
+		}
+	}
+	return nil
+}
+
+//explainedAuthorization returns authorization of token or synthetic authorization in input,
+//or authorization of the caller if neither is given
+func explainedAuthorization(input map[string]interface{}, auth schema.Authorization, identityService middleware.IdentityService) (schema.Authorization, error) {
+	if token, ok := input["token"].(string); ok && token != "" {
+		target, err := identityService.VerifyToken(token)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid token: %s", err)
+		}
+		return target, nil
+	}
+	rawAuthorization, ok := input["authorization"].(map[string]interface{})
+	if !ok {
+		return auth, nil
+	}
+	tenantID, _ := rawAuthorization["tenant_id"].(string)
+	tenantName, _ := rawAuthorization["tenant_name"].(string)
+	if anonymous, _ := rawAuthorization["anonymous"].(bool); anonymous {
+		return schema.NewAnonymousAuthorization(tenantID, tenantName), nil
+	}
+	userID, _ := rawAuthorization["user_id"].(string)
+	roles := []string{}
+	rawRoles, _ := rawAuthorization["roles"].([]interface{})
+	for _, role := range rawRoles {
+		roles = append(roles, fmt.Sprint(role))
+	}
+	groups := []string{}
+	rawGroups, _ := rawAuthorization["groups"].([]interface{})
+	for _, group := range rawGroups {
+		groups = append(groups, fmt.Sprint(group))
+	}
+	return schema.NewUserAuthorization(tenantID, tenantName, "", userID, roles, groups, nil), nil
+}
+
 // MapNamespacesRoutes maps routes for all namespaces
 func MapNamespacesRoutes(route martini.Router) {
 	manager := schema.GetManager()
@@ -405,11 +678,13 @@ func mapTopLevelNamespaceRoute(route martini.Router, namespace *schema.Namespace
 	route.Get(
 		namespace.GetFullPrefix()+"/",
 		func(w http.ResponseWriter, r *http.Request, p martini.Params, context martini.Context) {
+			now := time.Now()
 			versions := []schema.Version{}
 			for _, childNamespace := range schema.GetManager().Namespaces() {
 				if childNamespace.Parent == namespace.ID {
+					deprecation := childNamespace.GetDeprecation()
 					versions = append(versions, schema.Version{
-						Status: "SUPPORTED",
+						Status: childNamespace.VersionStatus(now),
 						ID:     childNamespace.Prefix,
 						Links: []schema.Link{
 							schema.Link{
@@ -417,12 +692,17 @@ func mapTopLevelNamespaceRoute(route martini.Router, namespace *schema.Namespace
 								Rel:  "self",
 							},
 						},
+						Deprecated: deprecation.DateString(),
+						Sunset:     deprecation.SunsetString(),
 					})
 				}
 			}
 
-			if len(versions) != 0 {
-				versions[len(versions)-1].Status = "CURRENT"
+			for i := len(versions) - 1; i >= 0; i-- {
+				if versions[i].Status != schema.VersionDeprecated {
+					versions[i].Status = schema.VersionCurrent
+					break
+				}
 			}
 
 			routes.ServeJson(w, map[string][]schema.Version{"versions": versions})
@@ -436,9 +716,11 @@ func mapChildNamespaceRoute(route martini.Router, namespace *schema.Namespace) {
 	route.Get(
 		namespace.GetFullPrefix(),
 		func(w http.ResponseWriter, r *http.Request, p martini.Params, context martini.Context) {
+			namespace.GetDeprecation().SetHeaders(w.Header())
 			resources := []schema.NamespaceResource{}
 			for _, s := range schema.GetManager().Schemas() {
 				if s.NamespaceID == namespace.ID {
+					deprecation := s.GetDeprecation()
 					resources = append(resources, schema.NamespaceResource{
 						Links: []schema.Link{
 							schema.Link{
@@ -448,6 +730,8 @@ func mapChildNamespaceRoute(route martini.Router, namespace *schema.Namespace) {
 						},
 						Name:       s.Singular,
 						Collection: s.Plural,
+						Deprecated: deprecation.DateString(),
+						Sunset:     deprecation.SunsetString(),
 					})
 				}
 			}
@@ -0,0 +1,316 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/extension"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/util"
+)
+
+const (
+	apiKeySchemaID = "api_key"
+	//apiKeyCallback is a go extension handling events of api_key schema
+	apiKeyCallback = "gohan_api_key"
+	//apiKeyUserPrefix prefixes user ID of authorizations of API keys
+	apiKeyUserPrefix = "api_key:"
+)
+
+//apiKeyInternalProperties are managed by gohan and can't be set through API
+var apiKeyInternalProperties = []string{"secret_hash", "revoked"}
+
+func init() {
+	extension.RegisterGoCallback(apiKeyCallback, handleAPIKeyEvent)
+}
+
+//newAPIKeySecret returns a random secret and its hash
+func newAPIKeySecret() (secret, hash string, err error) {
+	data := make([]byte, 32)
+	if _, err = rand.Read(data); err != nil {
+		return "", "", err
+	}
+	secret = hex.EncodeToString(data)
+	return secret, hashAPIKeySecret(secret), nil
+}
+
+func hashAPIKeySecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+//handleAPIKeyEvent generates and hashes secrets of API keys, and hides hashes in responses
+func handleAPIKeyEvent(event string, context map[string]interface{}) error {
+	switch event {
+	case "pre_create", "pre_update":
+		data, _ := context["resource"].(map[string]interface{})
+		if err := validateAPIKey(context, data); err != nil {
+			context["exception"] = apiKeyErrorInfo(err)
+			context["exception_message"] = err.Error()
+			return nil
+		}
+		if event == "pre_create" {
+			secret, hash, err := newAPIKeySecret()
+			if err != nil {
+				return err
+			}
+			data["secret_hash"] = hash
+			context["api_key_secret"] = secret
+		}
+	case "post_create":
+		apiKey := hideAPIKeySecretHash(context)
+		if secret, ok := context["api_key_secret"].(string); ok && apiKey != nil {
+			apiKey["secret"] = fmt.Sprintf("%v.%s", apiKey["id"], secret)
+		}
+	case "pre_rotate_in_transaction", "pre_revoke_in_transaction":
+		if err := updateAPIKey(context, event == "pre_rotate_in_transaction"); err != nil {
+			context["exception"] = apiKeyErrorInfo(err)
+			context["exception_message"] = err.Error()
+		}
+	default:
+		if strings.HasPrefix(event, "post_") {
+			hideAPIKeySecretHash(context)
+		}
+	}
+	return nil
+}
+
+//apiKeyError is an error of API key request with HTTP status code
+type apiKeyError struct {
+	code    int
+	message string
+}
+
+func (err apiKeyError) Error() string {
+	return err.message
+}
+
+func apiKeyException(code int, format string, args ...interface{}) error {
+	return apiKeyError{code, fmt.Sprintf(format, args...)}
+}
+
+func apiKeyErrorInfo(err error) map[string]interface{} {
+	code := http.StatusBadRequest
+	if keyErr, ok := err.(apiKeyError); ok {
+		code = keyErr.code
+	}
+	return map[string]interface{}{"name": "CustomException", "code": code, "message": err.Error()}
+}
+
+//validateAPIKey checks API key data given by user
+func validateAPIKey(context map[string]interface{}, data map[string]interface{}) error {
+	for _, key := range apiKeyInternalProperties {
+		if _, ok := data[key]; ok {
+			return apiKeyException(http.StatusBadRequest, "%s can't be set", key)
+		}
+	}
+	if rawExpiry, ok := data["expires_at"].(string); ok && rawExpiry != "" {
+		if _, err := time.Parse(time.RFC3339, rawExpiry); err != nil {
+			return apiKeyException(http.StatusBadRequest, "expires_at should be RFC3339 time: %s", err)
+		}
+	}
+	rawCIDRs, _ := data["allowed_cidrs"].([]interface{})
+	for _, rawCIDR := range rawCIDRs {
+		if _, _, err := net.ParseCIDR(fmt.Sprint(rawCIDR)); err != nil {
+			return apiKeyException(http.StatusBadRequest, "Invalid allowed CIDR %v", rawCIDR)
+		}
+	}
+	auth, _ := context["auth"].(schema.Authorization)
+	rawRoles, _ := data["roles"].([]interface{})
+	for _, rawRole := range rawRoles {
+		if auth != nil && !canGrantRole(auth, fmt.Sprint(rawRole)) {
+			return apiKeyException(http.StatusUnauthorized, "Role %v can't be granted by this user", rawRole)
+		}
+	}
+	return nil
+}
+
+//canGrantRole checks if user has the role, directly or through role hierarchy,
+//or is an administrator of API keys
+func canGrantRole(auth schema.Authorization, role string) bool {
+	adminRole := util.GetConfig().GetString("api_keys/admin_role", "admin")
+	hierarchy := schema.GetManager().RoleHierarchy()
+	for _, userRole := range auth.Roles() {
+		if userRole.Name == adminRole {
+			return true
+		}
+		for _, implied := range hierarchy.Implied(userRole.Name) {
+			if implied == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//updateAPIKey rotates secret of API key, or revokes it
+func updateAPIKey(context map[string]interface{}, rotate bool) error {
+	tx, ok := context["transaction"].(transaction.Transaction)
+	if !ok {
+		return fmt.Errorf("No transaction for API key request")
+	}
+	apiKeySchema, _ := schema.GetManager().Schema(apiKeySchemaID)
+	policy, ok := context["policy"].(*schema.Policy)
+	if !ok {
+		return apiKeyException(http.StatusUnauthorized, "No policy for API key request")
+	}
+	auth, ok := context["auth"].(schema.Authorization)
+	if !ok {
+		return apiKeyException(http.StatusUnauthorized, "No authorization for API key request")
+	}
+	resource, err := tx.Fetch(apiKeySchema, context["id"], policy.GetTenantIDFilter(schema.ActionUpdate, auth.TenantID()))
+	if err != nil {
+		return apiKeyException(http.StatusNotFound, "API key %v not found", context["id"])
+	}
+	data := resource.Data()
+	secret := ""
+	if rotate {
+		var hash string
+		secret, hash, err = newAPIKeySecret()
+		if err != nil {
+			return err
+		}
+		data["secret_hash"] = hash
+	} else {
+		data["revoked"] = true
+	}
+	updated, err := schema.NewResource(apiKeySchema, data)
+	if err != nil {
+		return err
+	}
+	if err := tx.Update(updated); err != nil {
+		return err
+	}
+	apiKey := map[string]interface{}{}
+	for key, value := range data {
+		apiKey[key] = value
+	}
+	delete(apiKey, "secret_hash")
+	if rotate {
+		apiKey["secret"] = fmt.Sprintf("%s.%s", resource.ID(), secret)
+	}
+	context["response"] = map[string]interface{}{apiKeySchema.Singular: apiKey}
+	return nil
+}
+
+//hideAPIKeySecretHash removes secret hashes of API keys in response, and returns single API key
+func hideAPIKeySecretHash(context map[string]interface{}) map[string]interface{} {
+	response, _ := context["response"].(map[string]interface{})
+	apiKeySchema, ok := schema.GetManager().Schema(apiKeySchemaID)
+	if response == nil || !ok {
+		return nil
+	}
+	apiKeys, _ := response[apiKeySchema.Plural].([]interface{})
+	for _, rawAPIKey := range apiKeys {
+		if apiKey, ok := rawAPIKey.(map[string]interface{}); ok {
+			delete(apiKey, "secret_hash")
+		}
+	}
+	apiKey, _ := response[apiKeySchema.Singular].(map[string]interface{})
+	delete(apiKey, "secret_hash")
+	return apiKey
+}
+
+//apiKeyIdentity accepts API keys in addition to tokens of identity service
+type apiKeyIdentity struct {
+	middleware.IdentityService
+	db db.DB
+}
+
+//WrappedIdentityService returns identity service verifying tokens
+func (identity *apiKeyIdentity) WrappedIdentityService() middleware.IdentityService {
+	return identity.IdentityService
+}
+
+//VerifyAPIKey verifies API key of the request, given as <id>.<secret>
+func (identity *apiKeyIdentity) VerifyAPIKey(apiKey string, req *http.Request) (schema.Authorization, error) {
+	apiKeySchema, ok := schema.GetManager().Schema(apiKeySchemaID)
+	if !ok {
+		return nil, fmt.Errorf("API keys are not supported")
+	}
+	parts := strings.SplitN(apiKey, ".", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Invalid API key")
+	}
+	tx, err := identity.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+	resource, err := tx.Fetch(apiKeySchema, parts[0], nil)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid API key")
+	}
+	hash, _ := resource.Get("secret_hash").(string)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashAPIKeySecret(parts[1]))) != 1 {
+		return nil, fmt.Errorf("Invalid API key")
+	}
+	if revoked, _ := resource.Get("revoked").(bool); revoked {
+		return nil, fmt.Errorf("API key is revoked")
+	}
+	if rawExpiry, _ := resource.Get("expires_at").(string); rawExpiry != "" {
+		expiry, err := time.Parse(time.RFC3339, rawExpiry)
+		if err != nil || !time.Now().Before(expiry) {
+			return nil, fmt.Errorf("API key is expired")
+		}
+	}
+	if !apiKeyAllowsAddress(resource.Get("allowed_cidrs"), req.RemoteAddr) {
+		return nil, fmt.Errorf("API key isn't allowed from %s", req.RemoteAddr)
+	}
+	tenantID, _ := resource.Get("tenant_id").(string)
+	tenantName, _ := identity.GetTenantName(tenantID)
+	roles := []string{}
+	rawRoles, _ := resource.Get("roles").([]interface{})
+	for _, role := range rawRoles {
+		roles = append(roles, fmt.Sprint(role))
+	}
+	return schema.NewUserAuthorization(tenantID, tenantName, "", apiKeyUserPrefix+resource.ID(), roles, nil, nil), nil
+}
+
+//apiKeyAllowsAddress checks if remote address is in allowed CIDRs, which allow any address if empty
+func apiKeyAllowsAddress(rawCIDRs interface{}, remoteAddr string) bool {
+	cidrs, _ := rawCIDRs.([]interface{})
+	if len(cidrs) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, rawCIDR := range cidrs {
+		_, network, err := net.ParseCIDR(fmt.Sprint(rawCIDR))
+		if err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
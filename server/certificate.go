@@ -0,0 +1,115 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	gotls "crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/cloudwan/gohan/cloud"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/util"
+)
+
+//clientAuthTypes are allowed values of tls/client_auth
+var clientAuthTypes = map[string]gotls.ClientAuthType{
+	"verify_if_given": gotls.VerifyClientCertIfGiven,
+	"require":         gotls.RequireAndVerifyClientCert,
+}
+
+//newClientTLSConfig returns TLS configuration verifying client certificates by configured CA,
+//or nil if no client CA is configured
+func newClientTLSConfig(config *util.Config) (*gotls.Config, error) {
+	caFile := config.GetString("tls/client_ca_file", "")
+	if caFile == "" {
+		return nil, nil
+	}
+	clientAuth, ok := clientAuthTypes[config.GetString("tls/client_auth", "verify_if_given")]
+	if !ok {
+		return nil, fmt.Errorf("tls/client_auth should be verify_if_given or require")
+	}
+	caCerts, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCerts) {
+		return nil, fmt.Errorf("No certificate found in %s", caFile)
+	}
+	return &gotls.Config{ClientCAs: pool, ClientAuth: clientAuth}, nil
+}
+
+//newCertificateIdentity makes certificate identity from tls/client_certificates configuration
+func newCertificateIdentity(config *util.Config) (*cloud.CertificateIdentity, error) {
+	certificateConfig := cloud.CertificateConfig{
+		Tenants: map[string]string{},
+		ServiceAuthorization: schema.NewAuthorization(
+			config.GetString("tls/service_authorization/tenant_id", ""),
+			config.GetString("tls/service_authorization/tenant_name", ""),
+			"",
+			config.GetStringList("tls/service_authorization/roles", []string{"admin"}),
+			nil,
+		),
+	}
+	for _, rawMapping := range config.GetList("tls/client_certificates", nil) {
+		mappingData, _ := rawMapping.(map[string]interface{})
+		mapping := cloud.CertificateMapping{Patterns: map[string]string{}}
+		for key, value := range mappingData {
+			switch key {
+			case "tenant_id":
+				mapping.TenantID = fmt.Sprint(value)
+			case "tenant_name":
+				mapping.TenantName = fmt.Sprint(value)
+			case "user_id":
+				mapping.UserID = fmt.Sprint(value)
+			case "roles":
+				roles, _ := value.([]interface{})
+				for _, role := range roles {
+					mapping.Roles = append(mapping.Roles, fmt.Sprint(role))
+				}
+			default:
+				mapping.Patterns[key] = fmt.Sprint(value)
+			}
+		}
+		certificateConfig.Mappings = append(certificateConfig.Mappings, mapping)
+	}
+	for _, rawTenant := range config.GetList("tls/tenants", nil) {
+		tenant, _ := rawTenant.(map[string]interface{})
+		tenantID, _ := tenant["id"].(string)
+		tenantName, _ := tenant["name"].(string)
+		certificateConfig.Tenants[tenantID] = tenantName
+	}
+	return cloud.NewCertificateIdentity(certificateConfig)
+}
+
+//certificateIdentity accepts client certificates in addition to tokens of identity service
+type certificateIdentity struct {
+	middleware.IdentityService
+	certificates *cloud.CertificateIdentity
+}
+
+//VerifyCertificate maps client certificate to authorization
+func (identity *certificateIdentity) VerifyCertificate(cert *x509.Certificate) (schema.Authorization, error) {
+	return identity.certificates.VerifyCertificate(cert)
+}
+
+//WrappedIdentityService returns identity service verifying tokens
+func (identity *certificateIdentity) WrappedIdentityService() middleware.IdentityService {
+	return identity.IdentityService
+}
@@ -20,13 +20,11 @@ import (
 
 	"github.com/robfig/cron"
 
-	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/util"
 )
 
 //CRON Process
 func startCRONProcess(server *Server) {
-	manager := schema.GetManager()
 	config := util.GetConfig()
 	jobList := config.GetParam("cron", nil)
 	if jobList == nil {
@@ -38,8 +36,7 @@ func startCRONProcess(server *Server) {
 		job := rawJob.(map[string]interface{})
 		path := job["path"].(string)
 		timing := job["timing"].(string)
-		env := newEnvironment(server.db, server.keystoneIdentity)
-		err := env.LoadExtensionsForPath(manager.Extensions, path)
+		err := server.registerBackgroundEnvironment(path)
 		if err != nil {
 			log.Fatal(fmt.Sprintf("Extensions parsing error: %v", err))
 		}
@@ -53,25 +50,33 @@ func startCRONProcess(server *Server) {
 			defer func() {
 				server.sync.Unlock(lockKey)
 			}()
-			tx, err := server.db.Begin()
-			defer tx.Close()
-			context := map[string]interface{}{
-				"path": path,
-			}
-			if err != nil {
-				log.Warning(fmt.Sprintf("extension error: %s", err))
-				return
-			}
-			if err := env.HandleEvent("notification", context); err != nil {
-				log.Warning(fmt.Sprintf("extension error: %s", err))
-				return
-			}
-			err = tx.Commit()
-			if err != nil {
-				log.Warning(fmt.Sprintf("extension error: %s", err))
-				return
-			}
-			return
+			err = func() error {
+				env, err := backgroundEnvironment(path)
+				if err != nil {
+					log.Warning(fmt.Sprintf("extension error: %s", err))
+					return err
+				}
+				tx, err := server.db.Begin()
+				defer tx.Close()
+				context := map[string]interface{}{
+					"path": path,
+				}
+				if err != nil {
+					log.Warning(fmt.Sprintf("extension error: %s", err))
+					return err
+				}
+				if err := env.HandleEvent("notification", context); err != nil {
+					log.Warning(fmt.Sprintf("extension error: %s", err))
+					return err
+				}
+				err = tx.Commit()
+				if err != nil {
+					log.Warning(fmt.Sprintf("extension error: %s", err))
+					return err
+				}
+				return nil
+			}()
+			notifications.Inc("cron", notificationResult(err))
 		})
 	}
 	c.Start()
@@ -0,0 +1,228 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/util"
+	"github.com/go-martini/martini"
+)
+
+const (
+	defaultHealthPath    = "/healthz"
+	defaultReadinessPath = "/readyz"
+	//healthCheckID is the ID of resources looked up by the database check, which needn't exist
+	healthCheckID = "healthz"
+)
+
+var (
+	defaultLivenessChecks  = []string{"database"}
+	defaultReadinessChecks = []string{"database", "sync", "schemas", "sync_lock", "amqp"}
+)
+
+//healthChecks check components of the server, returning detail of the component
+//and an error if it isn't healthy
+var healthChecks = map[string]func(*healthChecker) (map[string]interface{}, error){
+	"database":  (*healthChecker).checkDatabase,
+	"sync":      (*healthChecker).checkSync,
+	"schemas":   (*healthChecker).checkSchemas,
+	"sync_lock": (*healthChecker).checkSyncLock,
+	"amqp":      (*healthChecker).checkAMQP,
+}
+
+//healthChecker serves results of health checks configured for health and readiness paths
+type healthChecker struct {
+	server  *Server
+	checks  map[string][]string
+	timeout time.Duration
+	detail  bool
+	syncKey string
+}
+
+//newHealthChecker makes health checker from health configuration
+func newHealthChecker(server *Server, config *util.Config) (*healthChecker, error) {
+	hostname, _ := os.Hostname()
+	checker := &healthChecker{
+		server:  server,
+		timeout: time.Duration(config.GetInt("health/timeout", 5)) * time.Second,
+		detail:  config.GetBool("health/detail", true),
+		syncKey: config.GetString("health/sync_key", "/gohan/health/"+hostname+"-"+strconv.Itoa(os.Getpid())),
+		checks: map[string][]string{
+			config.GetString("health/health_path", defaultHealthPath):       config.GetStringList("health/liveness_checks", defaultLivenessChecks),
+			config.GetString("health/readiness_path", defaultReadinessPath): config.GetStringList("health/readiness_checks", defaultReadinessChecks),
+		},
+	}
+	for _, checks := range checker.checks {
+		for _, check := range checks {
+			if _, ok := healthChecks[check]; !ok {
+				return nil, fmt.Errorf("Unknown health check %s", check)
+			}
+		}
+	}
+	return checker, nil
+}
+
+//handler serves health and readiness paths without authentication
+func (checker *healthChecker) handler() martini.Handler {
+	return func(w http.ResponseWriter, r *http.Request, c martini.Context) {
+		checks, ok := checker.checks[r.URL.Path]
+		if !ok || (r.Method != "GET" && r.Method != "HEAD") {
+			c.Next()
+			return
+		}
+		healthy, results := checker.run(checks)
+		response := map[string]interface{}{"status": "ok"}
+		code := http.StatusOK
+		if !healthy {
+			response["status"] = "failed"
+			code = http.StatusServiceUnavailable
+		}
+		if checker.detail {
+			response["checks"] = results
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+//healthResult is the result of a health check
+type healthResult struct {
+	name     string
+	detail   map[string]interface{}
+	err      error
+	duration time.Duration
+}
+
+//run runs checks concurrently, failing checks which don't finish in the timeout
+func (checker *healthChecker) run(checks []string) (bool, map[string]interface{}) {
+	resultChan := make(chan healthResult, len(checks))
+	for _, name := range checks {
+		go func(name string) {
+			start := time.Now()
+			result := healthResult{name: name}
+			defer func() {
+				if r := recover(); r != nil {
+					result.err = fmt.Errorf("%v", r)
+				}
+				result.duration = time.Since(start)
+				resultChan <- result
+			}()
+			result.detail, result.err = healthChecks[name](checker)
+		}(name)
+	}
+	healthy := true
+	results := map[string]interface{}{}
+	timeout := time.After(checker.timeout)
+	for len(results) < len(checks) {
+		select {
+		case result := <-resultChan:
+			report := map[string]interface{}{"status": "ok", "duration": result.duration.Seconds()}
+			for key, value := range result.detail {
+				report[key] = value
+			}
+			if result.err != nil {
+				healthy = false
+				report["status"] = "failed"
+				report["error"] = result.err.Error()
+			}
+			results[result.name] = report
+		case <-timeout:
+			for _, name := range checks {
+				if _, ok := results[name]; !ok {
+					healthy = false
+					results[name] = map[string]interface{}{
+						"status": "failed",
+						"error":  fmt.Sprintf("Timed out after %s", checker.timeout),
+					}
+				}
+			}
+		}
+	}
+	return healthy, results
+}
+
+//checkDatabase runs a trivial query in a transaction
+func (checker *healthChecker) checkDatabase() (map[string]interface{}, error) {
+	manager := schema.GetManager()
+	querySchema, ok := manager.Schema("schema")
+	if !ok {
+		schemas := manager.OrderedSchemas()
+		if len(schemas) == 0 {
+			return nil, fmt.Errorf("No schema to query")
+		}
+		querySchema = schemas[0]
+	}
+	tx, err := checker.server.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+	_, _, err = tx.List(querySchema, map[string]interface{}{"id": healthCheckID}, nil)
+	return map[string]interface{}{"table": querySchema.GetDbTableName()}, err
+}
+
+//checkSync writes the time of the check to the sync backend
+func (checker *healthChecker) checkSync() (map[string]interface{}, error) {
+	data, _ := json.Marshal(map[string]interface{}{"checked_at": time.Now().Unix()})
+	err := checker.server.sync.Update(checker.syncKey, string(data))
+	return map[string]interface{}{"key": checker.syncKey}, err
+}
+
+//checkSchemas checks schemas are loaded, reporting the number of schemas and extensions
+func (checker *healthChecker) checkSchemas() (map[string]interface{}, error) {
+	manager := schema.GetManager()
+	detail := map[string]interface{}{
+		"schemas":    len(manager.Schemas()),
+		"extensions": len(manager.Extensions),
+	}
+	if len(manager.Schemas()) == 0 {
+		return detail, fmt.Errorf("No schemas loaded")
+	}
+	return detail, nil
+}
+
+//checkSyncLock reports whether this process owns the lock to sync resources, which
+//only one process in a cluster does, so it never fails
+func (checker *healthChecker) checkSyncLock() (map[string]interface{}, error) {
+	return map[string]interface{}{"owner": checker.server.sync.HasLock(syncPath)}, nil
+}
+
+//checkAMQP checks all AMQP queues are consumed, if AMQP is configured
+func (checker *healthChecker) checkAMQP() (map[string]interface{}, error) {
+	if checker.server.amqpStatus == nil {
+		return map[string]interface{}{"enabled": false}, nil
+	}
+	queues := map[string]interface{}{}
+	var err error
+	for queue, queueErr := range checker.server.amqpStatus.queues() {
+		if queueErr != nil {
+			queues[queue] = queueErr.Error()
+			err = fmt.Errorf("Queue %s isn't consumed: %s", queue, queueErr)
+		} else {
+			queues[queue] = "connected"
+		}
+	}
+	return map[string]interface{}{"enabled": true, "queues": queues}, err
+}
@@ -0,0 +1,183 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cloudwan/gohan/cloud"
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/pagination"
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/metrics"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/util"
+)
+
+var (
+	transactionDuration = metrics.NewHistogramVec("gohan_db_transaction_duration_seconds",
+		"Duration of database transactions from begin to close", metrics.DefaultBuckets, "result")
+	transactionErrors = metrics.NewCounterVec("gohan_db_errors_total",
+		"Number of errors returned by database operations", "operation")
+	syncQueueDepth = metrics.NewGaugeVec("gohan_sync_event_queue_depth",
+		"Number of events waiting to be synced, up to the polling limit")
+	notifications = metrics.NewCounterVec("gohan_notifications_total",
+		"Number of AMQP messages, SNMP traps and cron jobs handled by extensions", "source", "result")
+)
+
+//notificationResult returns result label of handling notification
+func notificationResult(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+//defaultMetricsPath is the default path of metrics in Prometheus text format
+const defaultMetricsPath = "/metrics"
+
+//mapMetricsRoute serves metrics to users allowed by policies matching the metrics path
+func (server *Server) mapMetricsRoute(config *util.Config) {
+	metricsPath := config.GetString("metrics/path", defaultMetricsPath)
+	server.martini.Get(metricsPath, func(w http.ResponseWriter, r *http.Request, auth schema.Authorization) {
+		if policy, _ := authorization(w, r, schema.ActionRead, metricsPath, nil, auth); policy == nil {
+			middleware.HTTPJSONError(w, "Only admin can view metrics", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", metrics.ContentType)
+		if err := metrics.Write(w); err != nil {
+			requestLogger(r).Warning("Failed to write metrics: %s", err)
+		}
+	})
+}
+
+//registerIdentityMetrics registers statistics of keystone token cache and tenant directory
+func registerIdentityMetrics(identityService middleware.IdentityService) {
+	var keystoneIdentity *cloud.KeystoneIdentity
+	for _, identity := range middleware.WrappedIdentityServices(identityService) {
+		if identity, ok := identity.(*cloud.KeystoneIdentity); ok {
+			keystoneIdentity = identity
+		}
+	}
+	if keystoneIdentity == nil {
+		return
+	}
+	metrics.NewGaugeFunc("gohan_token_cache_size", "Number of cached keystone tokens", func() float64 {
+		return float64(keystoneIdentity.TokenCacheStats().Size)
+	})
+	metrics.NewCounterFunc("gohan_token_cache_hits_total", "Number of keystone tokens found in the cache", func() float64 {
+		return float64(keystoneIdentity.TokenCacheStats().Hits)
+	})
+	metrics.NewCounterFunc("gohan_token_cache_misses_total", "Number of keystone tokens verified by keystone", func() float64 {
+		return float64(keystoneIdentity.TokenCacheStats().Misses)
+	})
+	metrics.NewGaugeFunc("gohan_tenant_directory_size", "Number of tenants in the tenant directory", func() float64 {
+		return float64(keystoneIdentity.TenantDirectoryStats().Size)
+	})
+	metrics.NewCounterFunc("gohan_tenant_directory_refreshes_total", "Number of times tenants are listed by the tenant directory", func() float64 {
+		return float64(keystoneIdentity.TenantDirectoryStats().Refreshes)
+	})
+}
+
+//DbMetricsWrapper wraps db.DB so it measures durations and errors of transactions
+type DbMetricsWrapper struct {
+	db.DB
+}
+
+//Begin wraps transaction object with metrics
+func (mw *DbMetricsWrapper) Begin() (transaction.Transaction, error) {
+	tx, err := mw.DB.Begin()
+	if err != nil {
+		transactionErrors.Inc("begin")
+		return nil, err
+	}
+	tm := &transactionMetrics{Transaction: tx, begunAt: time.Now()}
+	transaction.Wrap(tx, tm)
+	return tm, nil
+}
+
+type transactionMetrics struct {
+	transaction.Transaction
+	begunAt   time.Time
+	committed bool
+	observed  bool
+}
+
+//SetRequestID sets ID of the request making changes in the wrapped transaction
+func (tm *transactionMetrics) SetRequestID(requestID string) {
+	transaction.SetRequestID(tm.Transaction, requestID)
+}
+
+//count counts the error of operation
+func (tm *transactionMetrics) count(operation string, err error) error {
+	if err != nil {
+		transactionErrors.Inc(operation)
+	}
+	return err
+}
+
+func (tm *transactionMetrics) Create(resource *schema.Resource) error {
+	return tm.count("create", tm.Transaction.Create(resource))
+}
+
+func (tm *transactionMetrics) Update(resource *schema.Resource) error {
+	return tm.count("update", tm.Transaction.Update(resource))
+}
+
+func (tm *transactionMetrics) StateUpdate(resource *schema.Resource) error {
+	return tm.count("state_update", tm.Transaction.StateUpdate(resource))
+}
+
+func (tm *transactionMetrics) Delete(s *schema.Schema, resourceID interface{}) error {
+	return tm.count("delete", tm.Transaction.Delete(s, resourceID))
+}
+
+func (tm *transactionMetrics) Fetch(s *schema.Schema, id interface{}, tenantFilter []string) (*schema.Resource, error) {
+	resource, err := tm.Transaction.Fetch(s, id, tenantFilter)
+	return resource, tm.count("fetch", err)
+}
+
+func (tm *transactionMetrics) List(s *schema.Schema, filter map[string]interface{}, pg *pagination.Paginator) ([]*schema.Resource, uint64, error) {
+	resources, total, err := tm.Transaction.List(s, filter, pg)
+	return resources, total, tm.count("list", err)
+}
+
+func (tm *transactionMetrics) Query(s *schema.Schema, query string, arguments []interface{}) ([]*schema.Resource, error) {
+	resources, err := tm.Transaction.Query(s, query, arguments)
+	return resources, tm.count("query", err)
+}
+
+func (tm *transactionMetrics) Commit() error {
+	err := tm.Transaction.Commit()
+	tm.committed = err == nil
+	return tm.count("commit", err)
+}
+
+//Close closes the transaction, and observes its duration once
+func (tm *transactionMetrics) Close() error {
+	err := tm.Transaction.Close()
+	if !tm.observed {
+		tm.observed = true
+		result := "rollback"
+		if tm.committed {
+			result = "commit"
+		}
+		transactionDuration.ObserveSince(tm.begunAt, result)
+	}
+	return tm.count("close", err)
+}
@@ -164,9 +164,10 @@ func (*FakeIdentity) VerifyToken(tokenID string) (schema.Authorization, error) {
 	access, _ := rawToken.(map[string]interface{})["access"].(map[string]interface{})
 	tenantID := access["token"].(token).Tenant.ID
 	tenantName := access["token"].(token).Tenant.Name
+	userID := access["user"].(map[string]interface{})["id"].(string)
 	role := access["user"].(map[string]interface{})["roles"].([]role)[0].Name
 
-	return schema.NewAuthorization(tenantID, tenantName, tokenID, []string{role}, nil), nil
+	return schema.NewUserAuthorization(tenantID, tenantName, tokenID, userID, []string{role}, nil, nil), nil
 }
 
 // GetTenantID maps the given tenant name to the tenant's ID
@@ -0,0 +1,53 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cloudwan/gohan/metrics"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/go-martini/martini"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("gohan_http_requests_total",
+		"Number of HTTP requests", "schema", "action", "status")
+	httpRequestDuration = metrics.NewHistogramVec("gohan_http_request_duration_seconds",
+		"Duration of HTTP requests", metrics.DefaultBuckets, "schema", "action", "status")
+)
+
+//Metrics counts requests and measures their durations by schema, action and status
+//Requests not handled by schema routes have empty schema and action
+func Metrics() martini.Handler {
+	return func(res http.ResponseWriter, c martini.Context, context Context) {
+		start := time.Now()
+		c.Next()
+		schemaID := ""
+		if s, ok := context["schema"].(*schema.Schema); ok {
+			schemaID = s.ID
+		}
+		action, _ := context["action"].(string)
+		status := ""
+		if rw, ok := res.(martini.ResponseWriter); ok {
+			status = strconv.Itoa(rw.Status())
+		}
+		httpRequests.Inc(schemaID, action, status)
+		httpRequestDuration.ObserveSince(start, schemaID, action, status)
+	}
+}
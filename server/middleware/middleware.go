@@ -17,14 +17,19 @@ package middleware
 
 import (
 	"bytes"
+	"crypto/x509"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"regexp"
 	"strings"
 	"time"
 
+	l "github.com/cloudwan/gohan/log"
 	"github.com/cloudwan/gohan/schema"
 	"github.com/go-martini/martini"
+	"github.com/twinj/uuid"
 )
 
 type responseHijacker struct {
@@ -41,11 +46,30 @@ func (rh *responseHijacker) Write(b []byte) (int, error) {
 	return rh.ResponseWriter.Write(b)
 }
 
+//requestIDPattern matches X-Request-ID headers accepted from clients
+var requestIDPattern = regexp.MustCompile("^[A-Za-z0-9._:-]{1,128}$")
+
+//requestID returns valid X-Request-ID header of the request, or a new request ID
+func requestID(req *http.Request) string {
+	if requestID := req.Header.Get("X-Request-ID"); requestIDPattern.MatchString(requestID) {
+		return requestID
+	}
+	return uuid.NewV4().String()
+}
+
 //Logging logs requests and responses
+//Requests are identified by X-Request-ID, which is returned in the response.
+//Logger of the request, which prefixes log lines with the ID, is mapped for later handlers
 func Logging() martini.Handler {
 	return func(res http.ResponseWriter, req *http.Request, c martini.Context) {
 		start := time.Now()
 
+		requestID := requestID(req)
+		req.Header.Set("X-Request-ID", requestID)
+		res.Header().Set("X-Request-ID", requestID)
+		logger := l.NewRequestLogger(log, requestID)
+		c.Map(logger)
+
 		addr := req.Header.Get("X-Real-IP")
 		if addr == "" {
 			addr = req.Header.Get("X-Forwarded-For")
@@ -58,10 +82,10 @@ func Logging() martini.Handler {
 		buff := ioutil.NopCloser(bytes.NewBuffer(reqData))
 		req.Body = buff
 
-		log.Info("Started %s %s for client %s data: %s",
+		logger.Info("Started %s %s for client %s data: %s",
 			req.Method, req.URL.String(), addr, string(reqData))
-		log.Debug("Request headers: %v", filterHeaders(req.Header))
-		log.Debug("Request body: %s", string(reqData))
+		logger.Debug("Request headers: %v", filterHeaders(req.Header))
+		logger.Debug("Request body: %s", string(reqData))
 
 		rw := res.(martini.ResponseWriter)
 		rh := newResponseHijacker(rw)
@@ -71,16 +95,16 @@ func Logging() martini.Handler {
 		c.Next()
 
 		response, _ := ioutil.ReadAll(rh.Response)
-		log.Debug("Response headers: %v", rh.Header())
-		log.Debug("Response body: %s", string(response))
-		log.Info("Completed %v %s in %v", rw.Status(), http.StatusText(rw.Status()), time.Since(start))
+		logger.Debug("Response headers: %v", rh.Header())
+		logger.Debug("Response body: %s", string(response))
+		logger.Info("Completed %v %s in %v", rw.Status(), http.StatusText(rw.Status()), time.Since(start))
 	}
 }
 
 func filterHeaders(headers http.Header) http.Header {
 	filtered := http.Header{}
 	for k, v := range headers {
-		if k == "X-Auth-Token" {
+		if k == "X-Auth-Token" || k == "Authorization" || k == "X-Api-Key" {
 			filtered[k] = []string{"***"}
 			continue
 		}
@@ -97,64 +121,158 @@ type IdentityService interface {
 	GetServiceAuthorization() (schema.Authorization, error)
 }
 
+//APIKeyVerifier is implemented by identity services accepting API keys given in X-API-Key header
+type APIKeyVerifier interface {
+	VerifyAPIKey(string, *http.Request) (schema.Authorization, error)
+}
+
+//CertificateVerifier is implemented by identity services accepting client certificates verified by TLS
+type CertificateVerifier interface {
+	VerifyCertificate(*x509.Certificate) (schema.Authorization, error)
+}
+
+//IdentityServiceWrapper is implemented by identity services adding authentication methods to another one
+type IdentityServiceWrapper interface {
+	WrappedIdentityService() IdentityService
+}
+
+//WrappedIdentityServices returns the identity service and identity services wrapped by it, outermost first
+func WrappedIdentityServices(identityService IdentityService) []IdentityService {
+	identityServices := []IdentityService{}
+	for identityService != nil {
+		identityServices = append(identityServices, identityService)
+		wrapper, ok := identityService.(IdentityServiceWrapper)
+		if !ok {
+			break
+		}
+		identityService = wrapper.WrappedIdentityService()
+	}
+	return identityServices
+}
+
 //HTTPJSONError helper for returning JSON errors
+//Errors are logged with ID of the request, which Logging middleware sets in response headers
 func HTTPJSONError(res http.ResponseWriter, err string, code int) {
 	errorMessage := ""
+	logger := l.NewRequestLogger(log, res.Header().Get("X-Request-ID"))
 	if code == http.StatusInternalServerError {
-		log.Error(err)
+		logger.Error("%s", err)
 	} else {
 		errorMessage = err
-		log.Notice(err)
+		logger.Notice("%s", err)
 	}
 	response := map[string]interface{}{"error": errorMessage}
 	responseJSON, _ := json.Marshal(response)
 	http.Error(res, string(responseJSON), code)
 }
 
-//Authentication authenticates user using keystone
-func Authentication() martini.Handler {
-	return func(res http.ResponseWriter, req *http.Request, identityService IdentityService, c martini.Context) {
-		if req.Method == "OPTIONS" {
-			c.Next()
-			return
+//DefaultPublicPaths are patterns of paths served without authentication by default
+var DefaultPublicPaths = []string{"^/webui/", "^/v2.0/tokens$"}
+
+//AuthenticationConfig configures Authentication middleware
+type AuthenticationConfig struct {
+	//PublicPaths are patterns of paths served without credentials
+	PublicPaths []*regexp.Regexp
+	//Anonymous is authorization of requests to public paths without credentials
+	Anonymous schema.Authorization
+}
+
+//NewAuthenticationConfig compiles public path patterns, and uses anonymous authorization of given tenant
+func NewAuthenticationConfig(publicPaths []string, anonymousTenantID, anonymousTenantName string) (AuthenticationConfig, error) {
+	config := AuthenticationConfig{Anonymous: schema.NewAnonymousAuthorization(anonymousTenantID, anonymousTenantName)}
+	for _, publicPath := range publicPaths {
+		pattern, err := regexp.Compile(publicPath)
+		if err != nil {
+			return config, fmt.Errorf("Invalid public path %s: %s", publicPath, err)
 		}
-		//TODO(nati) make this configureable
-		if strings.HasPrefix(req.URL.Path, "/webui/") {
-			c.Next()
-			return
+		config.PublicPaths = append(config.PublicPaths, pattern)
+	}
+	return config, nil
+}
+
+func (config *AuthenticationConfig) isPublic(path string) bool {
+	for _, pattern := range config.PublicPaths {
+		if pattern.MatchString(path) {
+			return true
 		}
-		if req.URL.Path == "/v2.0/tokens" {
+	}
+	return false
+}
+
+//Authentication authenticates user using identity service
+//Requests to public paths are authorized as anonymous if they have no credentials,
+//but credentials which fail verification are rejected on any path
+func Authentication(config AuthenticationConfig) martini.Handler {
+	return func(res http.ResponseWriter, req *http.Request, identityService IdentityService, c martini.Context) {
+		if req.Method == "OPTIONS" {
 			c.Next()
 			return
 		}
-		authToken := req.Header.Get("X-Auth-Token")
-		if authToken == "" {
-			HTTPJSONError(res, "No X-Auth-Token", http.StatusUnauthorized)
-			return
+		auth, err := authenticate(req, identityService)
+		if err == errNoCredentials && config.isPublic(req.URL.Path) {
+			auth, err = config.Anonymous, nil
 		}
-
-		auth, err := identityService.VerifyToken(authToken)
 		if err != nil {
 			HTTPJSONError(res, err.Error(), http.StatusUnauthorized)
+			return
 		}
 		c.Map(auth)
 		c.Next()
 	}
 }
 
+//errNoCredentials is returned by authenticate for requests without credentials
+var errNoCredentials = fmt.Errorf("No X-Auth-Token")
+
+//authenticate verifies API key, token or client certificate of the request, in this order
+func authenticate(req *http.Request, identityService IdentityService) (schema.Authorization, error) {
+	if apiKey := req.Header.Get("X-API-Key"); apiKey != "" {
+		for _, identity := range WrappedIdentityServices(identityService) {
+			if verifier, ok := identity.(APIKeyVerifier); ok {
+				return verifier.VerifyAPIKey(apiKey, req)
+			}
+		}
+		return nil, fmt.Errorf("API keys are not enabled")
+	}
+	if authToken := requestToken(req); authToken != "" {
+		return identityService.VerifyToken(authToken)
+	}
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		for _, identity := range WrappedIdentityServices(identityService) {
+			if verifier, ok := identity.(CertificateVerifier); ok {
+				return verifier.VerifyCertificate(req.TLS.PeerCertificates[0])
+			}
+		}
+	}
+	return nil, errNoCredentials
+}
+
+//requestToken returns X-Auth-Token header, or bearer token of Authorization header
+func requestToken(req *http.Request) string {
+	if authToken := req.Header.Get("X-Auth-Token"); authToken != "" {
+		return authToken
+	}
+	authorization := req.Header.Get("Authorization")
+	if len(authorization) > len("Bearer ") && strings.EqualFold(authorization[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(authorization[len("Bearer "):])
+	}
+	return ""
+}
+
 //Context type
 type Context map[string]interface{}
 
-//WithContext injects new empty context object
+//WithContext injects new context object with ID of the request
 func WithContext() martini.Handler {
-	return func(c martini.Context) {
-		c.Map(Context{})
+	return func(c martini.Context, req *http.Request) {
+		c.Map(Context{l.RequestIDKey: req.Header.Get("X-Request-ID")})
 	}
 }
 
 //Authorization checks user permissions against policy
 func Authorization(action string) martini.Handler {
 	return func(res http.ResponseWriter, req *http.Request, auth schema.Authorization, context Context) {
+		context["action"] = action
 		context["tenant_id"] = auth.TenantID()
 		context["auth_token"] = auth.AuthToken()
 		context["catalog"] = auth.Catalog()
@@ -0,0 +1,353 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/sync"
+	"github.com/go-martini/martini"
+)
+
+//statusTooManyRequests is HTTP status of rate limited requests
+const statusTooManyRequests = 429
+
+//rateLimitKeys are allowed kinds of subjects rate limits are counted by
+var rateLimitKeys = map[string]bool{"tenant": true, "token": true, "ip": true}
+
+//RateLimit allows Rate requests per second on average, and Burst requests at once
+//Requests aren't limited if Rate isn't positive, and Burst is at least one
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+//interval is the time a request consumes
+func (limit RateLimit) interval() time.Duration {
+	return time.Duration(float64(time.Second) / limit.Rate)
+}
+
+//RateLimitRoute overrides the default rate limit for requests matching it
+type RateLimitRoute struct {
+	Path *regexp.Regexp
+	//Methods limits the route to given HTTP methods, all methods match if it's empty
+	Methods []string
+	RateLimit
+}
+
+func (route *RateLimitRoute) match(req *http.Request) bool {
+	if !route.Path.MatchString(req.URL.Path) {
+		return false
+	}
+	if len(route.Methods) == 0 {
+		return true
+	}
+	for _, method := range route.Methods {
+		if strings.EqualFold(method, req.Method) {
+			return true
+		}
+	}
+	return false
+}
+
+//RateLimitConfig configures RateLimiting middleware
+type RateLimitConfig struct {
+	//Key is the kind of subjects requests are counted by: tenant, token or ip
+	//Requests without authorization or token are counted by source IP
+	Key string
+	//Default is the rate limit of requests matching no route
+	Default RateLimit
+	//Routes are tried in order, and the first matching one is used
+	Routes []*RateLimitRoute
+}
+
+//NewRateLimitConfig validates the key kind of rate limit configuration
+func NewRateLimitConfig(key string, defaultLimit RateLimit, routes []*RateLimitRoute) (RateLimitConfig, error) {
+	if !rateLimitKeys[key] {
+		return RateLimitConfig{}, fmt.Errorf("Rate limit key should be tenant, token or ip, not %s", key)
+	}
+	return RateLimitConfig{Key: key, Default: defaultLimit, Routes: routes}, nil
+}
+
+//NeedsAuthorization checks if requests are counted by authorization, and rate limiting
+//should follow authentication. Otherwise requests failing authentication are counted too
+//when rate limiting precedes it
+func (config *RateLimitConfig) NeedsAuthorization() bool {
+	return config.Key == "tenant"
+}
+
+//limit returns rate limit of the request and the name of its bucket
+func (config *RateLimitConfig) limit(req *http.Request) (RateLimit, string) {
+	for i, route := range config.Routes {
+		if route.match(req) {
+			return route.RateLimit, fmt.Sprintf("route%d", i)
+		}
+	}
+	return config.Default, "default"
+}
+
+//subject returns the tenant, token or source IP requests are counted by
+func (config *RateLimitConfig) subject(req *http.Request, auth schema.Authorization) string {
+	switch config.Key {
+	case "tenant":
+		if auth != nil && auth.TenantID() != "" {
+			return "tenant:" + auth.TenantID()
+		}
+	case "token":
+		credential := requestToken(req)
+		if credential == "" {
+			credential = req.Header.Get("X-API-Key")
+		}
+		if credential != "" {
+			hash := sha256.Sum256([]byte(credential))
+			return "token:" + hex.EncodeToString(hash[:8])
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+//RateLimitCounter counts requests of rate limit buckets
+type RateLimitCounter interface {
+	//Take counts a request of the bucket, and returns how long the request should be retried after
+	//if the bucket is exhausted, or zero if the request is allowed
+	Take(bucket string, limit RateLimit, now time.Time) time.Duration
+}
+
+//rateLimitBucket keeps the theoretical arrival time of the next request, which moves
+//by the interval of the limit for each request
+type rateLimitBucket struct {
+	limit   RateLimit
+	arrival time.Time
+}
+
+//maxRateLimitBuckets is the number of buckets which makes idle buckets removed
+const maxRateLimitBuckets = 10000
+
+//LocalRateLimitCounter counts requests in memory of this process
+type LocalRateLimitCounter struct {
+	mutex   gosync.Mutex
+	buckets map[string]*rateLimitBucket
+}
+
+//NewLocalRateLimitCounter is a constructor for LocalRateLimitCounter
+func NewLocalRateLimitCounter() *LocalRateLimitCounter {
+	return &LocalRateLimitCounter{buckets: map[string]*rateLimitBucket{}}
+}
+
+//Take counts a request of the bucket
+func (counter *LocalRateLimitCounter) Take(bucketName string, limit RateLimit, now time.Time) time.Duration {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	bucket, ok := counter.buckets[bucketName]
+	if !ok {
+		if len(counter.buckets) >= maxRateLimitBuckets {
+			counter.removeIdle(now)
+		}
+		bucket = &rateLimitBucket{}
+		counter.buckets[bucketName] = bucket
+	}
+	bucket.limit = limit
+	arrival := bucket.arrival
+	if arrival.Before(now) {
+		arrival = now
+	}
+	arrival = arrival.Add(limit.interval())
+	burst := time.Duration(limit.Burst) * limit.interval()
+	if limit.Burst < 1 {
+		burst = limit.interval()
+	}
+	if wait := arrival.Sub(now) - burst; wait > 0 {
+		return wait
+	}
+	bucket.arrival = arrival
+	return 0
+}
+
+//consume counts requests of the bucket made elsewhere, if the bucket is known
+func (counter *LocalRateLimitCounter) consume(bucketName string, count int, now time.Time) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	bucket, ok := counter.buckets[bucketName]
+	if !ok {
+		return
+	}
+	if bucket.arrival.Before(now) {
+		bucket.arrival = now
+	}
+	bucket.arrival = bucket.arrival.Add(time.Duration(count) * bucket.limit.interval())
+}
+
+//removeIdle removes buckets which have no requests counted anymore
+func (counter *LocalRateLimitCounter) removeIdle(now time.Time) {
+	for bucketName, bucket := range counter.buckets {
+		if !bucket.arrival.After(now) {
+			delete(counter.buckets, bucketName)
+		}
+	}
+}
+
+//SyncRateLimitCounter counts requests locally, and shares counts with other processes
+//through sync backend, so that limits hold across a cluster
+//Requests made by other processes are counted after the publish interval
+type SyncRateLimitCounter struct {
+	*LocalRateLimitCounter
+	sync     sync.Sync
+	prefix   string
+	node     string
+	interval time.Duration
+	mutex    gosync.Mutex
+	pending  map[string]int
+	stop     chan bool
+	done     chan struct{}
+}
+
+//NewSyncRateLimitCounter is a constructor for SyncRateLimitCounter, which publishes counts
+//under the prefix every interval until it's stopped
+func NewSyncRateLimitCounter(syncBackend sync.Sync, prefix string, interval time.Duration) *SyncRateLimitCounter {
+	hostname, _ := os.Hostname()
+	counter := &SyncRateLimitCounter{
+		LocalRateLimitCounter: NewLocalRateLimitCounter(),
+		sync:                  syncBackend,
+		prefix:                strings.TrimSuffix(prefix, "/"),
+		node:                  hostname + "-" + strconv.Itoa(os.Getpid()),
+		interval:              interval,
+		pending:               map[string]int{},
+		stop:                  make(chan bool, 1),
+		done:                  make(chan struct{}),
+	}
+	go counter.publishPeriodically()
+	go counter.watch()
+	return counter
+}
+
+//Take counts a request of the bucket, recording it to be published if it's allowed
+func (counter *SyncRateLimitCounter) Take(bucketName string, limit RateLimit, now time.Time) time.Duration {
+	wait := counter.LocalRateLimitCounter.Take(bucketName, limit, now)
+	if wait == 0 {
+		counter.mutex.Lock()
+		counter.pending[bucketName]++
+		counter.mutex.Unlock()
+	}
+	return wait
+}
+
+//Stop stops publishing and watching counts
+func (counter *SyncRateLimitCounter) Stop() {
+	counter.stop <- true
+	close(counter.done)
+}
+
+func (counter *SyncRateLimitCounter) path() string {
+	return counter.prefix + "/" + counter.node
+}
+
+func (counter *SyncRateLimitCounter) publishPeriodically() {
+	ticker := time.NewTicker(counter.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-counter.done:
+			return
+		case <-ticker.C:
+		}
+		counter.mutex.Lock()
+		pending := counter.pending
+		counter.pending = map[string]int{}
+		counter.mutex.Unlock()
+		if len(pending) == 0 {
+			continue
+		}
+		data, _ := json.Marshal(map[string]interface{}{
+			"counts":       pending,
+			"published_at": time.Now().UnixNano(),
+		})
+		if err := counter.sync.Update(counter.path(), string(data)); err != nil {
+			log.Warning("Failed to publish rate limit counts: %s", err)
+		}
+	}
+}
+
+//watch counts requests published by other processes, ignoring stale counts
+func (counter *SyncRateLimitCounter) watch() {
+	responseChan := make(chan *sync.Event)
+	go func() {
+		for event := range responseChan {
+			if event.Key == counter.path() || event.Data == nil {
+				continue
+			}
+			publishedAt, _ := event.Data["published_at"].(float64)
+			now := time.Now()
+			if now.Sub(time.Unix(0, int64(publishedAt))) > 2*counter.interval {
+				continue
+			}
+			counts, _ := event.Data["counts"].(map[string]interface{})
+			for bucketName, count := range counts {
+				if count, ok := count.(float64); ok {
+					counter.consume(bucketName, int(count), now)
+				}
+			}
+		}
+	}()
+	//make sure the prefix exists to be watched
+	if err := counter.sync.Update(counter.path(), "{}"); err != nil {
+		log.Warning("Failed to publish rate limit counts: %s", err)
+	}
+	if err := counter.sync.Watch(counter.prefix, responseChan, counter.stop); err != nil {
+		log.Warning("Failed to watch rate limit counts: %s", err)
+	}
+}
+
+//RateLimiting rejects requests exceeding rate limits with 429 Too Many Requests
+func RateLimiting(config RateLimitConfig, counter RateLimitCounter) martini.Handler {
+	authorizationType := reflect.TypeOf((*schema.Authorization)(nil)).Elem()
+	return func(res http.ResponseWriter, req *http.Request, c martini.Context) {
+		limit, bucketName := config.limit(req)
+		if limit.Rate <= 0 || req.Method == "OPTIONS" {
+			c.Next()
+			return
+		}
+		var auth schema.Authorization
+		if value := c.Get(authorizationType); value.IsValid() {
+			auth, _ = value.Interface().(schema.Authorization)
+		}
+		subject := config.subject(req, auth)
+		wait := counter.Take(bucketName+"/"+subject, limit, time.Now())
+		if wait > 0 {
+			res.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			HTTPJSONError(res, fmt.Sprintf("Rate limit of %s exceeded", subject), statusTooManyRequests)
+			return
+		}
+		c.Next()
+	}
+}
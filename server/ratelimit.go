@@ -0,0 +1,74 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/util"
+)
+
+//newRateLimitConfig makes rate limit configuration from rate_limit configuration
+func newRateLimitConfig(config *util.Config) (middleware.RateLimitConfig, error) {
+	defaultLimit := middleware.RateLimit{
+		Rate:  config.GetFloat("rate_limit/rate", 0),
+		Burst: config.GetInt("rate_limit/burst", 1),
+	}
+	routes := []*middleware.RateLimitRoute{}
+	for i, rawRoute := range config.GetList("rate_limit/routes", nil) {
+		routeData, _ := rawRoute.(map[string]interface{})
+		pathPattern, _ := routeData["path"].(string)
+		path, err := regexp.Compile(pathPattern)
+		if err != nil || pathPattern == "" {
+			return middleware.RateLimitConfig{}, fmt.Errorf("Invalid path of rate limit route %d: %s", i, pathPattern)
+		}
+		route := &middleware.RateLimitRoute{Path: path, RateLimit: defaultLimit}
+		methods, _ := routeData["methods"].([]interface{})
+		for _, method := range methods {
+			route.Methods = append(route.Methods, fmt.Sprint(method))
+		}
+		switch rate := routeData["rate"].(type) {
+		case int:
+			route.Rate = float64(rate)
+		case float64:
+			route.Rate = rate
+		}
+		switch burst := routeData["burst"].(type) {
+		case int:
+			route.Burst = burst
+		case float64:
+			route.Burst = int(burst)
+		}
+		routes = append(routes, route)
+	}
+	return middleware.NewRateLimitConfig(config.GetString("rate_limit/key", "tenant"), defaultLimit, routes)
+}
+
+//newRateLimitCounter counts requests locally, or shares counts through sync backend if rate_limit/sync is set
+func (server *Server) newRateLimitCounter(config *util.Config) middleware.RateLimitCounter {
+	if !config.GetBool("rate_limit/sync", false) {
+		return middleware.NewLocalRateLimitCounter()
+	}
+	log.Info("Rate limit counts shared through sync backend")
+	return middleware.NewSyncRateLimitCounter(
+		server.sync,
+		config.GetString("rate_limit/sync_prefix", "/gohan/rate_limit"),
+		time.Duration(config.GetInt("rate_limit/sync_interval", 1000))*time.Millisecond,
+	)
+}
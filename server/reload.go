@@ -0,0 +1,296 @@
+// Copyright (C) 2015 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-martini/martini"
+
+	"github.com/cloudwan/gohan/extension"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/util"
+)
+
+var reloadLock sync.Mutex
+
+//ReloadSchemas re-reads schema and extension files listed in the configuration
+//and applies them to the running server.
+//New schemas are loaded with policies and extensions stored in the database,
+//validated and migrated before the schema manager, extension environments and routes are swapped.
+//On error, the server keeps serving previous schemas.
+func (server *Server) ReloadSchemas() error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	config := util.GetConfig()
+	schemaFiles := config.GetStringList("schemas", nil)
+	manager, err := schema.LoadManagerFromFiles(schemaFiles...)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %s", err)
+	}
+	return server.applySchemas(manager, schema.GetManager())
+}
+
+func (server *Server) applySchemas(manager, previous *schema.Manager) error {
+	editable, err := server.loadStoredDefinitions(manager)
+	if err != nil {
+		return err
+	}
+	diff := manager.Diff(previous)
+
+	newProperties := map[string][]schema.Property{}
+	for _, s := range diff.Changed {
+		oldSchema, _ := previous.Schema(s.ID)
+		properties, err := s.NewProperties(oldSchema)
+		if err != nil {
+			return fmt.Errorf("unsafe schema change: %s", err)
+		}
+		newProperties[s.ID] = properties
+	}
+
+	environments, err := server.loadEnvironments(manager)
+	if err != nil {
+		return fmt.Errorf("Extensions parsing error: %v", err)
+	}
+
+	//Tables are created first, so that they can be dropped if adding columns fails,
+	//while columns are added in a transaction
+	_, _, _, cascade := server.getDatabaseConfig()
+	created := []*schema.Schema{}
+	for _, s := range diff.Added {
+		log.Info("Creating table for schema %s", s.ID)
+		err := server.db.RegisterTable(s, cascade)
+		if err != nil && !strings.Contains(err.Error(), "already exists") {
+			server.dropTables(append(created, s))
+			return err
+		}
+		if err == nil {
+			created = append(created, s)
+		}
+	}
+	columns := map[*schema.Schema][]schema.Property{}
+	for _, s := range diff.Changed {
+		if len(newProperties[s.ID]) == 0 {
+			continue
+		}
+		log.Info("Adding %d columns for schema %s", len(newProperties[s.ID]), s.ID)
+		columns[s] = newProperties[s.ID]
+	}
+	if len(columns) > 0 {
+		if err := server.db.AddColumns(columns); err != nil {
+			server.dropTables(created)
+			return err
+		}
+	}
+	for _, s := range diff.Removed {
+		log.Warning("Schema %s was removed. Its table is kept in the database", s.ID)
+	}
+
+	schema.SetManager(manager)
+	extension.GetManager().SetEnvironments(environments)
+	server.swapRouter(editable)
+	log.Info("Schemas reloaded: %d added, %d changed, %d removed",
+		len(diff.Added), len(diff.Changed), len(diff.Removed))
+	return nil
+}
+
+//dropTables drops tables created by a failed reload
+func (server *Server) dropTables(created []*schema.Schema) {
+	for _, s := range created {
+		log.Info("Dropping table for schema %s", s.ID)
+		if err := server.db.DropTable(s); err != nil {
+			log.Error(fmt.Sprintf("Failed to drop table for schema %s: %s", s.ID, err))
+		}
+	}
+}
+
+//loadEnvironments loads extensions of the manager for its schemas and for background processes
+func (server *Server) loadEnvironments(manager *schema.Manager) (map[string]extension.Environment, error) {
+	environments := map[string]extension.Environment{}
+	for _, s := range manager.Schemas() {
+		env := newEnvironment(server.db, server.keystoneIdentity)
+		if err := env.LoadExtensionsForPath(manager.Extensions, s.GetPluralURL()); err != nil {
+			return nil, err
+		}
+		environments[s.ID] = env
+	}
+	for _, path := range backgroundExtensionPaths() {
+		env := newEnvironment(server.db, server.keystoneIdentity)
+		if err := env.LoadExtensionsForPath(manager.Extensions, path); err != nil {
+			return nil, err
+		}
+		environments[path] = env
+	}
+	return environments, nil
+}
+
+//backgroundExtensionPaths returns paths of extensions handling events of AMQP, cron, SNMP
+//and sync watch processes, whose environments are registered by the paths
+func backgroundExtensionPaths() []string {
+	config := util.GetConfig()
+	paths := []string{}
+	if config.GetParam("amqp", nil) != nil {
+		for _, event := range config.GetStringList("amqp/events", []string{}) {
+			paths = append(paths, "amqp://"+event)
+		}
+	}
+	if jobList, ok := config.GetParam("cron", nil).([]interface{}); ok {
+		for _, rawJob := range jobList {
+			job, _ := rawJob.(map[string]interface{})
+			if path, ok := job["path"].(string); ok {
+				paths = append(paths, path)
+			}
+		}
+	}
+	if config.GetParam("snmp", nil) != nil {
+		paths = append(paths, "snmp://")
+	}
+	if config.GetStringList("watch/keys", nil) != nil {
+		for _, event := range config.GetStringList("watch/events", []string{}) {
+			paths = append(paths, "sync://"+event)
+		}
+	}
+	return paths
+}
+
+//registerBackgroundEnvironment loads extensions for the path of a background process,
+//unless they are loaded already
+func (server *Server) registerBackgroundEnvironment(path string) error {
+	environmentManager := extension.GetManager()
+	if _, ok := environmentManager.GetEnvironment(path); ok {
+		return nil
+	}
+	env := newEnvironment(server.db, server.keystoneIdentity)
+	if err := env.LoadExtensionsForPath(schema.GetManager().Extensions, path); err != nil {
+		return err
+	}
+	return environmentManager.RegisterEnvironment(path, env)
+}
+
+//backgroundEnvironment returns extension environment for the path of a background process,
+//which is replaced on schema reload
+func backgroundEnvironment(path string) (extension.Environment, error) {
+	env, ok := extension.GetManager().GetEnvironment(path)
+	if !ok {
+		return nil, fmt.Errorf("No extension environment for %s", path)
+	}
+	return env, nil
+}
+
+//swapRouter maps routes on a new router and activates it when mapping is done,
+//so requests never see a partially mapped router
+func (server *Server) swapRouter(editable bool) {
+	router := martini.NewRouter()
+	server.martini.Router = router
+	server.addOptionsRoute()
+	server.mapSchemaRoutes()
+	if editable {
+		server.setDefinitionHandlers(schema.GetManager())
+	}
+	server.router.Store(router)
+}
+
+func (server *Server) reloadSchemas() {
+	log.Info("Reloading schemas...")
+	if err := server.ReloadSchemas(); err != nil {
+		log.Error(fmt.Sprintf("Schema reload failed, keeping previous schemas: %s", err))
+	}
+}
+
+//watchedFiles returns schema files and local extension files
+func watchedFiles() []string {
+	config := util.GetConfig()
+	files := config.GetStringList("schemas", []string{})
+	for _, extension := range schema.GetManager().Extensions {
+		codeURL, err := url.Parse(extension.URL)
+		if err != nil || codeURL.Scheme != "file" {
+			continue
+		}
+		files = append(files, codeURL.Path)
+	}
+	return files
+}
+
+func modificationTimes(files []string) map[string]time.Time {
+	times := map[string]time.Time{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		times[file] = info.ModTime()
+	}
+	return times
+}
+
+func filesChanged(previous, current map[string]time.Time) bool {
+	if len(previous) != len(current) {
+		return true
+	}
+	for file, modTime := range current {
+		if !previous[file].Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+//Schema reload process
+func startSchemaReloadProcess(server *Server) {
+	server.reloadSignal = make(chan os.Signal, 1)
+	signal.Notify(server.reloadSignal, syscall.SIGHUP)
+	go func() {
+		for _ = range server.reloadSignal {
+			server.reloadSchemas()
+		}
+	}()
+
+	config := util.GetConfig()
+	if !config.GetBool("schema_reload/watch", false) {
+		return
+	}
+	interval := time.Duration(config.GetInt("schema_reload/interval", 5)) * time.Second
+	log.Info("Watching schema files for changes every %s", interval)
+	go func() {
+		times := modificationTimes(watchedFiles())
+		for server.running {
+			time.Sleep(interval)
+			current := modificationTimes(watchedFiles())
+			if filesChanged(times, current) {
+				server.reloadSchemas()
+				current = modificationTimes(watchedFiles())
+			}
+			times = current
+		}
+	}()
+}
+
+func stopSchemaReloadProcess(server *Server) {
+	if server.reloadSignal == nil {
+		return
+	}
+	signal.Stop(server.reloadSignal)
+	close(server.reloadSignal)
+	server.reloadSignal = nil
+}
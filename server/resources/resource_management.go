@@ -23,6 +23,7 @@ import (
 	"github.com/cloudwan/gohan/db/pagination"
 	"github.com/cloudwan/gohan/db/transaction"
 	"github.com/cloudwan/gohan/extension"
+	l "github.com/cloudwan/gohan/log"
 
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/server/middleware"
@@ -66,6 +67,15 @@ type ExtensionError struct {
 	ExceptionInfo map[string]interface{}
 }
 
+//transitionError returns Unauthorized error if state transition is denied to the action or the role,
+//and WrongData error if it isn't allowed at all
+func transitionError(err error) ResourceError {
+	if transitionErr, ok := err.(*schema.TransitionError); ok && transitionErr.Denied {
+		return ResourceError{err, err.Error(), Unauthorized}
+	}
+	return ResourceError{err, err.Error(), WrongData}
+}
+
 //InTransaction executes function in the db transaction and set it to the context
 func InTransaction(context middleware.Context, dataStore db.DB, f func() error) error {
 	if context["transaction"] != nil {
@@ -76,6 +86,9 @@ func InTransaction(context middleware.Context, dataStore db.DB, f func() error)
 		return fmt.Errorf("cannot create transaction: %v", err)
 	}
 	defer aTransaction.Close()
+	if requestID, ok := context[l.RequestIDKey].(string); ok {
+		transaction.SetRequestID(aTransaction, requestID)
+	}
 	context["transaction"] = aTransaction
 
 	err = f()
@@ -164,7 +177,7 @@ func GetResourcesInTransaction(context middleware.Context, resourceSchema *schem
 	if resourceSchema.ID == "schema" {
 		manager := schema.GetManager()
 		for _, currentSchema := range manager.OrderedSchemas() {
-			trimmedSchema, err := GetSchema(currentSchema, auth)
+			trimmedSchema, err := GetLocalizedSchema(currentSchema, auth, contextLanguages(context))
 			if err != nil {
 				return err
 			}
@@ -213,7 +226,7 @@ func FilterFromQueryParameter(resourceSchema *schema.Schema,
 
 // GetMultipleResources returns all resources specified by the schema and query parameters
 func GetMultipleResources(context middleware.Context, dataStore db.DB, resourceSchema *schema.Schema, queryParameters map[string][]string) error {
-	log.Debug("Start get multiple resources!!")
+	l.ContextLogger(log, context).Debug("Start get multiple resources!!")
 	auth := context["auth"].(schema.Authorization)
 	policy, err := loadPolicy(context, "read", resourceSchema.GetPluralURL(), auth)
 	if err != nil {
@@ -226,6 +239,16 @@ func GetMultipleResources(context middleware.Context, dataStore db.DB, resourceS
 		filter["tenant_id"] = policy.GetTenantIDFilter(schema.ActionRead, auth.TenantID())
 	}
 	filter = policy.Filter(filter)
+	if tags := policyTags(policy, schema.ActionRead, resourceSchema); len(tags) > 0 {
+		queryTags, _ := filter[schema.TagsPropertyID].([]string)
+		filter[schema.TagsPropertyID] = append(append([]string{}, queryTags...), tags...)
+	}
+	if comparisons := policy.GetAttributeFilter(schema.ActionRead, auth); len(comparisons) > 0 {
+		filter[schema.ConditionsFilterKey] = comparisons
+	}
+	if exclusions := policy.GetExclusionFilter(schema.ActionRead, auth); len(exclusions) > 0 {
+		filter[schema.ExclusionsFilterKey] = exclusions
+	}
 
 	paginator, err := pagination.FromURLQuery(resourceSchema, queryParameters)
 	if err != nil {
@@ -290,7 +313,13 @@ func GetSingleResource(context middleware.Context, dataStore db.DB, resourceSche
 	if err := InTransaction(
 		context, dataStore,
 		func() error {
-			return GetSingleResourceInTransaction(context, resourceSchema, resourceID, policy.GetTenantIDFilter(schema.ActionRead, auth.TenantID()))
+			if err := GetSingleResourceInTransaction(context, resourceSchema, resourceID, policy.GetTenantIDFilter(schema.ActionRead, auth.TenantID())); err != nil {
+				return err
+			}
+			if err := checkResponseTags(context, policy, schema.ActionRead, resourceSchema, NotFound); err != nil {
+				return err
+			}
+			return checkResponseAttributes(context, policy, schema.ActionRead, resourceSchema, auth, NotFound)
 		},
 	); err != nil {
 		return err
@@ -328,7 +357,7 @@ func GetSingleResourceInTransaction(context middleware.Context, resourceSchema *
 	if resourceSchema.ID == "schema" {
 		manager := schema.GetManager()
 		requestedSchema, _ := manager.Schema(resourceID)
-		object, err = GetSchema(requestedSchema, auth)
+		object, err = GetLocalizedSchema(requestedSchema, auth, contextLanguages(context))
 	} else {
 		object, err = mainTransaction.Fetch(resourceSchema, resourceID, tenantIDs)
 	}
@@ -421,6 +450,15 @@ func CreateResource(
 
 	context["resource"] = resource.Data()
 
+	if resourceSchema.Tagging {
+		if err := policy.CheckTags(schema.ActionCreate, resource.Get(schema.TagsPropertyID)); err != nil {
+			return ResourceError{err, err.Error(), Unauthorized}
+		}
+	}
+	if err := policy.CheckAttributes(schema.ActionCreate, auth, resource.Data()); err != nil {
+		return ResourceError{err, err.Error(), Unauthorized}
+	}
+
 	if err := InTransaction(
 		context, dataStore,
 		func() error {
@@ -452,13 +490,24 @@ func CreateResourceInTransaction(context middleware.Context, resource *schema.Re
 	if err := handleEvent(context, environment, "pre_create_in_transaction"); err != nil {
 		return err
 	}
+	if resourceSchema.StateMachine != nil {
+		auth, _ := context["auth"].(schema.Authorization)
+		err := resourceSchema.StateMachine.CheckInitialState(
+			resource.Get(resourceSchema.StateMachine.Property), schema.ActionCreate, auth)
+		if err != nil {
+			return transitionError(err)
+		}
+	}
 	if err := mainTransaction.Create(resource); err != nil {
-		log.Debug("%s transaction error", err)
+		l.ContextLogger(log, context).Debug("%s transaction error", err)
 		return ResourceError{
 			err,
 			fmt.Sprintf("Failed to store data in database: %v", err),
 			CreateFailed}
 	}
+	if err := resource.PopulateComputed(); err != nil {
+		return err
+	}
 
 	response := map[string]interface{}{}
 	response[resourceSchema.Singular] = resource.Data()
@@ -523,7 +572,32 @@ func UpdateResource(
 	if err := InTransaction(
 		context, dataStore,
 		func() error {
-			return UpdateResourceInTransaction(context, resourceSchema, resourceID, dataMap, policy.GetTenantIDFilter(schema.ActionUpdate, auth.TenantID()))
+			tenantIDs := policy.GetTenantIDFilter(schema.ActionUpdate, auth.TenantID())
+			tags := policyTags(policy, schema.ActionUpdate, resourceSchema)
+			comparisons := policy.GetAttributeFilter(schema.ActionUpdate, auth)
+			exclusions := policy.GetExclusionFilter(schema.ActionUpdate, auth)
+			if len(tags) > 0 || len(comparisons) > 0 || len(exclusions) > 0 {
+				mainTransaction := context["transaction"].(transaction.Transaction)
+				resource, err := mainTransaction.Fetch(resourceSchema, resourceID, tenantIDs)
+				if err != nil {
+					return ResourceError{err, err.Error(), WrongQuery}
+				}
+				if len(tags) > 0 {
+					if err := policy.CheckTags(schema.ActionUpdate, resource.Get(schema.TagsPropertyID)); err != nil {
+						return ResourceError{err, "", NotFound}
+					}
+				}
+				if err := policy.CheckAttributes(schema.ActionUpdate, auth, resource.Data()); err != nil {
+					return ResourceError{err, err.Error(), Unauthorized}
+				}
+			}
+			if err := UpdateResourceInTransaction(context, resourceSchema, resourceID, dataMap, tenantIDs); err != nil {
+				return err
+			}
+			if err := checkResponseTags(context, policy, schema.ActionUpdate, resourceSchema, Unauthorized); err != nil {
+				return err
+			}
+			return checkResponseAttributes(context, policy, schema.ActionUpdate, resourceSchema, auth, Unauthorized)
 		},
 	); err != nil {
 		return err
@@ -557,6 +631,10 @@ func UpdateResourceInTransaction(
 	if err != nil {
 		return ResourceError{err, err.Error(), WrongQuery}
 	}
+	var previousState interface{}
+	if resourceSchema.StateMachine != nil {
+		previousState = resource.Get(resourceSchema.StateMachine.Property)
+	}
 	err = resource.Update(dataMap)
 	if err != nil {
 		return ResourceError{err, err.Error(), WrongData}
@@ -576,16 +654,36 @@ func UpdateResourceInTransaction(
 		return fmt.Errorf("Loading Resource failed: %s", err)
 	}
 
+	var transition *schema.StateTransition
+	if resourceSchema.StateMachine != nil {
+		auth, _ := context["auth"].(schema.Authorization)
+		transition, err = resourceSchema.StateMachine.CheckTransition(
+			previousState, resource.Get(resourceSchema.StateMachine.Property), schema.ActionUpdate, auth)
+		if err != nil {
+			return transitionError(err)
+		}
+	}
+
 	err = mainTransaction.Update(resource)
 	if err != nil {
 		return ResourceError{err, fmt.Sprintf("Failed to store data in database: %v", err), UpdateFailed}
 	}
 	resourceSchema.HandleUpdate(resource)
+	if err := resource.PopulateComputed(); err != nil {
+		return err
+	}
 
 	response := map[string]interface{}{}
 	response[resourceSchema.Singular] = resource.Data()
 	context["response"] = response
 
+	if transition != nil {
+		context["transition"] = transition.Data()
+		if err := handleEvent(context, environment, "state_transition"); err != nil {
+			return err
+		}
+	}
+
 	if err := handleEvent(context, environment, "post_update_in_transaction"); err != nil {
 		return err
 	}
@@ -616,7 +714,24 @@ func DeleteResource(context middleware.Context,
 		return fmt.Errorf("cannot create transaction: %v", err)
 	}
 	resource, fetchErr := preTransaction.Fetch(resourceSchema, resourceID, policy.GetTenantIDFilter(schema.ActionDelete, auth.TenantID()))
+	var cascaded []*schema.Resource
+	if fetchErr == nil && resourceSchema.Tagging {
+		fetchErr = policy.CheckTags(schema.ActionDelete, resource.Get(schema.TagsPropertyID))
+	}
+	var conditionErr error
+	if fetchErr == nil {
+		conditionErr = policy.CheckAttributes(schema.ActionDelete, auth, resource.Data())
+	}
+	if fetchErr == nil && conditionErr == nil {
+		cascaded, err = cascadedResources(preTransaction, resourceSchema, resourceID)
+	}
 	preTransaction.Close()
+	if err != nil {
+		return err
+	}
+	if conditionErr != nil {
+		return ResourceError{conditionErr, conditionErr.Error(), Unauthorized}
+	}
 	context["resource"] = resource
 
 	if err := handleEvent(context, environment, "pre_delete"); err != nil {
@@ -627,10 +742,23 @@ func DeleteResource(context middleware.Context,
 		return ResourceError{err, "", NotFound}
 	}
 
+	if err := handleCascadedEvent(context, cascaded, "pre_delete"); err != nil {
+		return err
+	}
+
 	if err := InTransaction(
 		context, dataStore,
 		func() error {
-			return DeleteResourceInTransaction(context, resourceSchema, resourceID)
+			mainTransaction := context["transaction"].(transaction.Transaction)
+			current, err := cascadedResources(mainTransaction, resourceSchema, resourceID)
+			if err != nil {
+				return ResourceError{err, "", DeleteFailed}
+			}
+			if !sameResources(cascaded, current) {
+				err := fmt.Errorf("Resources referring %s %s changed while deleting it", resourceSchema.ID, resourceID)
+				return ResourceError{err, err.Error(), DeleteFailed}
+			}
+			return deleteResourceInTransaction(context, resourceSchema, resourceID, current)
 		},
 	); err != nil {
 		return err
@@ -639,11 +767,204 @@ func DeleteResource(context middleware.Context,
 	if err := handleEvent(context, environment, "post_delete"); err != nil {
 		return err
 	}
+	return handleCascadedEvent(context, cascaded, "post_delete")
+}
+
+//UpdateResourceTags adds tags to the resource and removes tags of the given keys
+func UpdateResourceTags(
+	context middleware.Context,
+	dataStore db.DB, identityService middleware.IdentityService,
+	resourceSchema *schema.Schema,
+	resourceID string, added map[string]interface{}, removed []string,
+) error {
+	if !resourceSchema.Tagging {
+		err := fmt.Errorf("%s doesn't support tags", resourceSchema.ID)
+		return ResourceError{err, err.Error(), WrongQuery}
+	}
+	auth := context["auth"].(schema.Authorization)
+	policy, err := loadPolicy(context, "update", strings.Replace(resourceSchema.GetSingleURL(), ":id", resourceID, 1), auth)
+	if err != nil {
+		return err
+	}
+	preTransaction, err := dataStore.Begin()
+	if err != nil {
+		return fmt.Errorf("cannot create transaction: %v", err)
+	}
+	resource, err := preTransaction.Fetch(resourceSchema, resourceID, policy.GetTenantIDFilter(schema.ActionUpdate, auth.TenantID()))
+	preTransaction.Close()
+	if err != nil {
+		return ResourceError{err, "", NotFound}
+	}
+	tags := schema.MergeTags(resource.Get(schema.TagsPropertyID), added, removed)
+	return UpdateResource(context, dataStore, identityService, resourceSchema, resourceID,
+		map[string]interface{}{schema.TagsPropertyID: tags})
+}
+
+//UpdateResourceTagsInTransaction adds tags to the resource and removes tags of the given keys in transaction
+func UpdateResourceTagsInTransaction(
+	context middleware.Context,
+	resourceSchema *schema.Schema, resourceID string,
+	added map[string]interface{}, removed []string, tenantIDs []string) error {
+	if !resourceSchema.Tagging {
+		err := fmt.Errorf("%s doesn't support tags", resourceSchema.ID)
+		return ResourceError{err, err.Error(), WrongQuery}
+	}
+	mainTransaction := context["transaction"].(transaction.Transaction)
+	resource, err := mainTransaction.Fetch(resourceSchema, resourceID, tenantIDs)
+	if err != nil {
+		return ResourceError{err, err.Error(), WrongQuery}
+	}
+	tags := schema.MergeTags(resource.Get(schema.TagsPropertyID), added, removed)
+	return UpdateResourceInTransaction(context, resourceSchema, resourceID,
+		map[string]interface{}{schema.TagsPropertyID: tags}, tenantIDs)
+}
+
+//policyTags returns tags required by policy for the action on resources of the schema
+//Tag conditions apply only to schemas with tagging
+func policyTags(policy *schema.Policy, action string, resourceSchema *schema.Schema) []string {
+	if !resourceSchema.Tagging {
+		return nil
+	}
+	return policy.GetTagFilter(action)
+}
+
+//checkResponseTags checks if the resource in response has tags required by policy
+func checkResponseTags(context middleware.Context, policy *schema.Policy, action string, resourceSchema *schema.Schema, problem ResourceProblem) error {
+	tags := policyTags(policy, action, resourceSchema)
+	if len(tags) == 0 {
+		return nil
+	}
+	response, _ := context["response"].(map[string]interface{})
+	data, ok := response[resourceSchema.Singular].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if err := policy.CheckTags(action, data[schema.TagsPropertyID]); err != nil {
+		message := err.Error()
+		if problem == NotFound {
+			message = ""
+		}
+		return ResourceError{err, message, problem}
+	}
+	return nil
+}
+
+//checkResponseAttributes checks if the resource in response satisfies attribute conditions of policy
+func checkResponseAttributes(context middleware.Context, policy *schema.Policy, action string, resourceSchema *schema.Schema, auth schema.Authorization, problem ResourceProblem) error {
+	response, _ := context["response"].(map[string]interface{})
+	data, ok := response[resourceSchema.Singular].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if err := policy.CheckAttributes(action, auth, data); err != nil {
+		message := err.Error()
+		if problem == NotFound {
+			message = ""
+		}
+		return ResourceError{err, message, problem}
+	}
+	return nil
+}
+
+//cascadedResources lists resources deleted together with the resource by relations with cascade on_delete.
+//Resources are listed before resources they refer, unless they refer each other by a cycle of relations.
+func cascadedResources(tx transaction.Transaction, resourceSchema *schema.Schema, resourceID string) ([]*schema.Resource, error) {
+	visited := map[string]bool{resourceKey(resourceSchema, resourceID): true}
+	return listCascadedResources(tx, resourceSchema, resourceID, visited)
+}
+
+func listCascadedResources(tx transaction.Transaction, resourceSchema *schema.Schema, resourceID string, visited map[string]bool) ([]*schema.Resource, error) {
+	result := []*schema.Resource{}
+	for _, reference := range schema.GetManager().RelationsTo(resourceSchema.ID) {
+		if reference.Property.OnDelete != schema.OnDeleteCascade || reference.Property.IsManyToMany() {
+			continue
+		}
+		children, _, err := tx.List(reference.Schema, map[string]interface{}{reference.Property.ID: resourceID}, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			key := resourceKey(reference.Schema, child.ID())
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+			descendants, err := listCascadedResources(tx, reference.Schema, child.ID(), visited)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, descendants...)
+			result = append(result, child)
+		}
+	}
+	return result, nil
+}
+
+//resourceKey identifies a resource among resources of all schemas
+func resourceKey(resourceSchema *schema.Schema, resourceID string) string {
+	return resourceSchema.ID + "/" + resourceID
+}
+
+//sameResources checks if lists contain the same resources
+func sameResources(list, other []*schema.Resource) bool {
+	if len(list) != len(other) {
+		return false
+	}
+	keys := map[string]bool{}
+	for _, resource := range list {
+		keys[resourceKey(resource.Schema(), resource.ID())] = true
+	}
+	for _, resource := range other {
+		if !keys[resourceKey(resource.Schema(), resource.ID())] {
+			return false
+		}
+	}
+	return true
+}
+
+//cascadeContext makes context for deleting a resource together with the resource of given context
+func cascadeContext(context middleware.Context, resource *schema.Resource) middleware.Context {
+	cascadeContext := middleware.Context{}
+	for key, value := range context {
+		switch key {
+		case "response", "exception", "exception_message":
+			continue
+		}
+		cascadeContext[key] = value
+	}
+	cascadeContext["id"] = resource.ID()
+	cascadeContext["resource"] = resource
+	cascadeContext["schema"] = resource.Schema()
+	return cascadeContext
+}
+
+//handleCascadedEvent handles event for each resource deleted by cascade
+func handleCascadedEvent(context middleware.Context, cascaded []*schema.Resource, event string) error {
+	for _, resource := range cascaded {
+		environment, ok := extension.GetManager().GetEnvironment(resource.Schema().ID)
+		if !ok {
+			return fmt.Errorf("No environment for schema")
+		}
+		if err := handleEvent(cascadeContext(context, resource), environment, event); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 //DeleteResourceInTransaction deletes resources in a transaction
+//Resources referring it by relations with cascade on_delete are deleted first
 func DeleteResourceInTransaction(context middleware.Context, resourceSchema *schema.Schema, resourceID string) error {
+	mainTransaction := context["transaction"].(transaction.Transaction)
+	cascaded, err := cascadedResources(mainTransaction, resourceSchema, resourceID)
+	if err != nil {
+		return ResourceError{err, "", DeleteFailed}
+	}
+	return deleteResourceInTransaction(context, resourceSchema, resourceID, cascaded)
+}
+
+//deleteResourceInTransaction deletes cascaded resources, listed by cascadedResources, and then the resource
+func deleteResourceInTransaction(context middleware.Context, resourceSchema *schema.Schema, resourceID string, cascaded []*schema.Resource) error {
 	mainTransaction := context["transaction"].(transaction.Transaction)
 	environmentManager := extension.GetManager()
 	environment, ok := environmentManager.GetEnvironment(resourceSchema.ID)
@@ -654,6 +975,12 @@ func DeleteResourceInTransaction(context middleware.Context, resourceSchema *sch
 		return err
 	}
 
+	for _, resource := range cascaded {
+		if err := deleteResourceInTransaction(cascadeContext(context, resource), resource.Schema(), resource.ID(), nil); err != nil {
+			return err
+		}
+	}
+
 	err := mainTransaction.Delete(resourceSchema, resourceID)
 	if err != nil {
 		return ResourceError{err, "", DeleteFailed}
@@ -734,6 +1061,12 @@ func handleEvent(context middleware.Context, environment extension.Environment,
 	return ExtensionError{fmt.Errorf("%v", exceptionMessage), exceptionInfo}
 }
 
+//contextLanguages returns languages preferred by the client
+func contextLanguages(context middleware.Context) []string {
+	languages, _ := context["languages"].([]string)
+	return languages
+}
+
 func loadPolicy(context middleware.Context, action, path string, auth schema.Authorization) (*schema.Policy, error) {
 	manager := schema.GetManager()
 	policy, role := manager.PolicyValidate(action, path, auth)
@@ -748,6 +1081,11 @@ func loadPolicy(context middleware.Context, action, path string, auth schema.Aut
 
 //GetSchema returns the schema filtered and trimmed for a specific user or nil when the user shouldn't see it at all
 func GetSchema(s *schema.Schema, authorization schema.Authorization) (result *schema.Resource, err error) {
+	return GetLocalizedSchema(s, authorization, nil)
+}
+
+//GetLocalizedSchema returns the schema like GetSchema, with titles and descriptions in the first available of languages
+func GetLocalizedSchema(s *schema.Schema, authorization schema.Authorization, languages []string) (result *schema.Resource, err error) {
 	manager := schema.GetManager()
 	metaschema, _ := manager.Schema("schema")
 	policy, _ := manager.PolicyValidate("read", s.GetPluralURL(), authorization)
@@ -788,6 +1126,7 @@ func GetSchema(s *schema.Schema, authorization schema.Authorization) (result *sc
 	schemaSchema["properties"] = schemaProperties
 	schemaSchema["propertiesOrder"] = schemaPropertiesOrder
 	schemaSchema["required"] = schemaRequired
+	rawSchema = schema.LocalizeRawSchema(rawSchema, languages)
 	result, err = schema.NewResource(metaschema, rawSchema)
 	if err != nil {
 		log.Warning("%s %s", result, err)
@@ -994,6 +994,92 @@ var _ = Describe("Resource manager", func() {
 		})
 	})
 
+	Describe("Deleting a resource referred with cascade on_delete", func() {
+		var (
+			networkProperty *schema.Property
+			serverSchema    *schema.Schema
+			serverEvents    map[string]string
+		)
+
+		BeforeEach(func() {
+			schemaID = "network"
+			action = "delete"
+			serverEvents = map[string]string{}
+			serverSchema, _ = manager.Schema("server")
+			networkProperty, _ = serverSchema.GetPropertyByID("network_id")
+			networkProperty.OnDelete = schema.OnDeleteCascade
+		})
+
+		JustBeforeEach(func() {
+			network, err := manager.LoadResource("network", map[string]interface{}{
+				"id": resourceID1, "tenant_id": adminTenantID, "name": "net", "description": "",
+				"providor_networks": map[string]interface{}{}, "route_targets": []interface{}{}, "shared": false})
+			Expect(err).NotTo(HaveOccurred())
+			server, err := manager.LoadResource("server", map[string]interface{}{
+				"id": resourceID2, "tenant_id": adminTenantID, "network_id": resourceID1})
+			Expect(err).NotTo(HaveOccurred())
+			transaction, err := testDB.Begin()
+			Expect(err).NotTo(HaveOccurred())
+			defer transaction.Close()
+			Expect(transaction.Create(network)).To(Succeed())
+			Expect(transaction.Create(server)).To(Succeed())
+			Expect(transaction.Commit()).To(Succeed())
+
+			serverEnv := otto.NewEnvironment(testDB, &middleware.FakeIdentity{})
+			serverExtensions := []*schema.Extension{}
+			for event, javascript := range serverEvents {
+				extension, err := schema.NewExtension(map[string]interface{}{
+					"id":   event + "_server_extension",
+					"code": `gohan_register_handler("` + event + `", function(context) {` + javascript + `});`,
+					"path": serverSchema.GetPluralURL(),
+				})
+				Expect(err).ToNot(HaveOccurred())
+				serverExtensions = append(serverExtensions, extension)
+			}
+			Expect(serverEnv.LoadExtensionsForPath(serverExtensions, serverSchema.GetPluralURL())).To(Succeed())
+			environmentManager.RegisterEnvironment("server", serverEnv)
+		})
+
+		AfterEach(func() {
+			environmentManager.UnRegisterEnvironment("server")
+			transaction, err := testDB.Begin()
+			Expect(err).NotTo(HaveOccurred())
+			defer transaction.Close()
+			Expect(clearTable(transaction, serverSchema)).To(Succeed())
+			Expect(transaction.Commit()).To(Succeed())
+			networkProperty.OnDelete = ""
+		})
+
+		It("Should delete referring resources", func() {
+			Expect(resources.DeleteResource(context, testDB, currentSchema, resourceID1)).To(Succeed())
+			transaction, err := testDB.Begin()
+			Expect(err).NotTo(HaveOccurred())
+			defer transaction.Close()
+			list, _, err := transaction.List(serverSchema, nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(BeEmpty())
+		})
+
+		for _, event := range []string{"pre_delete", "pre_delete_in_transaction", "post_delete_in_transaction", "post_delete"} {
+			event := event
+			Context("With "+event+" of referring resource", func() {
+				BeforeEach(func() {
+					serverEvents[event] = `if (context.id === "` + resourceID2 + `") {
+						throw new CustomException("` + event + `", 390);
+					}`
+				})
+
+				It("Should run the extension", func() {
+					err := resources.DeleteResource(context, testDB, currentSchema, resourceID1)
+					Expect(err).To(HaveOccurred())
+					extErr, ok := err.(resources.ExtensionError)
+					Expect(ok).To(BeTrue())
+					Expect(extErr.ExceptionInfo).To(HaveKeyWithValue("message", event))
+				})
+			})
+		}
+	})
+
 	Describe("Creating a resource", func() {
 		var (
 			adminResourceData, memberResourceData map[string]interface{}
@@ -1352,6 +1438,55 @@ var _ = Describe("Resource manager", func() {
 				})
 			})
 
+			Context("With a state machine", func() {
+				BeforeEach(func() {
+					auth = memberAuth
+					stateMachine, err := schema.NewStateMachine(map[string]interface{}{
+						"property": "test_string",
+						"states":   []interface{}{"ACTIVE", "DISABLED"},
+						"transitions": []interface{}{
+							map[string]interface{}{"to": "ACTIVE"},
+							map[string]interface{}{"to": "DISABLED", "roles": []interface{}{"admin"}},
+						},
+					})
+					Expect(err).ToNot(HaveOccurred())
+					testSchema, _ := manager.Schema("test")
+					testSchema.StateMachine = stateMachine
+				})
+
+				AfterEach(func() {
+					testSchema, _ := manager.Schema("test")
+					testSchema.StateMachine = nil
+				})
+
+				It("Should allow transitions permitted for the role", func() {
+					err := resources.UpdateResource(
+						context, testDB, fakeIdentity, currentSchema, resourceID1,
+						map[string]interface{}{"test_string": "ACTIVE"})
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("Should not authorize transitions denied to the role", func() {
+					err := resources.UpdateResource(
+						context, testDB, fakeIdentity, currentSchema, resourceID1,
+						map[string]interface{}{"test_string": "DISABLED"})
+					Expect(err).To(HaveOccurred())
+					resErr, ok := err.(resources.ResourceError)
+					Expect(ok).To(BeTrue())
+					Expect(resErr.Problem).To(Equal(resources.Unauthorized))
+				})
+
+				It("Should reject transitions to unknown states", func() {
+					err := resources.UpdateResource(
+						context, testDB, fakeIdentity, currentSchema, resourceID1,
+						map[string]interface{}{"test_string": "DELETED"})
+					Expect(err).To(HaveOccurred())
+					resErr, ok := err.(resources.ResourceError)
+					Expect(ok).To(BeTrue())
+					Expect(resErr.Problem).To(Equal(resources.WrongData))
+				})
+			})
+
 			Describe("With extensions", func() {
 				Context("Only pre_update", func() {
 					BeforeEach(func() {
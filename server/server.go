@@ -16,12 +16,14 @@
 package server
 
 import (
+	gotls "crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"path"
 	"path/filepath"
+	"sync/atomic"
 	"time"
 
 	"github.com/cloudwan/gohan/cloud"
@@ -44,6 +46,8 @@ const lockPath = "gohan/cluster/lock"
 type tls struct {
 	CertFile string
 	KeyFile  string
+	//ClientConfig verifies client certificates, if configured
+	ClientConfig *gotls.Config
 }
 
 //Server is a struct for GohanAPIServer
@@ -55,29 +59,51 @@ type Server struct {
 	sync             sync.Sync
 	running          bool
 	martini          *martini.ClassicMartini
+	router           atomic.Value
 	keystoneIdentity middleware.IdentityService
+	rateLimitCounter middleware.RateLimitCounter
+	amqpStatus       *amqpStatus
+	reloadSignal     chan os.Signal
 }
 
 func (server *Server) mapRoutes() {
+	server.mapSchemaRoutes()
 	schemaManager := schema.GetManager()
+	ok, err := server.loadStoredDefinitions(schemaManager)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if ok {
+		server.setDefinitionHandlers(schemaManager)
+	}
+}
+
+func (server *Server) mapSchemaRoutes() {
 	MapNamespacesRoutes(server.martini)
 	MapRouteBySchemas(server, server.db)
+	if config := util.GetConfig(); config.GetBool("metrics/enabled", false) {
+		server.mapMetricsRoute(config)
+	}
+}
 
+//loadStoredDefinitions loads policies, extensions and namespaces stored in the database
+//into the manager, and returns false if the manager has no gohan schema to store them
+func (server *Server) loadStoredDefinitions(schemaManager *schema.Manager) (bool, error) {
 	tx, err := server.db.Begin()
 	if err != nil {
-		log.Fatal(err)
+		return false, err
 	}
 	defer tx.Close()
 	coreSchema, _ := schemaManager.Schema("schema")
 	if coreSchema == nil {
 		log.Info("No gohan schema. Disabling schema editing mode")
-		return
+		return false, nil
 	}
 
 	policySchema, _ := schemaManager.Schema("policy")
 	if coreSchema == nil {
 		log.Error("No gohan schema. Disabling schema editing mode")
-		return
+		return false, nil
 	}
 
 	policyList, _, err := tx.List(policySchema, nil, nil)
@@ -96,7 +122,7 @@ func (server *Server) mapRoutes() {
 	namespaceSchema, _ := schemaManager.Schema("namespace")
 	if namespaceSchema == nil {
 		log.Error("No gohan schema. Disabling schema editing mode")
-		return
+		return false, nil
 	}
 	namespaceList, _, err := tx.List(namespaceSchema, nil, nil)
 	if err != nil {
@@ -107,6 +133,13 @@ func (server *Server) mapRoutes() {
 		log.Info(err.Error())
 	}
 	schemaManager.LoadNamespaces(namespaceList)
+	return true, nil
+}
+
+//setDefinitionHandlers remaps routes when schemas or extensions are changed through the API
+func (server *Server) setDefinitionHandlers(schemaManager *schema.Manager) {
+	coreSchema, _ := schemaManager.Schema("schema")
+	extensionSchema, _ := schemaManager.Schema("extension")
 
 	var schemaHandler = func(resource *schema.Resource) {
 		s, err := schema.NewSchemaFromObj(resource.Data())
@@ -115,8 +148,7 @@ func (server *Server) mapRoutes() {
 		}
 		schemaManager.UnRegisterSchema(s)
 		server.db.DropTable(s)
-		server.resetRouter()
-		server.mapRoutes()
+		server.remapRoutes()
 	}
 
 	var extensionHandler = func(resource *schema.Resource) {
@@ -131,8 +163,7 @@ func (server *Server) mapRoutes() {
 		}
 		schemaManager.ClearExtensions()
 		schemaManager.LoadExtensions(extensionList)
-		server.resetRouter()
-		server.mapRoutes()
+		server.remapRoutes()
 	}
 
 	coreSchema.SetCreateHandler(schemaHandler)
@@ -153,11 +184,25 @@ func (server *Server) addOptionsRoute() {
 func (server *Server) resetRouter() {
 	router := martini.NewRouter()
 	server.martini.Router = router
-	server.martini.MapTo(router, (*martini.Routes)(nil))
-	server.martini.Action(router.Handle)
+	server.router.Store(router)
 	server.addOptionsRoute()
 }
 
+//remapRoutes maps routes again, serialized with schema reloads
+func (server *Server) remapRoutes() {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	server.resetRouter()
+	server.mapRoutes()
+}
+
+//handleRoute handles requests by the active router, which is replaced when routes are remapped
+func (server *Server) handleRoute(res http.ResponseWriter, req *http.Request, c martini.Context) {
+	router := server.router.Load().(martini.Router)
+	c.MapTo(router, (*martini.Routes)(nil))
+	router.Handle(res, req, c)
+}
+
 func (server *Server) initDB() error {
 	return db.InitDBWithSchemas(server.getDatabaseConfig())
 }
@@ -166,6 +211,9 @@ func (server *Server) connectDB() error {
 	dbType, dbConnection, _, _ := server.getDatabaseConfig()
 	dbConn, err := db.ConnectDB(dbType, dbConnection)
 	server.db = &DbSyncWrapper{dbConn}
+	if util.GetConfig().GetBool("metrics/enabled", false) {
+		server.db = &DbMetricsWrapper{server.db}
+	}
 	return err
 }
 
@@ -184,6 +232,41 @@ func (server *Server) getDatabaseConfig() (string, string, bool, bool) {
 	return databaseType, databaseConnection, databaseDropOnCreate, databaseCascade
 }
 
+//newJWTIdentity creates JWT identity service from jwt configuration
+func newJWTIdentity(config *util.Config) (*cloud.JWTIdentity, error) {
+	tenants := map[string]string{}
+	for _, rawTenant := range config.GetList("jwt/tenants", nil) {
+		tenant, _ := rawTenant.(map[string]interface{})
+		tenantID, _ := tenant["id"].(string)
+		tenantName, _ := tenant["name"].(string)
+		tenants[tenantID] = tenantName
+	}
+	return cloud.NewJWTIdentity(cloud.JWTConfig{
+		JWKSFile:      config.GetString("jwt/jwks_file", ""),
+		JWKSURL:       config.GetString("jwt/jwks_url", ""),
+		JWKSRefresh:   time.Duration(config.GetInt("jwt/jwks_refresh", 3600)) * time.Second,
+		Issuer:        config.GetString("jwt/issuer", ""),
+		Audience:      config.GetString("jwt/audience", ""),
+		Leeway:        time.Duration(config.GetInt("jwt/leeway", 60)) * time.Second,
+		AllowNoExpiry: config.GetBool("jwt/allow_no_expiry", false),
+		Claims: cloud.JWTClaims{
+			TenantID:   config.GetString("jwt/claims/tenant_id", ""),
+			TenantName: config.GetString("jwt/claims/tenant_name", ""),
+			UserID:     config.GetString("jwt/claims/user_id", ""),
+			Roles:      config.GetString("jwt/claims/roles", ""),
+			Groups:     config.GetString("jwt/claims/groups", ""),
+		},
+		Tenants: tenants,
+		ServiceAuthorization: schema.NewAuthorization(
+			config.GetString("jwt/service_authorization/tenant_id", ""),
+			config.GetString("jwt/service_authorization/tenant_name", ""),
+			"",
+			config.GetStringList("jwt/service_authorization/roles", []string{"admin"}),
+			nil,
+		),
+	})
+}
+
 //NewServer returns new GohanAPIServer
 func NewServer(configFile string) (*Server, error) {
 	manager := schema.GetManager()
@@ -207,8 +290,22 @@ func NewServer(configFile string) (*Server, error) {
 	m.Use(martini.Recovery())
 	m.Use(middleware.JSONURLs())
 	m.Use(middleware.WithContext())
+	if config.GetBool("metrics/enabled", false) {
+		log.Info("Metrics enabled")
+		m.Use(middleware.Metrics())
+	}
+	if config.GetBool("health/enabled", false) {
+		log.Info("Health checks enabled")
+		healthChecker, err := newHealthChecker(server, config)
+		if err != nil {
+			return nil, err
+		}
+		m.Use(healthChecker.handler())
+	}
 
 	server.martini = m
+	server.router.Store(m.Router)
+	m.Action(server.handleRoute)
 	server.address = config.GetString("address", ":9091")
 	if config.GetBool("tls/enabled", false) {
 		log.Info("TLS enabled")
@@ -216,6 +313,10 @@ func NewServer(configFile string) (*Server, error) {
 			KeyFile:  config.GetString("tls/key_file", "./etc/key.pem"),
 			CertFile: config.GetString("tls/cert_file", "./etc/cert.pem"),
 		}
+		server.tls.ClientConfig, err = newClientTLSConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("TLS client CA error: %s", err)
+		}
 	}
 
 	server.connectDB()
@@ -271,11 +372,88 @@ func NewServer(configFile string) (*Server, error) {
 			if err != nil {
 				log.Fatal(err)
 			}
+			if size := config.GetInt("keystone/token_cache/size", 0); size > 0 {
+				log.Info("Keystone token cache enabled")
+				server.keystoneIdentity.(*cloud.KeystoneIdentity).EnableTokenCache(cloud.TokenCacheConfig{
+					Size:               size,
+					TTL:                time.Duration(config.GetInt("keystone/token_cache/ttl", 300)) * time.Second,
+					NegativeTTL:        time.Duration(config.GetInt("keystone/token_cache/negative_ttl", 10)) * time.Second,
+					RevocationInterval: time.Duration(config.GetInt("keystone/token_cache/revocation_interval", 60)) * time.Second,
+				})
+			}
+			if config.GetBool("keystone/user_groups", false) {
+				log.Info("Keystone user groups enabled")
+				if err := server.keystoneIdentity.(*cloud.KeystoneIdentity).EnableUserGroups(); err != nil {
+					log.Warning("Keystone user groups disabled: %s", err)
+				}
+			}
+			if config.GetBool("keystone/tenant_directory/enabled", false) {
+				log.Info("Keystone tenant directory enabled")
+				if err := server.keystoneIdentity.(*cloud.KeystoneIdentity).EnableTenantDirectory(cloud.TenantDirectoryConfig{
+					RefreshInterval:     time.Duration(config.GetInt("keystone/tenant_directory/refresh_interval", 300)) * time.Second,
+					MissRefreshInterval: time.Duration(config.GetInt("keystone/tenant_directory/miss_refresh_interval", 10)) * time.Second,
+				}); err != nil {
+					log.Warning("Keystone tenant directory disabled: %s", err)
+				}
+			}
+		}
+	} else if config.GetBool("jwt/use_jwt", false) {
+		log.Info("JWT identity configured")
+		server.keystoneIdentity, err = newJWTIdentity(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if server.tls != nil && server.tls.ClientConfig != nil && config.GetList("tls/client_certificates", nil) != nil {
+		log.Info("Client certificate identity configured")
+		certificates, err := newCertificateIdentity(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if server.keystoneIdentity == nil {
+			server.keystoneIdentity = certificates
+		} else {
+			server.keystoneIdentity = &certificateIdentity{IdentityService: server.keystoneIdentity, certificates: certificates}
 		}
+	}
+	if server.keystoneIdentity != nil && config.GetBool("api_keys/enabled", false) {
+		log.Info("API keys enabled")
+		server.keystoneIdentity = &apiKeyIdentity{IdentityService: server.keystoneIdentity, db: server.db}
+	}
+	if server.keystoneIdentity != nil && config.GetBool("metrics/enabled", false) {
+		registerIdentityMetrics(server.keystoneIdentity)
+	}
+	var rateLimiting martini.Handler
+	if config.GetBool("rate_limit/enabled", false) {
+		log.Info("Rate limiting enabled")
+		rateLimitConfig, err := newRateLimitConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		server.rateLimitCounter = server.newRateLimitCounter(config)
+		rateLimiting = middleware.RateLimiting(rateLimitConfig, server.rateLimitCounter)
+		//Requests counted by IP or token are limited before authentication, including failing ones
+		if !rateLimitConfig.NeedsAuthorization() {
+			m.Use(rateLimiting)
+			rateLimiting = nil
+		}
+	}
+	if server.keystoneIdentity != nil {
 		m.MapTo(server.keystoneIdentity, (*middleware.IdentityService)(nil))
-		m.Use(middleware.Authentication())
+		authenticationConfig, err := middleware.NewAuthenticationConfig(
+			config.GetStringList("authentication/public_paths", middleware.DefaultPublicPaths),
+			config.GetString("authentication/anonymous/tenant_id", ""),
+			config.GetString("authentication/anonymous/tenant_name", ""),
+		)
+		if err != nil {
+			return nil, err
+		}
+		m.Use(middleware.Authentication(authenticationConfig))
 		//m.Use(Authorization())
 	}
+	if rateLimiting != nil {
+		m.Use(rateLimiting)
+	}
 
 	if err != nil {
 		return nil, fmt.Errorf("invalid base dir: %s", err)
@@ -290,7 +468,7 @@ func NewServer(configFile string) (*Server, error) {
 		}
 		server.martini.Use(func(rw http.ResponseWriter, r *http.Request) {
 			rw.Header().Add("Access-Control-Allow-Origin", cors)
-			rw.Header().Add("Access-Control-Allow-Headers", "X-Auth-Token, Content-Type")
+			rw.Header().Add("Access-Control-Allow-Headers", "X-Auth-Token, Authorization, X-API-Key, X-Request-ID, Content-Type")
 			rw.Header().Add("Access-Control-Allow-Methods", "GET,PUT,POST,DELETE")
 		})
 	}
@@ -306,7 +484,10 @@ func NewServer(configFile string) (*Server, error) {
 
 //Start starts GohanAPIServer
 func (server *Server) Start() (err error) {
-	if server.tls != nil {
+	if server.tls != nil && server.tls.ClientConfig != nil {
+		httpServer := &http.Server{Addr: server.address, Handler: server.martini, TLSConfig: server.tls.ClientConfig}
+		err = httpServer.ListenAndServeTLS(server.tls.CertFile, server.tls.KeyFile)
+	} else if server.tls != nil {
 		err = http.ListenAndServeTLS(server.address, server.tls.CertFile, server.tls.KeyFile, server.martini)
 	} else {
 		err = http.ListenAndServe(server.address, server.martini)
@@ -322,6 +503,16 @@ func (server *Server) Stop() {
 	stopSyncWatchProcess(server)
 	stopSNMPProcess(server)
 	stopCRONProcess(server)
+	stopSchemaReloadProcess(server)
+	for _, identity := range middleware.WrappedIdentityServices(server.keystoneIdentity) {
+		if keystoneIdentity, ok := identity.(*cloud.KeystoneIdentity); ok {
+			keystoneIdentity.StopTokenCache()
+			keystoneIdentity.StopTenantDirectory()
+		}
+	}
+	if counter, ok := server.rateLimitCounter.(*middleware.SyncRateLimitCounter); ok {
+		counter.Stop()
+	}
 }
 
 //RunServer runs gohan api server
@@ -349,6 +540,7 @@ func RunServer(configFile string) {
 	startSyncWatchProcess(server)
 	startSNMPProcess(server)
 	startCRONProcess(server)
+	startSchemaReloadProcess(server)
 	log.Error(fmt.Sprintf("Error in Serve: %s", server.Start()))
 }
 
@@ -19,6 +19,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"strconv"
 	"testing"
@@ -355,6 +356,76 @@ var _ = Describe("Server package test", func() {
 		})
 	})
 
+	Describe("SchemaGraph", func() {
+		It("should contain only readable schemas", func() {
+			nodeIDs := func(result interface{}) []string {
+				ids := []string{}
+				for _, node := range result.(map[string]interface{})["nodes"].([]interface{}) {
+					ids = append(ids, node.(map[string]interface{})["id"].(string))
+				}
+				return ids
+			}
+			result := testURL("GET", baseURL+"/_graph", adminTokenID, nil, http.StatusOK)
+			Expect(nodeIDs(result)).To(ContainElement("subnet"))
+			result = testURL("GET", baseURL+"/_graph", memberTokenID, nil, http.StatusOK)
+			Expect(nodeIDs(result)).To(ContainElement("network"))
+			Expect(nodeIDs(result)).ToNot(ContainElement("subnet"))
+
+			result = testURL("GET", baseURL+"/_graph?focus=subnet&depth=1", adminTokenID, nil, http.StatusOK)
+			Expect(nodeIDs(result)).To(ConsistOf("subnet", "network"))
+			testURL("GET", baseURL+"/_graph?focus=unknown", adminTokenID, nil, http.StatusNotFound)
+			testURL("GET", baseURL+"/_graph?format=svg", adminTokenID, nil, http.StatusBadRequest)
+		})
+	})
+
+	Describe("PolicyExplain", func() {
+		explainURL := baseURL + "/_policy/explain"
+
+		It("should explain policies applied to a synthetic authorization", func() {
+			result := testURL("POST", explainURL, adminTokenID, map[string]interface{}{
+				"action": "read",
+				"path":   "/v2.0/networks/red",
+				"authorization": map[string]interface{}{
+					"tenant_id": memberTenantID,
+					"roles":     []string{"_member_"},
+				},
+			}, http.StatusOK)
+			explanation := result.(map[string]interface{})
+			Expect(explanation["allowed"]).To(BeTrue())
+			Expect(explanation["policy"]).To(Equal("member_statement"))
+			Expect(explanation["properties"]).To(ConsistOf("id", "description", "name", "tenant_id"))
+			Expect(explanation["tenant_filter"]).To(ContainElement(memberTenantID))
+			for _, rawEvaluation := range explanation["policies"].([]interface{}) {
+				evaluation := rawEvaluation.(map[string]interface{})
+				if evaluation["id"] == "admin_statement" {
+					Expect(evaluation["matched"]).To(BeFalse())
+					Expect(evaluation["reason"]).To(Equal("no role matches principal admin"))
+				}
+			}
+		})
+
+		It("should explain denied requests of the token", func() {
+			result := testURL("POST", explainURL, adminTokenID, map[string]interface{}{
+				"action": "delete",
+				"path":   "/v2.0/subnets/red",
+				"token":  memberTokenID,
+			}, http.StatusOK)
+			explanation := result.(map[string]interface{})
+			Expect(explanation["allowed"]).To(BeFalse())
+			Expect(explanation).ToNot(HaveKey("policy"))
+		})
+
+		It("should be allowed only for admin", func() {
+			testURL("POST", explainURL, memberTokenID, map[string]interface{}{
+				"action": "read",
+				"path":   "/v2.0/networks",
+			}, http.StatusUnauthorized)
+			testURL("POST", explainURL, adminTokenID, map[string]interface{}{
+				"action": "read",
+			}, http.StatusBadRequest)
+		})
+	})
+
 	Describe("StringQueries", func() {
 		It("should work", func() {
 			testURL("POST", networkPluralURL, adminTokenID, getNetwork("red", "red"), http.StatusCreated)
@@ -406,6 +477,40 @@ var _ = Describe("Server package test", func() {
 		})
 	})
 
+	Describe("ResourceTags", func() {
+		It("should work", func() {
+			serverPluralURL := baseURL + "/v2.0/servers"
+			getServer := func(id string, tags map[string]interface{}) map[string]interface{} {
+				return map[string]interface{}{"id": id, "name": id, "tenant_id": adminTenantID, "tags": tags}
+			}
+			testURL("POST", serverPluralURL, adminTokenID,
+				getServer("web", map[string]interface{}{"env": "prod"}), http.StatusCreated)
+			testURL("POST", serverPluralURL, adminTokenID,
+				getServer("db", map[string]interface{}{"env": "dev"}), http.StatusCreated)
+			testURL("POST", serverPluralURL, adminTokenID,
+				getServer("bad", map[string]interface{}{"env": 1}), http.StatusBadRequest)
+
+			result := testURL("GET", serverPluralURL+"?tags=env:prod", adminTokenID, nil, http.StatusOK)
+			servers := result.(map[string]interface{})["servers"].([]interface{})
+			Expect(servers).To(HaveLen(1))
+			Expect(servers[0]).To(HaveKeyWithValue("tags", map[string]interface{}{"env": "prod"}))
+
+			result = testURL("POST", serverPluralURL+"/web/tags", adminTokenID,
+				map[string]interface{}{"tags": map[string]interface{}{"team": "net"}}, http.StatusOK)
+			testJSONEquality(result, map[string]interface{}{"tags": map[string]interface{}{"env": "prod", "team": "net"}})
+			testURL("DELETE", serverPluralURL+"/web/tags/env", adminTokenID, nil, http.StatusNoContent)
+			result = testURL("GET", serverPluralURL+"/web/tags", adminTokenID, nil, http.StatusOK)
+			testJSONEquality(result, map[string]interface{}{"tags": map[string]interface{}{"team": "net"}})
+
+			result = testURL("GET", serverPluralURL+"?tags=env", adminTokenID, nil, http.StatusOK)
+			servers = result.(map[string]interface{})["servers"].([]interface{})
+			Expect(servers).To(HaveLen(1))
+			Expect(servers[0]).To(HaveKeyWithValue("id", "db"))
+			testURL("POST", networkPluralURL+"/red/tags", adminTokenID,
+				map[string]interface{}{"tags": map[string]interface{}{"team": "net"}}, http.StatusNotFound)
+		})
+	})
+
 	Describe("BoolQueries", func() {
 		It("should work", func() {
 			network1 := getNetwork("red1", "red")
@@ -586,6 +691,125 @@ var _ = Describe("Server package test", func() {
 		})
 	})
 
+	Describe("Metrics", func() {
+		It("should serve metrics in Prometheus text format to admin", func() {
+			testURL("GET", networkPluralURL, adminTokenID, nil, http.StatusOK)
+
+			request, err := http.NewRequest("GET", baseURL+"/metrics", nil)
+			Expect(err).ToNot(HaveOccurred())
+			request.Header.Set("X-Auth-Token", adminTokenID)
+			resp, err := http.DefaultClient.Do(request)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Content-Type")).To(HavePrefix("text/plain"))
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(ContainSubstring(`gohan_http_requests_total{schema="network",action="read",status="200"}`))
+			Expect(string(body)).To(ContainSubstring("gohan_db_transaction_duration_seconds_count{"))
+			Expect(string(body)).To(ContainSubstring("go_goroutines"))
+
+			testURL("GET", baseURL+"/metrics", memberTokenID, nil, http.StatusUnauthorized)
+		})
+	})
+
+	Describe("Schema reload", func() {
+		extensionURL := baseURL + "/gohan/v0.1/extensions"
+
+		AfterEach(func() {
+			httpRequest("DELETE", extensionURL+"/reload_test", adminTokenID, nil)
+			Expect(server.ReloadSchemas()).To(Succeed())
+		})
+
+		It("should keep extensions stored in the database", func() {
+			extension := map[string]interface{}{
+				"id":        "reload_test",
+				"code_type": "javascript",
+				"path":      "/v2.0/networks",
+				"code": `gohan_register_handler("post_list", function(context) {
+					context.response.reloaded = true;
+				});`,
+			}
+			testURL("POST", extensionURL, adminTokenID, extension, http.StatusCreated)
+			Expect(server.ReloadSchemas()).To(Succeed())
+			result := testURL("GET", networkPluralURL, adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("reloaded", true))
+
+			Expect(server.ReloadSchemas()).To(Succeed())
+			result = testURL("GET", networkPluralURL, adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("reloaded", true))
+		})
+	})
+
+	Describe("Health checks", func() {
+		It("should report health without token", func() {
+			result := testURL("GET", baseURL+"/healthz", "", nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("status", "ok"))
+			checks := result.(map[string]interface{})["checks"]
+			Expect(checks).To(HaveLen(1))
+			Expect(checks).To(HaveKeyWithValue("database", HaveKeyWithValue("status", "ok")))
+		})
+
+		It("should report readiness of configured checks without token", func() {
+			result := testURL("GET", baseURL+"/readyz", "", nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("status", "ok"))
+			checks := result.(map[string]interface{})["checks"]
+			Expect(checks).To(HaveLen(4))
+			Expect(checks).To(HaveKeyWithValue("schemas", HaveKeyWithValue("status", "ok")))
+			Expect(checks).To(HaveKeyWithValue("sync_lock", HaveKey("owner")))
+			Expect(checks).To(HaveKeyWithValue("amqp", HaveKeyWithValue("enabled", false)))
+
+			testURL("POST", baseURL+"/readyz", "", nil, http.StatusUnauthorized)
+		})
+	})
+
+	Describe("RequestID", func() {
+		requestWithID := func(requestID string) *http.Response {
+			request, err := http.NewRequest("GET", networkPluralURL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			request.Header.Set("X-Auth-Token", adminTokenID)
+			if requestID != "" {
+				request.Header.Set("X-Request-ID", requestID)
+			}
+			resp, err := http.DefaultClient.Do(request)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			return resp
+		}
+
+		It("should return accepted or generated request IDs", func() {
+			Expect(requestWithID("req-1").Header.Get("X-Request-ID")).To(Equal("req-1"))
+			generated := requestWithID("").Header.Get("X-Request-ID")
+			Expect(generated).ToNot(BeEmpty())
+			Expect(requestWithID("").Header.Get("X-Request-ID")).ToNot(Equal(generated))
+			invalid := requestWithID("bad id\n").Header.Get("X-Request-ID")
+			Expect(invalid).ToNot(BeEmpty())
+			Expect(invalid).ToNot(ContainSubstring("bad"))
+		})
+
+		It("should record request IDs in sync events", func() {
+			networkResource, err := schema.GetManager().LoadResource("network", getNetwork("Red", "red"))
+			Expect(err).ToNot(HaveOccurred())
+			tx, _ := (&srv.DbSyncWrapper{DB: testDB}).Begin()
+			transaction.SetRequestID(tx, "req-sync")
+			Expect(tx.Create(networkResource)).To(Succeed())
+			Expect(tx.Commit()).To(Succeed())
+			tx.Close()
+
+			eventSchema, _ := schema.GetManager().Schema("event")
+			tx, _ = testDB.Begin()
+			defer tx.Close()
+			events, _, err := tx.List(eventSchema, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Get("request_id")).To(Equal("req-sync"))
+			var body map[string]interface{}
+			Expect(json.Unmarshal([]byte(events[0].Get("body").(string)), &body)).To(Succeed())
+			Expect(body).ToNot(HaveKey("request_id"))
+			Expect(body).To(HaveKeyWithValue("id", networkResource.ID()))
+		})
+	})
+
 	Describe("Resource Actions", func() {
 		responderPluralURL := baseURL + "/v2.0/responders"
 
@@ -646,6 +870,129 @@ var _ = Describe("Server package test", func() {
 			result = testURL("POST", responderPluralURL+"/r1/dzien_dobry", adminTokenID, unknownAction, http.StatusNotFound)
 		})
 	})
+
+	Describe("PublicPaths", func() {
+		responderPluralURL := baseURL + "/v2.0/responders"
+
+		It("should authorize requests without token as anonymous", func() {
+			responder := map[string]interface{}{
+				"id":        "r1",
+				"pattern":   "Hello %s!",
+				"tenant_id": memberTenantID,
+			}
+			testURL("POST", responderPluralURL, adminTokenID, responder, http.StatusCreated)
+			testURL("POST", responderPluralURL, "", responder, http.StatusUnauthorized)
+			testURL("GET", responderPluralURL+"/r1", "", nil, http.StatusUnauthorized)
+			testURL("GET", networkPluralURL, "", nil, http.StatusUnauthorized)
+
+			result := testURL("GET", responderPluralURL, "", nil, http.StatusOK)
+			Expect(result.(map[string]interface{})["responders"]).To(HaveLen(1))
+			testURL("GET", responderPluralURL, "invalid_token", nil, http.StatusUnauthorized)
+
+			result = testURL("POST", baseURL+"/_policy/explain", adminTokenID, map[string]interface{}{
+				"action":        "read",
+				"path":          "/v2.0/responders",
+				"authorization": map[string]interface{}{"anonymous": true},
+			}, http.StatusOK)
+			Expect(result.(map[string]interface{})["policy"]).To(Equal("anonymous_responders"))
+		})
+	})
+
+	Describe("APIKeys", func() {
+		apiKeyPluralURL := baseURL + "/gohan/v0.1/api_keys"
+
+		createAPIKey := func(apiKey map[string]interface{}) string {
+			result := testURL("POST", apiKeyPluralURL, adminTokenID, apiKey, http.StatusCreated)
+			created := result.(map[string]interface{})["api_key"].(map[string]interface{})
+			Expect(created).ToNot(HaveKey("secret_hash"))
+			Expect(created["secret"]).To(HavePrefix(apiKey["id"].(string) + "."))
+			return created["secret"].(string)
+		}
+
+		It("should authenticate requests by API keys", func() {
+			secret := createAPIKey(map[string]interface{}{
+				"id":        "key1",
+				"name":      "automation",
+				"tenant_id": memberTenantID,
+				"roles":     []string{"_member_"},
+			})
+			Expect(apiKeyRequest("GET", networkPluralURL, secret).StatusCode).To(Equal(http.StatusOK))
+			Expect(apiKeyRequest("GET", networkPluralURL, "key1.wrong").StatusCode).To(Equal(http.StatusUnauthorized))
+			Expect(apiKeyRequest("GET", apiKeyPluralURL, secret).StatusCode).To(Equal(http.StatusUnauthorized))
+
+			result := testURL("GET", apiKeyPluralURL, adminTokenID, nil, http.StatusOK)
+			apiKeys := result.(map[string]interface{})["api_keys"].([]interface{})
+			Expect(apiKeys).To(HaveLen(1))
+			Expect(apiKeys[0]).ToNot(HaveKey("secret_hash"))
+		})
+
+		It("should rotate and revoke API keys", func() {
+			secret := createAPIKey(map[string]interface{}{
+				"id":        "key1",
+				"tenant_id": memberTenantID,
+				"roles":     []string{"_member_"},
+			})
+			result := testURL("POST", apiKeyPluralURL+"/key1/rotate", adminTokenID, map[string]interface{}{}, http.StatusOK)
+			rotated := result.(map[string]interface{})["api_key"].(map[string]interface{})["secret"].(string)
+			Expect(rotated).ToNot(Equal(secret))
+			Expect(apiKeyRequest("GET", networkPluralURL, secret).StatusCode).To(Equal(http.StatusUnauthorized))
+			Expect(apiKeyRequest("GET", networkPluralURL, rotated).StatusCode).To(Equal(http.StatusOK))
+
+			testURL("POST", apiKeyPluralURL+"/key1/revoke", adminTokenID, map[string]interface{}{}, http.StatusOK)
+			Expect(apiKeyRequest("GET", networkPluralURL, rotated).StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should restrict API keys by expiry and source address", func() {
+			expired := createAPIKey(map[string]interface{}{
+				"id":         "key1",
+				"tenant_id":  memberTenantID,
+				"roles":      []string{"_member_"},
+				"expires_at": "2015-01-01T00:00:00Z",
+			})
+			Expect(apiKeyRequest("GET", networkPluralURL, expired).StatusCode).To(Equal(http.StatusUnauthorized))
+
+			remote := createAPIKey(map[string]interface{}{
+				"id":            "key2",
+				"tenant_id":     memberTenantID,
+				"roles":         []string{"_member_"},
+				"allowed_cidrs": []string{"10.0.0.0/8"},
+			})
+			Expect(apiKeyRequest("GET", networkPluralURL, remote).StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should show error - invalid API keys", func() {
+			testURL("POST", apiKeyPluralURL, adminTokenID, map[string]interface{}{
+				"tenant_id":  memberTenantID,
+				"expires_at": "tomorrow",
+			}, http.StatusBadRequest)
+			testURL("POST", apiKeyPluralURL, adminTokenID, map[string]interface{}{
+				"tenant_id":     memberTenantID,
+				"allowed_cidrs": []string{"10.0.0.1"},
+			}, http.StatusBadRequest)
+			testURL("POST", apiKeyPluralURL, memberTokenID, map[string]interface{}{
+				"roles": []string{"admin"},
+			}, http.StatusUnauthorized)
+		})
+	})
+
+	Describe("RateLimit", func() {
+		It("should limit requests per tenant with Retry-After", func() {
+			rateLimitedURL := baseURL + "/v2.0/rate_limited"
+			for i := 0; i < 2; i++ {
+				_, resp := httpRequest("GET", rateLimitedURL, adminTokenID, nil)
+				Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+			}
+			result, resp := httpRequest("GET", rateLimitedURL, memberTokenID, nil)
+			Expect(resp.StatusCode).To(Equal(429))
+			Expect(resp.Header.Get("Retry-After")).To(Equal("100"))
+			Expect(result.(map[string]interface{})["error"]).To(ContainSubstring(memberTenantID))
+
+			_, resp = httpRequest("GET", rateLimitedURL, powerUserTokenID, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+			_, resp = httpRequest("GET", networkPluralURL, adminTokenID, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+	})
 })
 
 func BenchmarkPOSTAPI(b *testing.B) {
@@ -782,6 +1129,16 @@ func httpRequest(method, url, token string, postData interface{}) (interface{},
 	return data, resp
 }
 
+func apiKeyRequest(method, url, apiKey string) *http.Response {
+	request, err := http.NewRequest(method, url, nil)
+	Expect(err).ToNot(HaveOccurred())
+	request.Header.Set("X-API-Key", apiKey)
+	resp, err := http.DefaultClient.Do(request)
+	Expect(err).ToNot(HaveOccurred())
+	resp.Body.Close()
+	return resp
+}
+
 func clearTable(tx transaction.Transaction, s *schema.Schema) error {
 	for _, schema := range schema.GetManager().Schemas() {
 		if schema.ParentSchema == s {
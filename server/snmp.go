@@ -20,14 +20,12 @@ import (
 	"net"
 
 	"github.com/cdevr/WapSNMP"
-	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/util"
 )
 
 //SNMP Process
 //Experimental
 func startSNMPProcess(server *Server) {
-	manager := schema.GetManager()
 	config := util.GetConfig()
 	enabled := config.GetParam("snmp", nil)
 	if enabled == nil {
@@ -36,8 +34,7 @@ func startSNMPProcess(server *Server) {
 	host := config.GetString("snmp/address", "localhost:162")
 
 	path := "snmp://"
-	env := newEnvironment(server.db, server.keystoneIdentity)
-	err := env.LoadExtensionsForPath(manager.Extensions, path)
+	err := server.registerBackgroundEnvironment(path)
 	if err != nil {
 		log.Fatal(fmt.Sprintf("Extensions parsing error: %v", err))
 	}
@@ -74,6 +71,10 @@ func startSNMPProcess(server *Server) {
 				trap[oid.String()] = fmt.Sprintf("%v", listInfo[2])
 			}
 			err = func() error {
+				env, err := backgroundEnvironment(path)
+				if err != nil {
+					return err
+				}
 				tx, err := server.db.Begin()
 				defer tx.Close()
 				context := map[string]interface{}{
@@ -94,6 +95,7 @@ func startSNMPProcess(server *Server) {
 				}
 				return nil
 			}()
+			notifications.Inc("snmp", notificationResult(err))
 		}
 	}()
 }
@@ -25,6 +25,7 @@ import (
 	"github.com/cloudwan/gohan/db/pagination"
 	"github.com/cloudwan/gohan/db/transaction"
 	"github.com/cloudwan/gohan/extension"
+	l "github.com/cloudwan/gohan/log"
 
 	"github.com/cloudwan/gohan/schema"
 	gohan_sync "github.com/cloudwan/gohan/sync"
@@ -49,10 +50,23 @@ func (sw *DbSyncWrapper) Begin() (transaction.Transaction, error) {
 
 type transactionEventLogger struct {
 	transaction.Transaction
+	requestID string
 }
 
 func syncTransactionWrap(tx transaction.Transaction) *transactionEventLogger {
-	return &transactionEventLogger{tx}
+	tl := &transactionEventLogger{Transaction: tx}
+	transaction.Wrap(tx, tl)
+	return tl
+}
+
+//Wrap makes changes the wrapped transaction makes on its own go through wrapper
+func (tl *transactionEventLogger) Wrap(wrapper transaction.Transaction) {
+	transaction.Wrap(tl.Transaction, wrapper)
+}
+
+//SetRequestID sets ID of the request making changes, which is logged with events
+func (tl *transactionEventLogger) SetRequestID(requestID string) {
+	tl.requestID = requestID
 }
 
 func (tl *transactionEventLogger) logEvent(eventType string, resource *schema.Resource) error {
@@ -71,10 +85,11 @@ func (tl *transactionEventLogger) logEvent(eventType string, resource *schema.Re
 		return fmt.Errorf("Error during event resource deserialisation: %s", err.Error())
 	}
 	eventResource, err := schema.NewResource(eventSchema, map[string]interface{}{
-		"type":      eventType,
-		"path":      resource.Path(),
-		"body":      body,
-		"timestamp": int64(time.Now().Unix()),
+		"type":       eventType,
+		"path":       resource.Path(),
+		"body":       body,
+		"timestamp":  int64(time.Now().Unix()),
+		"request_id": tl.requestID,
 	})
 	return tl.Transaction.Create(eventResource)
 }
@@ -96,7 +111,34 @@ func (tl *transactionEventLogger) Update(resource *schema.Resource) error {
 }
 
 func (tl *transactionEventLogger) StateUpdate(resource *schema.Resource) error {
-	return tl.Transaction.StateUpdate(resource)
+	s := resource.Schema()
+	if s.StateMachine == nil {
+		return tl.Transaction.StateUpdate(resource)
+	}
+	previous, err := tl.Fetch(s, resource.ID(), nil)
+	if err != nil {
+		return err
+	}
+	property := s.StateMachine.Property
+	transition, err := s.StateMachine.CheckTransition(
+		previous.Get(property), resource.Get(property), schema.ActionStateUpdate, nil)
+	if err != nil {
+		return err
+	}
+	err = tl.Transaction.StateUpdate(resource)
+	if err != nil || transition == nil {
+		return err
+	}
+	env, ok := extension.GetManager().GetEnvironment(s.ID)
+	if !ok {
+		return nil
+	}
+	context := map[string]interface{}{
+		"transaction": tl,
+		"resource":    resource.Data(),
+		"transition":  transition.Data(),
+	}
+	return env.HandleEvent("state_transition", context)
 }
 
 func (tl *transactionEventLogger) Delete(s *schema.Schema, resourceID interface{}) error {
@@ -138,34 +180,36 @@ func (server *Server) syncEvent(resource *schema.Resource) error {
 	eventType := resource.Get("type").(string)
 	path := resource.Get("path").(string)
 	body := resource.Get("body").(string)
-	log.Debug("event %s", eventType)
+	requestID, _ := resource.Get("request_id").(string)
+	logger := l.NewRequestLogger(log, requestID)
+	logger.Debug("event %s", eventType)
 
 	if eventType == "create" || eventType == "update" {
-		log.Debug("set %s on sync", path)
+		logger.Debug("set %s on sync", path)
 		err = server.sync.Update(path, body)
 		if err != nil {
-			log.Error(fmt.Sprintf("%s on sync", err))
+			logger.Error(fmt.Sprintf("%s on sync", err))
 			return err
 		}
 	} else if eventType == "delete" {
-		log.Debug("delete %s", path)
+		logger.Debug("delete %s", path)
 		err = server.sync.Delete(path)
 		if err != nil {
-			log.Error(fmt.Sprintf("Delete from sync failed %s", err))
+			logger.Error(fmt.Sprintf("Delete from sync failed %s", err))
 			return err
 		}
 	}
-	log.Debug("delete event %d", resource.Get("id"))
+	logger.Debug("delete event %d", resource.Get("id"))
 	id := resource.Get("id")
 	err = tx.Delete(eventSchema, id)
 	if err != nil {
-		log.Error(fmt.Sprintf("delete failed: %s", err))
+		logger.Error(fmt.Sprintf("delete failed: %s", err))
 		return err
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		log.Error(fmt.Sprintf("commit failed: %s", err))
+		logger.Error(fmt.Sprintf("commit failed: %s", err))
 		return err
 	}
 	return nil
@@ -194,6 +238,7 @@ func (server *Server) Sync() error {
 	if err != nil {
 		return err
 	}
+	syncQueueDepth.Set(float64(len(resourceList)))
 	for _, resource := range resourceList {
 		err = server.syncEvent(resource)
 		if err != nil {
@@ -238,7 +283,6 @@ func runExtensionOnSync(server *Server, response *gohan_sync.Event, env extensio
 
 //Sync Watch Process
 func startSyncWatchProcess(server *Server) {
-	manager := schema.GetManager()
 	config := util.GetConfig()
 	watch := config.GetStringList("watch/keys", nil)
 	events := config.GetStringList("watch/events", nil)
@@ -246,15 +290,11 @@ func startSyncWatchProcess(server *Server) {
 	if watch == nil {
 		return
 	}
-	extensions := map[string]extension.Environment{}
 	for _, event := range events {
-		path := "sync://" + event
-		env := newEnvironment(server.db, server.keystoneIdentity)
-		err := env.LoadExtensionsForPath(manager.Extensions, path)
+		err := server.registerBackgroundEnvironment("sync://" + event)
 		if err != nil {
 			log.Fatal(fmt.Sprintf("Extensions parsing error: %v", err))
 		}
-		extensions[event] = env
 	}
 	responseChan := make(chan *gohan_sync.Event)
 	stopChan := make(chan bool)
@@ -286,7 +326,11 @@ func startSyncWatchProcess(server *Server) {
 				for _, event := range events {
 					//match extensions
 					if strings.HasPrefix(response.Key, "/"+event) {
-						env := extensions[event]
+						env, err := backgroundEnvironment("sync://" + event)
+						if err != nil {
+							log.Error(fmt.Sprintf("sync watch error: %s", err))
+							return
+						}
 						runExtensionOnSync(server, response, env)
 						return
 					}
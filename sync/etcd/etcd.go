@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	gosync "sync"
 	"time"
 
 	"github.com/cloudwan/gohan/sync"
@@ -31,6 +32,7 @@ const masterTTL = 10
 
 //Sync is struct for etcd based sync
 type Sync struct {
+	locksMutex gosync.RWMutex
 	locks      map[string]bool
 	etcdClient *etcd.Client
 	processID  string
@@ -68,10 +70,19 @@ func (s *Sync) Fetch(key string) (interface{}, error) {
 
 //HasLock checks current process owns lock or not
 func (s *Sync) HasLock(path string) bool {
+	s.locksMutex.RLock()
+	defer s.locksMutex.RUnlock()
 	value, ok := s.locks[path]
 	return value && ok
 }
 
+//setLock records whether current process owns lock
+func (s *Sync) setLock(path string, locked bool) {
+	s.locksMutex.Lock()
+	defer s.locksMutex.Unlock()
+	s.locks[path] = locked
+}
+
 // Lock locks resources on sync
 // This call blocks until you can get lock
 func (s *Sync) Lock(path string, block bool) error {
@@ -82,7 +93,7 @@ func (s *Sync) Lock(path string, block bool) error {
 		_, err := s.etcdClient.Create(path, s.processID, masterTTL)
 		if err != nil {
 			log.Notice("failed to lock path %s: %s", path, err)
-			s.locks[path] = false
+			s.setLock(path, false)
 			if !block {
 				return err
 			}
@@ -90,15 +101,15 @@ func (s *Sync) Lock(path string, block bool) error {
 			continue
 		}
 		log.Info("Locked %s", path)
-		s.locks[path] = true
+		s.setLock(path, true)
 		//Refresh master token
 		go func() {
-			for s.locks[path] {
+			for s.HasLock(path) {
 				_, err := s.etcdClient.CompareAndSwap(
 					path, s.processID, masterTTL, s.processID, 0)
 				if err != nil {
 					log.Notice("failed to keepalive lock for %s %s", path, err)
-					s.locks[path] = false
+					s.setLock(path, false)
 					return
 				}
 				time.Sleep(masterTTL / 2 * time.Second)
@@ -110,7 +121,7 @@ func (s *Sync) Lock(path string, block bool) error {
 
 //Unlock path
 func (s *Sync) Unlock(path string) error {
-	s.locks[path] = false
+	s.setLock(path, false)
 	s.etcdClient.CompareAndDelete(path, s.processID, 0)
 	log.Info("Unlocked path %s", path)
 	return nil
@@ -88,6 +88,30 @@ func (config *Config) GetBool(key string, defaultValue bool) bool {
 	return dataString
 }
 
+//GetInt returns int parameter from config
+func (config *Config) GetInt(key string, defaultValue int) int {
+	data := config.GetParam(key, defaultValue)
+	switch value := data.(type) {
+	case int:
+		return value
+	case float64:
+		return int(value)
+	}
+	return defaultValue
+}
+
+//GetFloat returns float parameter from config
+func (config *Config) GetFloat(key string, defaultValue float64) float64 {
+	data := config.GetParam(key, defaultValue)
+	switch value := data.(type) {
+	case int:
+		return float64(value)
+	case float64:
+		return value
+	}
+	return defaultValue
+}
+
 //GetStringList returns string list parameter from config
 func (config *Config) GetStringList(key string, defaultValue []string) []string {
 	data := config.GetParam(key, defaultValue)
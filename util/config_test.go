@@ -34,4 +34,6 @@ func TestConfig(t *testing.T) {
 	Expect(etcdServers).ToNot(BeNil())
 	etcdServerList := config.GetList("etcd", nil)
 	Expect(etcdServerList).ToNot(BeNil())
+	Expect(config.GetInt("watch/worker_count", 0)).To(Equal(4))
+	Expect(config.GetInt("address", 7)).To(Equal(7))
 }